@@ -14,6 +14,7 @@ type Backend interface {
 	Update(opts *model.DomainOptions) (model.Domain, error)
 	Delete(opts *model.DomainOptions) error
 	Renew(opts *model.DomainOptions) (model.Domain, error)
+	Suspend(opts *model.DomainOptions) error
 	SetText(opts *model.DomainOptions) (model.Domain, error)
 	GetText(opts *model.DomainOptions) (model.Domain, error)
 	UpdateText(opts *model.DomainOptions) (model.Domain, error)
@@ -24,11 +25,21 @@ type Backend interface {
 	DeleteCNAME(opts *model.DomainOptions) error
 	GetToken(fqdn string) (string, error)
 	GetTokenCount() (int64, error)
+	RequiresSignature(fqdn string) (bool, error)
 	GetZone() string
 	GetName() string
+	ListFrozen(prefix string) ([]model.Frozen, error)
+	AddFrozen(opts *model.FrozenOptions) (model.Frozen, error)
+	ExtendFrozen(opts *model.FrozenOptions) (model.Frozen, error)
+	ReleaseFrozen(prefix string) error
+	ListDS() ([]model.DS, error)
+	ListHealthStates() ([]*model.HealthState, error)
+	SetHealthState(s *model.HealthState) error
 	MigrateFrozen(opts *model.MigrateFrozen) error
 	MigrateToken(opts *model.MigrateToken) error
 	MigrateRecord(opts *model.MigrateRecord) error
+	Export(emit func(*model.ExportEntry) error) error
+	Import(e *model.ExportEntry) error
 }
 
 func SetBackend(b Backend) {
@@ -0,0 +1,255 @@
+package etcdv3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/pkg/errors"
+)
+
+// leases which are granted within the settle time may not have their keys yet, they are not checked
+const checkSettleTime = time.Minute
+
+// Check finds the inconsistent keys and leases of the backend, they are fixed when fix is true:
+//   records, suspended records and health checks without a token are deleted
+//   records whose lease is not the lease of their token are moved to the token lease
+//   leases of rdns without any attached keys but their marker are revoked, the other leases without keys are reported
+//   frozen keys which never expire are deleted, or moved to a new frozen lease when their domain exists
+func (b *Backend) Check(fix bool) (*model.CheckReport, error) {
+	r := &model.CheckReport{
+		Fix:     fix,
+		Started: time.Now(),
+		Issues:  make([]model.Issue, 0),
+	}
+
+	tokens, err := b.listKVs(tokenPath + "/")
+	if err != nil {
+		return r, err
+	}
+
+	domainPath := getPath(b.Prefix, b.Domain) + "/"
+	records, err := b.listKVs(domainPath)
+	if err != nil {
+		return r, err
+	}
+
+	suspendedPrefix := fmt.Sprintf("%s%s/", b.Prefix, suspendedPath)
+	suspended, err := b.listKVs(suspendedPrefix)
+	if err != nil {
+		return r, err
+	}
+
+	healthPrefix := fmt.Sprintf("%s%s/", b.Prefix, healthPath)
+	health, err := b.listKVs(healthPrefix)
+	if err != nil {
+		return r, err
+	}
+
+	frozenPrefix := fmt.Sprintf("%s%s/", b.Prefix, frozenPath)
+	frozen, err := b.listKVs(frozenPrefix)
+	if err != nil {
+		return r, err
+	}
+
+	r.Keys = len(tokens) + len(records) + len(suspended) + len(health) + len(frozen)
+
+	// e.g. /rdnsv3/cloud/rancher/lb/sample/x1/1_1_1_1 => sample.lb.rancher.cloud
+	for _, kv := range records {
+		slug := strings.SplitN(strings.TrimPrefix(string(kv.Key), domainPath), "/", 2)[0]
+		b.checkRecord(r, kv, tokens[getTokenPath(fmt.Sprintf("%s.%s", slug, b.Domain))])
+	}
+
+	// e.g. /rdnsv3/suspendedv3/sample_lb_rancher_cloud => sample.lb.rancher.cloud
+	for _, kv := range suspended {
+		fqdn := strings.Replace(strings.TrimPrefix(string(kv.Key), suspendedPrefix), "_", ".", -1)
+		b.checkRecord(r, kv, tokens[getTokenPath(fqdn)])
+	}
+
+	// e.g. /rdnsv3/healthv3/sample_lb_rancher_cloud => sample.lb.rancher.cloud
+	for _, kv := range health {
+		fqdn := strings.Replace(strings.TrimPrefix(string(kv.Key), healthPrefix), "_", ".", -1)
+		b.checkRecord(r, kv, tokens[getTokenPath(fqdn)])
+	}
+
+	for _, kv := range frozen {
+		slug := strings.TrimPrefix(string(kv.Key), frozenPrefix)
+		b.checkFrozen(r, kv, tokens[getTokenPath(fmt.Sprintf("%s.%s", slug, b.Domain))] != nil)
+	}
+
+	if err := b.checkLeases(r); err != nil {
+		return r, err
+	}
+
+	r.Finished = time.Now()
+	r.Duration = r.Finished.Sub(r.Started).String()
+
+	return r, nil
+}
+
+// Used to check whether a record has a token and shares its lease
+func (b *Backend) checkRecord(r *model.CheckReport, kv, token *mvccpb.KeyValue) {
+	var err error
+
+	switch {
+	case token == nil:
+		if r.Fix {
+			err = b.deleteKV(kv)
+		}
+		r.AddIssue(model.Issue{
+			Kind:  model.IssueNoToken,
+			Key:   string(kv.Key),
+			Lease: kv.Lease,
+			Fixed: r.Fix && err == nil,
+		}, err)
+	case kv.Lease != token.Lease:
+		if r.Fix {
+			err = b.moveKV(kv, token.Lease)
+		}
+		r.AddIssue(model.Issue{
+			Kind:          model.IssueLeaseMismatch,
+			Key:           string(kv.Key),
+			Lease:         kv.Lease,
+			ExpectedLease: token.Lease,
+			Fixed:         r.Fix && err == nil,
+		}, err)
+	}
+}
+
+// Used to check whether a frozen key expires
+func (b *Backend) checkFrozen(r *model.CheckReport, kv *mvccpb.KeyValue, exist bool) {
+	if kv.Lease != 0 {
+		lease, err := b.getLease(kv.Lease)
+		if err != nil || lease.TTL != -1 {
+			return
+		}
+	}
+
+	var err error
+	if r.Fix {
+		if exist {
+			var leaseID int64
+			if leaseID, _, err = b.grantLease(int64(b.FrozenTTL.Seconds())); err == nil {
+				err = b.moveKV(kv, leaseID)
+			}
+		} else {
+			err = b.deleteKV(kv)
+		}
+	}
+
+	r.AddIssue(model.Issue{
+		Kind:  model.IssueStaleFrozen,
+		Key:   string(kv.Key),
+		Lease: kv.Lease,
+		Fixed: r.Fix && err == nil,
+	}, err)
+}
+
+// Used to find the leases which have no keys attached
+func (b *Backend) checkLeases(r *model.CheckReport) error {
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	resp, err := b.C.Leases(ctx)
+	cancel()
+	if err != nil {
+		return errors.Wrap(err, errListLeases)
+	}
+	r.Leases = len(resp.Leases)
+
+	for _, l := range resp.Leases {
+		lease, err := b.getAttachedKeys(l.ID)
+		if err != nil || lease.TTL <= 0 || len(lease.Keys) > 1 {
+			continue
+		}
+		if lease.GrantedTTL-lease.TTL < int64(checkSettleTime.Seconds()) {
+			continue
+		}
+
+		// a lease without any keys is not known to be granted by rdns, it may belong to another application
+		if len(lease.Keys) == 0 {
+			r.AddIssue(model.Issue{
+				Kind:  model.IssueUnknownLease,
+				Lease: int64(l.ID),
+			}, nil)
+			continue
+		}
+		if string(lease.Keys[0]) != getLeasePath(b.Prefix, int64(l.ID)) {
+			continue
+		}
+
+		if r.Fix {
+			ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+			_, err = b.C.Revoke(ctx, l.ID)
+			cancel()
+		}
+		r.AddIssue(model.Issue{
+			Kind:  model.IssueOrphanLease,
+			Lease: int64(l.ID),
+			Fixed: r.Fix && err == nil,
+		}, err)
+	}
+
+	return nil
+}
+
+// Used to get a lease with the keys which are attached to it
+func (b *Backend) getAttachedKeys(id clientv3.LeaseID) (*clientv3.LeaseTimeToLiveResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	return b.C.TimeToLive(ctx, id, clientv3.WithAttachedKeys())
+}
+
+// Used to list the keys with a prefix, keyed by key
+func (b *Backend) listKVs(prefix string) (map[string]*mvccpb.KeyValue, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	defer cancel()
+
+	resp, err := b.C.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, errors.Wrapf(err, errLookupRecords, typeKey, prefix)
+	}
+
+	kvs := make(map[string]*mvccpb.KeyValue, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		kvs[string(kv.Key)] = kv
+	}
+
+	return kvs, nil
+}
+
+// Used to delete a key only if it is not changed since it was read
+func (b *Backend) deleteKV(kv *mvccpb.KeyValue) error {
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	_, err := b.C.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(string(kv.Key)), "=", kv.ModRevision)).
+		Then(clientv3.OpDelete(string(kv.Key))).
+		Commit()
+	if err != nil {
+		return errors.Wrapf(err, errDeleteRecord, typeKey, string(kv.Key))
+	}
+
+	return nil
+}
+
+// Used to attach a key to another lease only if it is not changed since it was read
+func (b *Backend) moveKV(kv *mvccpb.KeyValue, leaseID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	_, err := b.C.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(string(kv.Key)), "=", kv.ModRevision)).
+		Then(clientv3.OpPut(string(kv.Key), string(kv.Value), clientv3.WithLease(clientv3.LeaseID(leaseID)))).
+		Commit()
+	if err != nil {
+		return errors.Wrapf(err, errSetRecordWithLease, typeKey, string(kv.Key), leaseID)
+	}
+
+	return nil
+}
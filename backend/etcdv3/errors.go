@@ -4,14 +4,20 @@ const (
 	errDeleteRecord           = "failed to delete %s record: %s"
 	errEmptyRecord            = "failed to found %s record: %s"
 	errExistSlug              = "slug name %s can not be used, try another"
+	errExpiredDomain          = "domain %s is expired"
+	errExportDomains          = "failed to export %d domains: %s"
 	errGrantLease             = "failed to grant lease"
 	errSetRecordWithLease     = "failed to set %s record %s with lease %d"
+	errUnknownExportKind      = "unknown export entry kind: %s"
 	errSyncRecords            = "failed to sync %s records: %s"
 	errSyncSubRecords         = "failed to sync sub %s records: %s"
 	errSetSubRecordsWithLease = "failed to set sub %s records %s with lease %d"
 	errKeepaliveOnce          = "failed to keepaliveOnce with lease %d"
+	errListLeases             = "failed to list leases"
 	errLookupRecords          = "failed to lookup %s record: %s"
 	errMultiRecords           = "multiple %s records: %s"
 	errNoLookupResults        = "no lookup results for %s record: %s"
 	errNotValidDomainName     = "not valid domain name: %s"
+	errNotSupportCNAME        = "%s record is not supported: %s"
+	errReservedSlug           = "slug name %s is reserved, try another"
 )
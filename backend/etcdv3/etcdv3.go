@@ -1,13 +1,16 @@
 package etcdv3
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/rancher/rdns-server/backend"
 	"github.com/rancher/rdns-server/model"
 	"github.com/rancher/rdns-server/util"
 
@@ -24,12 +27,26 @@ const (
 	typeTXT          = "TXT"
 	typeToken        = "TOKEN"
 	typeFrozen       = "FROZEN"
+	typeSuspended    = "SUSPENDED"
+	typeKey          = "KEY"
+	typeRenew        = "RENEW"
+	typeDNSSEC       = "DNSSEC"
+	typeHealth       = "HEALTH"
+	typeSigned       = "SIGNED"
+	typeLease        = "LEASE"
 	tokenPath        = "/tokenv3"
 	frozenPath       = "/frozenv3"
+	suspendedPath    = "/suspendedv3"
+	renewPath        = "/renewv3"
+	dnssecPath       = "/dnssecv3"
+	healthPath       = "/healthv3"
+	signedPath       = "/signedv3"
+	leasePath        = "/leasev3"
 	maxSlugHashTimes = 100
 	tokenLength      = 32
 	slugLength       = 6
 	operationTimeout = 100 * time.Millisecond
+	listTimeout      = 5 * time.Second
 )
 
 type Backend struct {
@@ -37,6 +54,8 @@ type Backend struct {
 	Prefix    string
 	FrozenTTL time.Duration
 	LeaseTime time.Duration
+	Grace     time.Duration
+	Parking   string
 
 	C *clientv3.Client
 }
@@ -58,12 +77,21 @@ func NewBackend() (*Backend, error) {
 	if err != nil {
 		return nil, err
 	}
+	var grace time.Duration
+	if v := os.Getenv("GRACE_PERIOD"); v != "" {
+		grace, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return &Backend{
 		Domain:    os.Getenv("DOMAIN"),
 		Prefix:    os.Getenv("ETCD_PREFIX_PATH"),
 		FrozenTTL: frozen,
 		LeaseTime: leaseTime,
+		Grace:     grace,
+		Parking:   os.Getenv("PARKING_ADDRESS"),
 		C:         c,
 	}, nil
 }
@@ -79,6 +107,15 @@ func (b *Backend) GetZone() string {
 func (b *Backend) Get(opts *model.DomainOptions) (d model.Domain, err error) {
 	logrus.Debugf("get %s record for domain options: %s", typeA, opts.String())
 
+	// the records of a suspended domain are replaced by the parking records, the origin ones are kept aside
+	if d, ok, err := b.getSuspended(opts); ok || err != nil {
+		if err == nil {
+			d.SignedOnly = b.checkPathExist(getSignedPath(b.Prefix, opts.Fqdn))
+			err = b.setHealth(&d)
+		}
+		return d, err
+	}
+
 	path := getPath(b.Prefix, opts.Fqdn)
 
 	kvs, err := b.lookupKeys(path)
@@ -92,6 +129,8 @@ func (b *Backend) Get(opts *model.DomainOptions) (d model.Domain, err error) {
 
 	subs := make(map[string][]string, 0)
 	hosts := make([]string, 0)
+	weights := make(map[string]model.HostWeight)
+	regions := make(map[string]string)
 
 	for _, v := range kvs {
 		k := string(v.Key)
@@ -117,6 +156,12 @@ func (b *Backend) Get(opts *model.DomainOptions) (d model.Domain, err error) {
 		}
 
 		hosts = append(hosts, m["host"])
+		if w, ok := toHostWeight(m); ok {
+			weights[m["host"]] = w
+		}
+		if m["region"] != "" {
+			regions[m["host"]] = m["region"]
+		}
 	}
 
 	lease, err := b.getLease(kvs[0].Lease)
@@ -148,29 +193,70 @@ func (b *Backend) Get(opts *model.DomainOptions) (d model.Domain, err error) {
 	d.Fqdn = opts.Fqdn
 	d.Hosts = hosts
 	d.SubDomain = subs
-	d.Expiration = getExpiration(lease.TTL)
+	d.Expiration = b.getExpiration(lease.TTL)
+	d.State = model.StateActive
+	d.SignedOnly = b.checkPathExist(getSignedPath(b.Prefix, opts.Fqdn))
+	if len(weights) > 0 {
+		d.Weights = weights
+	}
+	if len(regions) > 0 {
+		d.Regions = regions
+	}
 
-	return d, nil
+	return d, b.setHealth(&d)
 }
 
 func (b *Backend) Set(opts *model.DomainOptions) (d model.Domain, err error) {
 	logrus.Debugf("set %s record for domain options: %s", typeA, opts.String())
 
 	var path, slug string
-	for i := 0; i < maxSlugHashTimes; i++ {
-		slug = generateSlug()
+	var claim int64
+	if opts.Normal {
+		slug, err = backend.NameLabel(opts.Fqdn, b.Domain)
+		if err != nil {
+			return d, err
+		}
 
-		if b.checkSlugName(slug) {
-			logrus.Debugf(errExistSlug, slug)
-			continue
+		opts.Fqdn = fmt.Sprintf("%s.%s", slug, b.Domain)
+		path = getPath(b.Prefix, opts.Fqdn)
+
+		if b.checkSlugName(slug) || b.checkPathExist(path) {
+			return d, backend.NewNameTakenError(slug)
 		}
 
-		fqdn := fmt.Sprintf("%s.%s", slug, b.Domain)
-		path = getPath(b.Prefix, fqdn)
+		// the slug name is locked before the records are set, so that concurrent requests can not get the same name
+		claim, err = b.claimSlugName(slug, b.FrozenTTL)
+		if err != nil {
+			return d, err
+		}
+
+		// the claim is released when the domain can not be set, so that the name can be requested again
+		defer func() {
+			if err != nil {
+				b.releaseClaim(claim)
+			}
+		}()
+	} else {
+		for i := 0; i < maxSlugHashTimes; i++ {
+			slug = generateSlug()
+
+			if backend.IsReserved(slug) {
+				logrus.Debugf(errReservedSlug, slug)
+				continue
+			}
+
+			if b.checkSlugName(slug) {
+				logrus.Debugf(errExistSlug, slug)
+				continue
+			}
+
+			fqdn := fmt.Sprintf("%s.%s", slug, b.Domain)
+			path = getPath(b.Prefix, fqdn)
 
-		if !b.checkPathExist(path) {
-			opts.Fqdn = fqdn
-			break
+			if !b.checkPathExist(path) {
+				opts.Fqdn = fqdn
+				break
+			}
 		}
 	}
 
@@ -179,10 +265,16 @@ func (b *Backend) Set(opts *model.DomainOptions) (d model.Domain, err error) {
 		return d, err
 	}
 
-	if err := b.lockSlugName(opts.Fqdn, slug, false); err != nil {
+	if err := b.setHealthCheck(opts); err != nil {
 		return d, err
 	}
 
+	if !opts.Normal {
+		if err := b.lockSlugName(opts.Fqdn, slug, false); err != nil {
+			return d, err
+		}
+	}
+
 	return b.Get(opts)
 }
 
@@ -200,10 +292,19 @@ func (b *Backend) Update(opts *model.DomainOptions) (d model.Domain, err error)
 		return d, errors.Errorf(errNoLookupResults, typeA, path)
 	}
 
+	// the records of a suspended domain are the parking records, they would be replaced by the origin ones on renew
+	if b.checkPathExist(getSuspendedPath(b.Prefix, opts.Fqdn)) {
+		return d, backend.NewSuspendedError(opts.Fqdn)
+	}
+
 	if _, err = b.setRecord(path, opts, true); err != nil {
 		return d, err
 	}
 
+	if err := b.setHealthCheck(opts); err != nil {
+		return d, err
+	}
+
 	d, err = b.Get(opts)
 	if err != nil {
 		return d, err
@@ -215,6 +316,15 @@ func (b *Backend) Update(opts *model.DomainOptions) (d model.Domain, err error)
 func (b *Backend) Delete(opts *model.DomainOptions) error {
 	logrus.Debugf("delete %s record for domain options: %s", typeA, opts.String())
 
+	if err := b.deleteRecords(opts); err != nil {
+		return err
+	}
+
+	return b.setHealthCheck(&model.DomainOptions{Fqdn: opts.Fqdn})
+}
+
+// Used to delete the host and sub domain records of a domain, its health check is kept for suspend and resume
+func (b *Backend) deleteRecords(opts *model.DomainOptions) error {
 	d, err := b.Get(opts)
 	if err != nil {
 		return err
@@ -272,11 +382,22 @@ func (b *Backend) Renew(opts *model.DomainOptions) (d model.Domain, err error) {
 		return d, err
 	}
 
-	_, leaseTTL, err = b.keepaliveOnce(leaseID)
+	// an imported domain is moved to a lease of its lease time when it is renewed the first time
+	regranted, ttl, err := b.regrantLease(opts.Fqdn, leaseID)
 	if err != nil {
 		return d, err
 	}
 
+	if regranted != 0 {
+		leaseID, leaseTTL = regranted, ttl
+	} else if _, leaseTTL, err = b.keepaliveOnce(leaseID); err != nil {
+		return d, err
+	}
+
+	if err := b.resume(opts, leaseID); err != nil {
+		return d, err
+	}
+
 	kvs, err := b.lookupKeys(path)
 	if err != nil {
 		return d, err
@@ -288,6 +409,8 @@ func (b *Backend) Renew(opts *model.DomainOptions) (d model.Domain, err error) {
 
 	subs := make(map[string][]string, 0)
 	hosts := make([]string, 0)
+	weights := make(map[string]model.HostWeight)
+	regions := make(map[string]string)
 
 	for _, v := range kvs {
 		k := string(v.Key)
@@ -309,6 +432,12 @@ func (b *Backend) Renew(opts *model.DomainOptions) (d model.Domain, err error) {
 		}
 
 		hosts = append(hosts, m["host"])
+		if w, ok := toHostWeight(m); ok {
+			weights[m["host"]] = w
+		}
+		if m["region"] != "" {
+			regions[m["host"]] = m["region"]
+		}
 	}
 
 	for k := range subs {
@@ -335,11 +464,113 @@ func (b *Backend) Renew(opts *model.DomainOptions) (d model.Domain, err error) {
 	d.Fqdn = opts.Fqdn
 	d.Hosts = hosts
 	d.SubDomain = subs
-	d.Expiration = getExpiration(leaseTTL)
+	d.Expiration = b.getExpiration(leaseTTL)
+	d.State = model.StateActive
+	d.SignedOnly = b.checkPathExist(getSignedPath(b.Prefix, opts.Fqdn))
+	if len(weights) > 0 {
+		d.Weights = weights
+	}
+	if len(regions) > 0 {
+		d.Regions = regions
+	}
 
 	return d, nil
 }
 
+func (b *Backend) Suspend(opts *model.DomainOptions) error {
+	logrus.Debugf("suspend %s record for domain options: %s", typeA, opts.String())
+
+	sp := getSuspendedPath(b.Prefix, opts.Fqdn)
+	if b.checkPathExist(sp) {
+		return nil
+	}
+
+	d, err := b.Get(opts)
+	if err != nil {
+		return err
+	}
+
+	leaseID, err := b.getTokenLease(opts.Fqdn)
+	if err != nil {
+		return err
+	}
+
+	// keep the origin records aside with the token lease, so that they are restored by renew or purged with the token
+	v, err := json.Marshal(model.Domain{Hosts: d.Hosts, SubDomain: d.SubDomain, Weights: d.Weights, Regions: d.Regions})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	_, err = b.C.Put(ctx, sp, string(v), clientv3.WithLease(clientv3.LeaseID(leaseID)))
+	cancel()
+	if err != nil {
+		return errors.Wrapf(err, errSetRecordWithLease, typeSuspended, sp, leaseID)
+	}
+
+	if err := b.deleteRecords(opts); err != nil {
+		return err
+	}
+
+	if b.Parking == "" {
+		return nil
+	}
+
+	parking := &model.DomainOptions{
+		Fqdn:      opts.Fqdn,
+		Hosts:     []string{b.Parking},
+		SubDomain: make(map[string][]string, 0),
+	}
+	for prefix := range d.SubDomain {
+		parking.SubDomain[prefix] = []string{b.Parking}
+	}
+
+	return b.putRecords(parking, leaseID)
+}
+
+// SuspendExpired suspends the domains whose token lease has entered the grace period,
+// the records are deleted by etcd when the lease expires.
+func (b *Backend) SuspendExpired(dryRun bool, r *model.PurgeReport) error {
+	if b.Grace <= 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	defer cancel()
+
+	resp, err := b.C.Get(ctx, tokenPath, clientv3.WithPrefix())
+	if err != nil {
+		return errors.Wrapf(err, errLookupRecords, typeToken, tokenPath)
+	}
+
+	for _, kv := range resp.Kvs {
+		lease, err := b.getLease(kv.Lease)
+		if err != nil {
+			logrus.Error(err)
+			continue
+		}
+		if lease.TTL < 0 || lease.TTL > int64(b.Grace.Seconds()) {
+			continue
+		}
+
+		fqdn := strings.Replace(strings.TrimPrefix(string(kv.Key), tokenPath+"/"), "_", ".", -1)
+		if b.checkPathExist(getSuspendedPath(b.Prefix, fqdn)) {
+			continue
+		}
+
+		r.Expired++
+		if !dryRun {
+			if err := b.Suspend(&model.DomainOptions{Fqdn: fqdn}); err != nil {
+				r.AddFailure(fqdn, model.PurgeActionSuspend, err)
+				continue
+			}
+		}
+		r.Suspended = append(r.Suspended, fqdn)
+	}
+
+	return nil
+}
+
 func (b *Backend) SetCNAME(opts *model.DomainOptions) (model.Domain, error) {
 	return model.Domain{}, nil
 }
@@ -418,7 +649,7 @@ func (b *Backend) GetText(opts *model.DomainOptions) (d model.Domain, err error)
 	}
 
 	d.Fqdn = opts.Fqdn
-	d.Expiration = getExpiration(lease.TTL)
+	d.Expiration = b.getExpiration(lease.TTL)
 
 	return d, nil
 }
@@ -510,6 +741,158 @@ func (b *Backend) GetTokenCount() (int64, error) {
 	return resp.Count, nil
 }
 
+func (b *Backend) ListFrozen(prefix string) ([]model.Frozen, error) {
+	path := fmt.Sprintf("%s%s/%s", b.Prefix, frozenPath, prefix)
+
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	defer cancel()
+
+	resp, err := b.C.Get(ctx, path, clientv3.WithPrefix())
+	if err != nil {
+		return nil, errors.Wrapf(err, errLookupRecords, typeFrozen, path)
+	}
+
+	result := make([]model.Frozen, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		f, err := b.toFrozen(kv)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, f)
+	}
+
+	return result, nil
+}
+
+// ListDS returns the DS records of the key signing keys which are published by the rdns plugin,
+// the parent zone needs the DS records of the active keys and of the keys which are about to be active
+func (b *Backend) ListDS() ([]model.DS, error) {
+	path := fmt.Sprintf("%s%s/%s", b.Prefix, dnssecPath, strings.TrimSuffix(b.Domain, "."))
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	resp, err := b.C.Get(ctx, path)
+	if err != nil {
+		return nil, errors.Wrapf(err, errLookupRecords, typeDNSSEC, path)
+	}
+	if resp.Count <= 0 {
+		return nil, errors.Errorf(errEmptyRecord, typeDNSSEC, path)
+	}
+
+	ks := &model.DNSSECKeySet{}
+	if err := json.Unmarshal(resp.Kvs[0].Value, ks); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := make([]model.DS, 0)
+	for i := range ks.Keys {
+		k := &ks.Keys[i]
+		if !k.IsKSK() || !k.IsPublished(now) {
+			continue
+		}
+		result = append(result, k.DS(b.Domain, now))
+	}
+
+	return result, nil
+}
+
+func (b *Backend) AddFrozen(opts *model.FrozenOptions) (f model.Frozen, err error) {
+	logrus.Debugf("add frozen prefix for options: %s", opts.String())
+
+	if err := backend.ValidateLabelSyntax(opts.Prefix); err != nil {
+		return f, err
+	}
+
+	d, err := opts.GetDuration(b.FrozenTTL)
+	if err != nil {
+		return f, err
+	}
+
+	if _, err := b.claimSlugName(opts.Prefix, d); err != nil {
+		return f, err
+	}
+
+	return b.getFrozen(opts.Prefix)
+}
+
+func (b *Backend) ExtendFrozen(opts *model.FrozenOptions) (f model.Frozen, err error) {
+	logrus.Debugf("extend frozen prefix for options: %s", opts.String())
+
+	path := fmt.Sprintf("%s%s/%s", b.Prefix, frozenPath, opts.Prefix)
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	resp, err := b.C.Get(ctx, path)
+	if err != nil {
+		return f, errors.Wrapf(err, errLookupRecords, typeFrozen, path)
+	}
+	if resp.Count <= 0 {
+		return f, backend.NewNotFrozenError(opts.Prefix)
+	}
+	old := resp.Kvs[0].Lease
+
+	d, err := opts.GetDuration(b.FrozenTTL)
+	if err != nil {
+		return f, err
+	}
+
+	var remaining int64
+	if old != 0 {
+		lease, err := b.getLease(old)
+		if err != nil {
+			return f, err
+		}
+		if lease.TTL > 0 {
+			remaining = lease.TTL
+		}
+	}
+
+	// the key is moved to a new lease, the old lease of the frozen key is not shared with other keys
+	leaseID, _, err := b.grantLease(remaining + int64(d.Seconds()))
+	if err != nil {
+		return f, err
+	}
+
+	if _, err := b.C.Put(ctx, path, "", clientv3.WithLease(clientv3.LeaseID(leaseID))); err != nil {
+		return f, errors.Wrapf(err, errSetRecordWithLease, typeFrozen, path, leaseID)
+	}
+
+	if old != 0 {
+		if _, err := b.C.Revoke(ctx, clientv3.LeaseID(old)); err != nil {
+			logrus.Debugf("failed to revoke lease %d: %v", old, err)
+		}
+	}
+
+	return b.getFrozen(opts.Prefix)
+}
+
+func (b *Backend) ReleaseFrozen(prefix string) error {
+	logrus.Debugf("release frozen prefix: %s", prefix)
+
+	if !b.checkSlugName(prefix) {
+		return backend.NewNotFrozenError(prefix)
+	}
+
+	// the prefix of an active or suspended domain can not be released, otherwise it can be used twice
+	if b.checkPathExist(getTokenPath(fmt.Sprintf("%s.%s", prefix, b.Domain))) {
+		return backend.NewNameInUseError(prefix)
+	}
+
+	path := fmt.Sprintf("%s%s/%s", b.Prefix, frozenPath, prefix)
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	if _, err := b.C.Delete(ctx, path); err != nil {
+		return errors.Wrapf(err, errDeleteRecord, typeFrozen, path)
+	}
+
+	return nil
+}
+
 func (b *Backend) MigrateFrozen(opts *model.MigrateFrozen) error {
 	path := fmt.Sprintf("%s%s/%s", b.Prefix, frozenPath, opts.Path)
 
@@ -529,7 +912,7 @@ func (b *Backend) MigrateFrozen(opts *model.MigrateFrozen) error {
 }
 
 func (b *Backend) MigrateToken(opts *model.MigrateToken) error {
-	path := getTokenPath(strings.Split(opts.Path, "/")[2])
+	path := getTokenPath(opts.Fqdn())
 
 	id, _, err := b.grantLease(opts.Expiration.Unix() - time.Now().Unix())
 	if err != nil {
@@ -561,6 +944,8 @@ func (b *Backend) MigrateRecord(opts *model.MigrateRecord) error {
 			Fqdn:      opts.Fqdn,
 			Hosts:     opts.Hosts,
 			SubDomain: opts.SubDomain,
+			Weights:   opts.Weights,
+			Regions:   opts.Regions,
 		}
 
 		path := getPath(b.Prefix, dopts.Fqdn)
@@ -570,6 +955,10 @@ func (b *Backend) MigrateRecord(opts *model.MigrateRecord) error {
 			return err
 		}
 
+		if err := b.setSignedOnly(dopts.Fqdn, opts.SignedOnly, leaseID); err != nil {
+			return err
+		}
+
 		// make sure domain record is exist, although no hosts value
 		ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
 		defer cancel()
@@ -585,7 +974,7 @@ func (b *Backend) MigrateRecord(opts *model.MigrateRecord) error {
 		}
 
 		subs := make(map[string][]string, 0)
-		hosts := make([]string, 0)
+		hosts := make(map[string]string)
 
 		for _, v := range kvs {
 			k := string(v.Key)
@@ -606,7 +995,7 @@ func (b *Backend) MigrateRecord(opts *model.MigrateRecord) error {
 				continue
 			}
 
-			hosts = append(hosts, m["host"])
+			hosts[m["host"]] = string(v.Value)
 		}
 
 		for k := range subs {
@@ -630,7 +1019,7 @@ func (b *Backend) MigrateRecord(opts *model.MigrateRecord) error {
 			subs[k] = ss
 		}
 
-		if err := b.syncRecords(dopts.Hosts, hosts, path, clientv3.LeaseID(leaseID)); err != nil {
+		if err := b.syncRecords(dopts.Hosts, hosts, hostValues(dopts.Hosts, model.HostWeights(dopts.Hosts, dopts.Weights), dopts.Regions), path, clientv3.LeaseID(leaseID)); err != nil {
 			return errors.Wrapf(err, errSyncRecords, typeA, path)
 		}
 
@@ -648,6 +1037,12 @@ func (b *Backend) setRecord(path string, opts *model.DomainOptions, exist bool)
 		return d, err
 	}
 
+	if opts.SignedOnly != nil {
+		if err := b.setSignedOnly(opts.Fqdn, *opts.SignedOnly, leaseID); err != nil {
+			return d, err
+		}
+	}
+
 	if !exist {
 		// make sure domain record is exist, although no hosts value
 		ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
@@ -665,7 +1060,7 @@ func (b *Backend) setRecord(path string, opts *model.DomainOptions, exist bool)
 	}
 
 	subs := make(map[string][]string, 0)
-	hosts := make([]string, 0)
+	hosts := make(map[string]string)
 
 	for _, v := range kvs {
 		k := string(v.Key)
@@ -686,7 +1081,7 @@ func (b *Backend) setRecord(path string, opts *model.DomainOptions, exist bool)
 			continue
 		}
 
-		hosts = append(hosts, m["host"])
+		hosts[m["host"]] = string(v.Value)
 	}
 
 	for k := range subs {
@@ -710,7 +1105,8 @@ func (b *Backend) setRecord(path string, opts *model.DomainOptions, exist bool)
 		subs[k] = ss
 	}
 
-	if err := b.syncRecords(opts.Hosts, hosts, path, clientv3.LeaseID(leaseID)); err != nil {
+	weights := model.HostWeights(opts.Hosts, opts.Weights)
+	if err := b.syncRecords(opts.Hosts, hosts, hostValues(opts.Hosts, weights, opts.Regions), path, clientv3.LeaseID(leaseID)); err != nil {
 		return d, errors.Wrapf(err, errSyncRecords, typeA, path)
 	}
 
@@ -721,11 +1117,119 @@ func (b *Backend) setRecord(path string, opts *model.DomainOptions, exist bool)
 	d.Fqdn = opts.Fqdn
 	d.Hosts = opts.Hosts
 	d.SubDomain = opts.SubDomain
-	d.Expiration = getExpiration(leaseTTL)
+	d.Weights = weights
+	d.Regions = model.HostRegions(opts.Hosts, opts.Regions)
+	d.Expiration = b.getExpiration(leaseTTL)
+	d.State = model.StateActive
+	d.SignedOnly = b.checkPathExist(getSignedPath(b.Prefix, opts.Fqdn))
 
 	return d, err
 }
 
+// Used to get the origin records of a suspended domain, returns false if the domain is not suspended
+func (b *Backend) getSuspended(opts *model.DomainOptions) (d model.Domain, ok bool, err error) {
+	sp := getSuspendedPath(b.Prefix, opts.Fqdn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	resp, err := b.C.Get(ctx, sp)
+	if err != nil {
+		return d, false, errors.Wrapf(err, errLookupRecords, typeSuspended, sp)
+	}
+	if resp.Count <= 0 {
+		return d, false, nil
+	}
+
+	if err := json.Unmarshal(resp.Kvs[0].Value, &d); err != nil {
+		return d, true, err
+	}
+
+	lease, err := b.getLease(resp.Kvs[0].Lease)
+	if err != nil {
+		return d, true, err
+	}
+
+	d.Fqdn = opts.Fqdn
+	d.Expiration = b.getExpiration(lease.TTL)
+	d.State = model.StateSuspended
+	d.Purge = getExpiration(lease.TTL)
+
+	return d, true, nil
+}
+
+// Used to replace the parking records of a suspended domain with its origin records
+func (b *Backend) resume(opts *model.DomainOptions, leaseID int64) error {
+	d, ok, err := b.getSuspended(opts)
+	if err != nil || !ok {
+		return err
+	}
+
+	if err := b.deleteRecords(opts); err != nil {
+		return err
+	}
+
+	if err := b.putRecords(&model.DomainOptions{Fqdn: opts.Fqdn, Hosts: d.Hosts, SubDomain: d.SubDomain, Weights: d.Weights, Regions: d.Regions}, leaseID); err != nil {
+		return err
+	}
+
+	sp := getSuspendedPath(b.Prefix, opts.Fqdn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	if _, err := b.C.Delete(ctx, sp); err != nil {
+		return errors.Wrapf(err, errDeleteRecord, typeSuspended, sp)
+	}
+
+	return nil
+}
+
+// Used to put the domain record, host records and sub domain records with the lease
+func (b *Backend) putRecords(opts *model.DomainOptions, leaseID int64) error {
+	path := getPath(b.Prefix, opts.Fqdn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	_, err := b.C.Put(ctx, path, formatValue(""), clientv3.WithLease(clientv3.LeaseID(leaseID)))
+	cancel()
+	if err != nil {
+		return errors.Wrapf(err, errSetRecordWithLease, typeA, path, leaseID)
+	}
+
+	if err := b.syncRecords(opts.Hosts, nil, hostValues(opts.Hosts, model.HostWeights(opts.Hosts, opts.Weights), opts.Regions), path, clientv3.LeaseID(leaseID)); err != nil {
+		return errors.Wrapf(err, errSyncRecords, typeA, path)
+	}
+
+	if err := b.setSubRecords(opts, nil, leaseID); err != nil {
+		return errors.Wrapf(err, errSetSubRecordsWithLease, typeA, opts.Fqdn, leaseID)
+	}
+
+	return nil
+}
+
+// Used to get the lease of the token of a domain
+func (b *Backend) getTokenLease(fqdn string) (int64, error) {
+	path := getTokenPath(fqdn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	resp, err := b.C.Get(ctx, path)
+	if err != nil {
+		return 0, errors.Wrapf(err, errEmptyRecord, typeToken, path)
+	}
+	if resp.Count <= 0 {
+		return 0, errors.Errorf(errEmptyRecord, typeToken, path)
+	}
+
+	return resp.Kvs[0].Lease, nil
+}
+
+// Used to get the expiration of a domain, leases are granted with the grace period
+func (b *Backend) getExpiration(ttl int64) *time.Time {
+	return getExpiration(ttl - int64(b.Grace.Seconds()))
+}
+
 func (b *Backend) setSubRecords(opts *model.DomainOptions, origins map[string][]string, leaseID int64) error {
 	for prefix := range origins {
 		if _, ok := opts.SubDomain[prefix]; !ok {
@@ -747,16 +1251,16 @@ func (b *Backend) setSubRecords(opts *model.DomainOptions, origins map[string][]
 			return err
 		}
 
-		hosts := make([]string, 0)
+		hosts := make(map[string]string)
 		for _, v := range kvs {
 			m, err := unmarshalToMap(v.Value)
 			if err != nil {
 				return err
 			}
-			hosts = append(hosts, m["host"])
+			hosts[m["host"]] = string(v.Value)
 		}
 
-		if err := b.syncRecords(values, hosts, path, clientv3.LeaseID(leaseID)); err != nil {
+		if err := b.syncRecords(values, hosts, nil, path, clientv3.LeaseID(leaseID)); err != nil {
 			return errors.Wrapf(err, errSyncSubRecords, typeA, path)
 		}
 	}
@@ -764,11 +1268,12 @@ func (b *Backend) setSubRecords(opts *model.DomainOptions, origins map[string][]
 	return nil
 }
 
-func (b *Backend) syncRecords(new, old []string, path string, leaseID clientv3.LeaseID) error {
+// Used to put the host records which are new or changed and delete the ones which are gone, old holds the values
+// of the host records by their hosts and values the ones of the weighted or regional hosts
+func (b *Backend) syncRecords(new []string, old map[string]string, values map[string]string, path string, leaseID clientv3.LeaseID) error {
 	left := sliceToMap(new)
-	right := sliceToMap(old)
 
-	for r := range right {
+	for r := range old {
 		if _, ok := left[r]; !ok {
 			key := fmt.Sprintf("%s/%s", path, formatKey(r))
 			ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
@@ -781,10 +1286,14 @@ func (b *Backend) syncRecords(new, old []string, path string, leaseID clientv3.L
 	}
 
 	for l := range left {
-		if _, ok := right[l]; !ok {
+		value, ok := values[l]
+		if !ok {
+			value = formatValue(l)
+		}
+		if v, ok := old[l]; !ok || v != value {
 			key := fmt.Sprintf("%s/%s", path, formatKey(l))
 			ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
-			_, err := b.C.Put(ctx, key, formatValue(l), clientv3.WithLease(leaseID))
+			_, err := b.C.Put(ctx, key, value, clientv3.WithLease(leaseID))
 			cancel()
 			if err != nil {
 				return err
@@ -795,6 +1304,40 @@ func (b *Backend) syncRecords(new, old []string, path string, leaseID clientv3.L
 	return nil
 }
 
+// RequiresSignature returns whether a domain only accepts signed requests.
+func (b *Backend) RequiresSignature(fqdn string) (bool, error) {
+	path := getSignedPath(b.Prefix, fqdn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	resp, err := b.C.Get(ctx, path, clientv3.WithCountOnly())
+	if err != nil {
+		return false, errors.Wrapf(err, errLookupRecords, typeSigned, path)
+	}
+	return resp.Count > 0, nil
+}
+
+// Used to mark a domain which only accepts signed requests, the marker shares the lease of the token
+func (b *Backend) setSignedOnly(fqdn string, signed bool, leaseID int64) error {
+	path := getSignedPath(b.Prefix, fqdn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	if !signed {
+		if _, err := b.C.Delete(ctx, path); err != nil {
+			return errors.Wrapf(err, errDeleteRecord, typeSigned, path)
+		}
+		return nil
+	}
+
+	if _, err := b.C.Put(ctx, path, "1", clientv3.WithLease(clientv3.LeaseID(leaseID))); err != nil {
+		return errors.Wrapf(err, errSetRecordWithLease, typeSigned, path, leaseID)
+	}
+	return nil
+}
+
 func (b *Backend) setToken(opts *model.DomainOptions, exist bool) (int64, int64, error) {
 	logrus.Debugf("set %s for fqdn: %s", typeToken, opts.String())
 
@@ -828,7 +1371,14 @@ func (b *Backend) setToken(opts *model.DomainOptions, exist bool) (int64, int64,
 	} else {
 		token = util.RandStringWithAll(tokenLength)
 
-		id, ttl, err := b.grantLease(int64(b.LeaseTime.Seconds()))
+		// the domain may request its own lease time, renewing the lease keeps its ttl
+		leaseTime, err := backend.LeaseTime(opts, b.LeaseTime)
+		if err != nil {
+			return 0, -1, err
+		}
+
+		// the lease holds the records during the grace period after the domain is expired
+		id, ttl, err := b.grantLease(int64((leaseTime + b.Grace).Seconds()))
 		if err != nil {
 			return 0, -1, err
 		}
@@ -883,6 +1433,48 @@ func (b *Backend) lockSlugName(fqdn, slug string, exist bool) error {
 	return nil
 }
 
+// Used to lock a slug name for the ttl only if it is not locked yet
+func (b *Backend) claimSlugName(slug string, ttl time.Duration) (int64, error) {
+	logrus.Debugf("claim slug name: %s", slug)
+
+	path := fmt.Sprintf("%s%s/%s", b.Prefix, frozenPath, slug)
+
+	leaseID, _, err := b.grantLease(int64(ttl.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	resp, err := b.C.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(path), "=", 0)).
+		Then(clientv3.OpPut(path, "", clientv3.WithLease(clientv3.LeaseID(leaseID)))).
+		Commit()
+	if err != nil {
+		b.releaseClaim(leaseID)
+		return 0, errors.Wrapf(err, errSetRecordWithLease, typeFrozen, path, leaseID)
+	}
+
+	if !resp.Succeeded {
+		b.releaseClaim(leaseID)
+		return 0, backend.NewNameTakenError(slug)
+	}
+
+	return leaseID, nil
+}
+
+// Used to release a claimed slug name by revoking the lease of its claim, the claim expires with its lease
+// when it can not be revoked
+func (b *Backend) releaseClaim(leaseID int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	if _, err := b.C.Revoke(ctx, clientv3.LeaseID(leaseID)); err != nil {
+		logrus.Debugf("failed to revoke lease %d: %v", leaseID, err)
+	}
+}
+
 func (b *Backend) lookupKeys(path string) ([]*mvccpb.KeyValue, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
 	defer cancel()
@@ -923,6 +1515,8 @@ func (b *Backend) getLease(id int64) (*clientv3.LeaseTimeToLiveResponse, error)
 	return lease, nil
 }
 
+// Used to grant a lease which is marked as a lease of rdns by a key attached to it,
+// so that the check only revokes the leases of rdns
 func (b *Backend) grantLease(ttl int64) (int64, int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
 	defer cancel()
@@ -932,6 +1526,14 @@ func (b *Backend) grantLease(ttl int64) (int64, int64, error) {
 		return 0, -1, errors.Errorf(errGrantLease)
 	}
 
+	path := getLeasePath(b.Prefix, int64(lease.ID))
+	if _, err := b.C.Put(ctx, path, "", clientv3.WithLease(lease.ID)); err != nil {
+		if _, err := b.C.Revoke(ctx, lease.ID); err != nil {
+			logrus.Debugf("failed to revoke lease %d: %v", lease.ID, err)
+		}
+		return 0, -1, errors.Wrapf(err, errSetRecordWithLease, typeLease, path, lease.ID)
+	}
+
 	return int64(lease.ID), lease.TTL, nil
 }
 
@@ -947,6 +1549,44 @@ func (b *Backend) keepaliveOnce(id int64) (int64, int64, error) {
 	return int64(keepalive.ID), keepalive.TTL, nil
 }
 
+// Used to get a frozen prefix with its expiration
+func (b *Backend) getFrozen(prefix string) (f model.Frozen, err error) {
+	path := fmt.Sprintf("%s%s/%s", b.Prefix, frozenPath, prefix)
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	resp, err := b.C.Get(ctx, path)
+	if err != nil {
+		return f, errors.Wrapf(err, errLookupRecords, typeFrozen, path)
+	}
+	if resp.Count <= 0 {
+		return f, backend.NewNotFrozenError(prefix)
+	}
+
+	return b.toFrozen(resp.Kvs[0])
+}
+
+// Used to convert a frozen key, the prefix expires with the lease of the key
+// e.g. /rdnsv3/frozenv3/sample => sample
+func (b *Backend) toFrozen(kv *mvccpb.KeyValue) (f model.Frozen, err error) {
+	f.Prefix = strings.TrimPrefix(string(kv.Key), fmt.Sprintf("%s%s/", b.Prefix, frozenPath))
+
+	if kv.Lease == 0 {
+		return f, nil
+	}
+
+	lease, err := b.getLease(kv.Lease)
+	if err != nil {
+		return f, err
+	}
+
+	e := time.Now().Add(time.Duration(lease.TTL) * time.Second)
+	f.Expiration = &e
+
+	return f, nil
+}
+
 // Used to check whether fqdn can be used.
 // e.g. sample.lb.rancher.cloud => /frozenv3/sample
 // e.g. if /frozenv3/sample is exist that fqdn can not be used
@@ -1000,6 +1640,24 @@ func getTokenPath(fqdn string) string {
 	return fmt.Sprintf("%s/%s", tokenPath, formatKey(fqdn))
 }
 
+// Used to get a suspended path as etcd preferred
+// e.g. sample.lb.rancher.cloud => /rdnsv3/suspendedv3/sample_lb_rancher_cloud
+func getSuspendedPath(prefix, fqdn string) string {
+	return fmt.Sprintf("%s%s/%s", prefix, suspendedPath, formatKey(fqdn))
+}
+
+// Used to get a signed path as etcd preferred
+// e.g. sample.lb.rancher.cloud => /rdnsv3/signedv3/sample_lb_rancher_cloud
+func getSignedPath(prefix, fqdn string) string {
+	return fmt.Sprintf("%s%s/%s", prefix, signedPath, formatKey(fqdn))
+}
+
+// Used to get the path of the marker of a lease
+// e.g. 7587841345342371853 => /rdnsv3/leasev3/694d6d806127780d
+func getLeasePath(prefix string, id int64) string {
+	return fmt.Sprintf("%s%s/%x", prefix, leasePath, id)
+}
+
 // Used to format a key as etcd preferred
 // e.g. 1.1.1.1 => 1_1_1_1
 // e.g. sample.lb.rancher.cloud => sample_lb_rancher_cloud
@@ -1013,6 +1671,35 @@ func formatValue(value string) string {
 	return fmt.Sprintf("{\"host\":\"%s\"}", value)
 }
 
+// Used to format a A value of a weighted or regional host as dns preferred
+// e.g. 1.1.1.1 => {"host":"1.1.1.1","priority":10,"weight":1,"region":"eu"}
+func formatHostValue(value string, w *model.HostWeight, region string) string {
+	v := fmt.Sprintf("\"host\":\"%s\"", value)
+	if w != nil {
+		v += fmt.Sprintf(",\"priority\":%d,\"weight\":%d", w.Priority, w.Weight)
+	}
+	if region != "" {
+		v += fmt.Sprintf(",\"region\":\"%s\"", region)
+	}
+	return "{" + v + "}"
+}
+
+// Used to get the values of the weighted or regional hosts of a domain, the other hosts take the plain values
+func hostValues(hosts []string, weights map[string]model.HostWeight, regions map[string]string) map[string]string {
+	values := make(map[string]string)
+	for _, h := range hosts {
+		var weight *model.HostWeight
+		if w, ok := weights[h]; ok {
+			weight = &w
+		}
+		if weight == nil && regions[h] == "" {
+			continue
+		}
+		values[h] = formatHostValue(h, weight, regions[h])
+	}
+	return values
+}
+
 // Used to format a txt value as dns preferred
 // e.g. abc => {"text": "abc"}
 func formatTextValue(value string) string {
@@ -1050,10 +1737,37 @@ func getExpiration(ttl int64) *time.Time {
 	return &e
 }
 
+// Used to unmarshal a value to a map of strings, the numbers such as the weight of a host are kept as they are
 func unmarshalToMap(b []byte) (map[string]string, error) {
-	var v map[string]string
-	err := json.Unmarshal(b, &v)
-	return v, err
+	var v map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]string, len(v))
+	for k, i := range v {
+		switch i := i.(type) {
+		case nil:
+			m[k] = ""
+		case string:
+			m[k] = i
+		default:
+			m[k] = fmt.Sprint(i)
+		}
+	}
+	return m, nil
+}
+
+// Used to get the weight of a host from its value, returns false when the host is not weighted
+func toHostWeight(m map[string]string) (model.HostWeight, bool) {
+	if _, ok := m["priority"]; !ok {
+		return model.HostWeight{}, false
+	}
+	w, _ := strconv.Atoi(m["weight"])
+	p, _ := strconv.Atoi(m["priority"])
+	return model.HostWeight{Weight: w, Priority: p}, true
 }
 
 func sliceToMap(ss []string) map[string]bool {
@@ -0,0 +1,380 @@
+package etcdv3
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancher/rdns-server/backend"
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Export emits every domain with its records and token and every frozen prefix, a deleted domain whose token
+// is not expired yet is skipped. A domain whose records can not be read is skipped as well, the export fails with
+// the skipped domains after the other entries are emitted.
+func (b *Backend) Export(emit func(*model.ExportEntry) error) error {
+	tokens, err := b.listKVs(tokenPath + "/")
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(tokens))
+	for k := range tokens {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	skipped := make([]string, 0)
+	for _, k := range keys {
+		fqdn := strings.Replace(strings.TrimPrefix(k, tokenPath+"/"), "_", ".", -1)
+
+		if !b.checkPathExist(getPath(b.Prefix, fqdn)) && !b.checkPathExist(getSuspendedPath(b.Prefix, fqdn)) {
+			logrus.Debugf("skip exporting deleted domain %s", fqdn)
+			continue
+		}
+
+		e, err := b.exportDomain(fqdn, tokens[k])
+		if err != nil {
+			logrus.Warnf("failed to export domain %s: %v", fqdn, err)
+			skipped = append(skipped, fqdn)
+			continue
+		}
+
+		if err := emit(e); err != nil {
+			return err
+		}
+	}
+
+	frozen, err := b.ListFrozen("")
+	if err != nil {
+		return err
+	}
+	for _, f := range frozen {
+		if err := emit(&model.ExportEntry{Kind: model.ExportKindFrozen, Prefix: f.Prefix, Expiration: f.Expiration}); err != nil {
+			return err
+		}
+	}
+
+	if len(skipped) > 0 {
+		return errors.Errorf(errExportDomains, len(skipped), strings.Join(skipped, ","))
+	}
+
+	return nil
+}
+
+// Import creates or updates a domain or frozen prefix of an export, records which are not in the entry are kept.
+// The lease of an existing token is kept, a new token is granted a lease which expires with the imported domain.
+func (b *Backend) Import(e *model.ExportEntry) error {
+	switch e.Kind {
+	case model.ExportKindDomain:
+		return b.importDomain(e)
+	case model.ExportKindFrozen:
+		return b.importFrozen(e)
+	}
+	return errors.Errorf(errUnknownExportKind, e.Kind)
+}
+
+// Used to read a domain with its texts, the lease time is only exported when it is not the default one
+func (b *Backend) exportDomain(fqdn string, token *mvccpb.KeyValue) (*model.ExportEntry, error) {
+	opts := &model.DomainOptions{Fqdn: fqdn}
+
+	d, err := b.Get(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &model.ExportEntry{
+		Kind:       model.ExportKindDomain,
+		Fqdn:       fqdn,
+		Hosts:      d.Hosts,
+		SubDomain:  d.SubDomain,
+		Token:      string(token.Value),
+		State:      d.State,
+		Expiration: d.Expiration,
+
+		HealthCheck: d.HealthCheck,
+		Weights:     d.Weights,
+		Regions:     d.Regions,
+		SignedOnly:  d.SignedOnly,
+	}
+	if len(e.SubDomain) == 0 {
+		e.SubDomain = nil
+	}
+
+	l, err := b.getLeaseTime(fqdn, token.Lease)
+	if err != nil {
+		return nil, err
+	}
+	if l != b.LeaseTime {
+		e.LeaseTime = l.String()
+	}
+
+	kvs, err := b.listKVs(getPath(b.Prefix, fqdn) + "/")
+	if err != nil {
+		return nil, err
+	}
+	for k, kv := range kvs {
+		m, err := unmarshalToMap(kv.Value)
+		if err != nil {
+			continue
+		}
+		if text, ok := m["text"]; ok {
+			if e.Texts == nil {
+				e.Texts = make(map[string]string)
+			}
+			e.Texts[convertToDomain(strings.TrimPrefix(k, b.Prefix))] = text
+		}
+	}
+
+	return e, nil
+}
+
+func (b *Backend) importDomain(e *model.ExportEntry) error {
+	logrus.Debugf("import domain: %s", e.Fqdn)
+
+	if e.CNAME != "" {
+		return errors.Errorf(errNotSupportCNAME, "CNAME", e.Fqdn)
+	}
+
+	opts := &model.DomainOptions{
+		Fqdn:      e.Fqdn,
+		Hosts:     e.Hosts,
+		SubDomain: e.SubDomain,
+		LeaseTime: e.LeaseTime,
+	}
+
+	leaseID, err := b.importToken(opts, e.Token, *e.Expiration)
+	if err != nil {
+		return err
+	}
+
+	// the records of a suspended domain are restored first, the entry is suspended again after its records are set
+	if err := b.resume(opts, leaseID); err != nil {
+		return err
+	}
+
+	prefix := strings.Split(e.Fqdn, ".")[0]
+	if !b.checkSlugName(prefix) {
+		if err := b.lockSlugName(e.Fqdn, prefix, false); err != nil {
+			return err
+		}
+	}
+
+	if err := b.MigrateRecord(&model.MigrateRecord{Fqdn: e.Fqdn, Hosts: e.Hosts, SubDomain: e.SubDomain, Weights: e.Weights, Regions: e.Regions, SignedOnly: e.SignedOnly}); err != nil {
+		return err
+	}
+
+	for name, text := range e.Texts {
+		if _, err := b.SetText(&model.DomainOptions{Fqdn: name, Text: text}); err != nil {
+			return err
+		}
+	}
+
+	if e.HealthCheck != nil {
+		opts.HealthCheck = e.HealthCheck
+		if err := b.setHealthCheck(opts); err != nil {
+			return err
+		}
+	}
+
+	if e.State == model.StateSuspended {
+		return b.Suspend(opts)
+	}
+
+	return nil
+}
+
+// Used to put the token of an imported domain, returns the lease of the token.
+// The ttl of an etcd lease is restored when it is renewed, so the lease time of a lease which is granted
+// for the rest of the imported expiration is kept aside until the domain is renewed the first time
+func (b *Backend) importToken(opts *model.DomainOptions, token string, expiration time.Time) (int64, error) {
+	path := getTokenPath(opts.Fqdn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	resp, err := b.C.Get(ctx, path)
+	cancel()
+	if err != nil {
+		return 0, errors.Wrapf(err, errLookupRecords, typeToken, path)
+	}
+
+	var leaseID int64
+	if resp.Count > 0 {
+		leaseID = resp.Kvs[0].Lease
+	} else {
+		leaseTime, err := backend.LeaseTime(opts, b.LeaseTime)
+		if err != nil {
+			return 0, err
+		}
+
+		ttl := int64((time.Until(expiration) + b.Grace).Seconds())
+		if ttl <= 0 {
+			return 0, errors.Errorf(errExpiredDomain, opts.Fqdn)
+		}
+
+		if leaseID, _, err = b.grantLease(ttl); err != nil {
+			return 0, err
+		}
+
+		if ttl != int64((leaseTime + b.Grace).Seconds()) {
+			rp := getRenewPath(b.Prefix, opts.Fqdn)
+
+			ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+			_, err := b.C.Put(ctx, rp, leaseTime.String(), clientv3.WithLease(clientv3.LeaseID(leaseID)))
+			cancel()
+			if err != nil {
+				return 0, errors.Wrapf(err, errSetRecordWithLease, typeRenew, rp, leaseID)
+			}
+		}
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	if _, err := b.C.Put(ctx, path, token, clientv3.WithLease(clientv3.LeaseID(leaseID))); err != nil {
+		return 0, errors.Wrapf(err, errSetRecordWithLease, typeToken, path, leaseID)
+	}
+
+	return leaseID, nil
+}
+
+// Used to move the keys of an imported domain to a lease of its lease time, returns 0 if the domain is not imported
+func (b *Backend) regrantLease(fqdn string, leaseID int64) (int64, int64, error) {
+	rp := getRenewPath(b.Prefix, fqdn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	resp, err := b.C.Get(ctx, rp)
+	cancel()
+	if err != nil {
+		return 0, -1, errors.Wrapf(err, errLookupRecords, typeRenew, rp)
+	}
+	if resp.Count <= 0 {
+		return 0, -1, nil
+	}
+
+	leaseTime, err := time.ParseDuration(string(resp.Kvs[0].Value))
+	if err != nil {
+		return 0, -1, errors.Wrapf(err, errLookupRecords, typeRenew, rp)
+	}
+
+	id, ttl, err := b.grantLease(int64((leaseTime + b.Grace).Seconds()))
+	if err != nil {
+		return 0, -1, err
+	}
+
+	lease, err := b.getAttachedKeys(clientv3.LeaseID(leaseID))
+	if err != nil {
+		return 0, -1, err
+	}
+
+	// the renew key and the marker of the old lease are not moved
+	for _, k := range lease.Keys {
+		if string(k) == rp || string(k) == getLeasePath(b.Prefix, leaseID) {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+		resp, err := b.C.Get(ctx, string(k))
+		cancel()
+		if err != nil {
+			return 0, -1, errors.Wrapf(err, errLookupRecords, typeKey, string(k))
+		}
+		if resp.Count <= 0 {
+			continue
+		}
+
+		if err := b.moveKV(resp.Kvs[0], id); err != nil {
+			return 0, -1, err
+		}
+	}
+
+	// the renew key is deleted with the old lease
+	ctx, cancel = context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	if _, err := b.C.Revoke(ctx, clientv3.LeaseID(leaseID)); err != nil {
+		logrus.Debugf("failed to revoke lease %d: %v", leaseID, err)
+	}
+
+	return id, ttl, nil
+}
+
+// Used to get the lease time of a domain, which is kept aside for an imported domain which is not renewed yet
+func (b *Backend) getLeaseTime(fqdn string, leaseID int64) (time.Duration, error) {
+	rp := getRenewPath(b.Prefix, fqdn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	resp, err := b.C.Get(ctx, rp)
+	cancel()
+	if err != nil {
+		return 0, errors.Wrapf(err, errLookupRecords, typeRenew, rp)
+	}
+	if resp.Count > 0 {
+		if d, err := time.ParseDuration(string(resp.Kvs[0].Value)); err == nil {
+			return d, nil
+		}
+	}
+
+	lease, err := b.getLease(leaseID)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(lease.GrantedTTL)*time.Second - b.Grace, nil
+}
+
+// A frozen prefix is moved to a new lease which expires with the imported one, an expired prefix is skipped
+func (b *Backend) importFrozen(e *model.ExportEntry) error {
+	logrus.Debugf("import frozen prefix: %s", e.Prefix)
+
+	ttl := int64(time.Until(*e.Expiration).Seconds())
+	if ttl <= 0 {
+		return nil
+	}
+
+	path := fmt.Sprintf("%s%s/%s", b.Prefix, frozenPath, e.Prefix)
+
+	leaseID, _, err := b.grantLease(ttl)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	resp, err := b.C.Put(ctx, path, "", clientv3.WithLease(clientv3.LeaseID(leaseID)), clientv3.WithPrevKV())
+	if err != nil {
+		return errors.Wrapf(err, errSetRecordWithLease, typeFrozen, path, leaseID)
+	}
+
+	if resp.PrevKv != nil && resp.PrevKv.Lease != 0 {
+		if _, err := b.C.Revoke(ctx, clientv3.LeaseID(resp.PrevKv.Lease)); err != nil {
+			logrus.Debugf("failed to revoke lease %d: %v", resp.PrevKv.Lease, err)
+		}
+	}
+
+	return nil
+}
+
+// Used to convert a path back to a domain
+// e.g. /cloud/rancher/lb/sample/_acme-challenge => _acme-challenge.sample.lb.rancher.cloud
+func convertToDomain(path string) string {
+	ss := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	last := len(ss) - 1
+	for i := 0; i < len(ss)/2; i++ {
+		ss[i], ss[last-i] = ss[last-i], ss[i]
+	}
+	return strings.Join(ss, ".")
+}
+
+// Used to get a renew path as etcd preferred
+// e.g. sample.lb.rancher.cloud => /rdnsv3/renewv3/sample_lb_rancher_cloud
+func getRenewPath(prefix, fqdn string) string {
+	return fmt.Sprintf("%s%s/%s", prefix, renewPath, formatKey(fqdn))
+}
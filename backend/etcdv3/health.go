@@ -0,0 +1,159 @@
+package etcdv3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ListHealthStates returns the health checks of every domain with the health of their hosts.
+func (b *Backend) ListHealthStates() ([]*model.HealthState, error) {
+	path := fmt.Sprintf("%s%s/", b.Prefix, healthPath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	defer cancel()
+
+	resp, err := b.C.Get(ctx, path, clientv3.WithPrefix())
+	if err != nil {
+		return nil, errors.Wrapf(err, errLookupRecords, typeHealth, path)
+	}
+
+	result := make([]*model.HealthState, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		s := &model.HealthState{}
+		if err := json.Unmarshal(kv.Value, s); err != nil {
+			logrus.Warnf("skip invalid health check %s: %v", string(kv.Key), err)
+			continue
+		}
+		result = append(result, s)
+	}
+
+	return result, nil
+}
+
+// SetHealthState keeps the health of the hosts, which the rdns plugin drops from the answers when they are unhealthy.
+// The health is merged into the current health check of the domain, which may be changed since it is listed,
+// and is skipped when the health check is changed again meanwhile.
+func (b *Backend) SetHealthState(s *model.HealthState) error {
+	cur, kv, err := b.getHealthState(s.Fqdn)
+	if err != nil || cur == nil {
+		return err
+	}
+
+	merged := model.NewHealthState(cur.Fqdn, &cur.Check, cur.HostNames(), s)
+	if reflect.DeepEqual(merged, cur) {
+		return nil
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+
+	path := string(kv.Key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	resp, err := b.C.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(path), "=", kv.ModRevision)).
+		Then(clientv3.OpPut(path, string(data), clientv3.WithLease(clientv3.LeaseID(kv.Lease)))).
+		Commit()
+	if err != nil {
+		return errors.Wrapf(err, errSetRecordWithLease, typeHealth, path, kv.Lease)
+	}
+	if !resp.Succeeded {
+		logrus.Debugf("skip the health of %s, its health check is changed", s.Fqdn)
+	}
+
+	return nil
+}
+
+// Used to set or delete the health check of a domain, the hosts which are still in the domain keep their health
+func (b *Backend) setHealthCheck(opts *model.DomainOptions) error {
+	path := getHealthPath(b.Prefix, opts.Fqdn)
+
+	if opts.HealthCheck == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+		defer cancel()
+
+		if _, err := b.C.Delete(ctx, path); err != nil {
+			return errors.Wrapf(err, errDeleteRecord, typeHealth, path)
+		}
+		return nil
+	}
+
+	old, _, err := b.getHealthState(opts.Fqdn)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(model.NewHealthState(opts.Fqdn, opts.HealthCheck, opts.Hosts, old))
+	if err != nil {
+		return err
+	}
+
+	leaseID, err := b.getTokenLease(opts.Fqdn)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	if _, err := b.C.Put(ctx, path, string(data), clientv3.WithLease(clientv3.LeaseID(leaseID))); err != nil {
+		return errors.Wrapf(err, errSetRecordWithLease, typeHealth, path, leaseID)
+	}
+
+	return nil
+}
+
+// Used to add the health check of a domain and the health of its hosts
+func (b *Backend) setHealth(d *model.Domain) error {
+	s, _, err := b.getHealthState(d.Fqdn)
+	if err != nil || s == nil {
+		return err
+	}
+
+	d.HealthCheck = &s.Check
+	d.Health = s.Hosts
+
+	return nil
+}
+
+// Used to get the health check of a domain, returns nil when the domain has none
+func (b *Backend) getHealthState(fqdn string) (*model.HealthState, *mvccpb.KeyValue, error) {
+	path := getHealthPath(b.Prefix, fqdn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	resp, err := b.C.Get(ctx, path)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, errLookupRecords, typeHealth, path)
+	}
+	if resp.Count <= 0 {
+		return nil, nil, nil
+	}
+
+	s := &model.HealthState{}
+	if err := json.Unmarshal(resp.Kvs[0].Value, s); err != nil {
+		return nil, nil, err
+	}
+
+	return s, resp.Kvs[0], nil
+}
+
+// Used to get a health path as etcd preferred
+// e.g. sample.lb.rancher.cloud => /rdnsv3/healthv3/sample_lb_rancher_cloud
+func getHealthPath(prefix, fqdn string) string {
+	return fmt.Sprintf("%s%s/%s", prefix, healthPath, formatKey(fqdn))
+}
@@ -0,0 +1,86 @@
+package backend
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	reasonInvalidLease = "must be a duration, e.g. 1h or 2160h"
+	reasonShortLease   = "must not be shorter than %s"
+	reasonLongLease    = "must not be longer than %s"
+
+	errParseLeaseBound = "failed to parse lease bound: %s"
+)
+
+// The bounds of the lease time which can be requested by a domain, zero means unbounded.
+var minLeaseTime, maxLeaseTime time.Duration
+
+// LeaseError is returned when the requested lease time of a domain can not be used.
+type LeaseError struct {
+	Lease  string
+	Reason string
+}
+
+func (e *LeaseError) Error() string {
+	return fmt.Sprintf("lease time %q can not be used: %s", e.Lease, e.Reason)
+}
+
+// SetLeaseBounds sets the bounds of the requested lease time, an empty bound means unbounded.
+func SetLeaseBounds(min, max string) error {
+	var lo, hi time.Duration
+	var err error
+
+	if min != "" {
+		if lo, err = time.ParseDuration(min); err != nil {
+			return errors.Wrapf(err, errParseLeaseBound, min)
+		}
+	}
+	if max != "" {
+		if hi, err = time.ParseDuration(max); err != nil {
+			return errors.Wrapf(err, errParseLeaseBound, max)
+		}
+	}
+	if hi > 0 && lo > hi {
+		return errors.Errorf(errParseLeaseBound, fmt.Sprintf("%s > %s", min, max))
+	}
+
+	minLeaseTime, maxLeaseTime = lo, hi
+	return nil
+}
+
+// ValidateLeaseTime checks the requested lease time against the bounds, an empty lease time is always valid.
+func ValidateLeaseTime(lease string) error {
+	_, err := LeaseTime(&model.DomainOptions{LeaseTime: lease}, 0)
+	return err
+}
+
+// LeaseTime returns the lease time which is requested by the options, or def when no lease time is requested.
+func LeaseTime(opts *model.DomainOptions, def time.Duration) (time.Duration, error) {
+	if opts.LeaseTime == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(opts.LeaseTime)
+	if err != nil || d <= 0 {
+		return 0, &LeaseError{Lease: opts.LeaseTime, Reason: reasonInvalidLease}
+	}
+	if minLeaseTime > 0 && d < minLeaseTime {
+		return 0, &LeaseError{Lease: opts.LeaseTime, Reason: fmt.Sprintf(reasonShortLease, minLeaseTime)}
+	}
+	if maxLeaseTime > 0 && d > maxLeaseTime {
+		return 0, &LeaseError{Lease: opts.LeaseTime, Reason: fmt.Sprintf(reasonLongLease, maxLeaseTime)}
+	}
+
+	return d, nil
+}
+
+// IsInvalidLease returns whether err is caused by a requested lease time which can not be used.
+func IsInvalidLease(err error) bool {
+	_, ok := errors.Cause(err).(*LeaseError)
+	return ok
+}
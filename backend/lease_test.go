@@ -0,0 +1,77 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rancher/rdns-server/model"
+)
+
+func TestLeaseTime(t *testing.T) {
+	if err := SetLeaseBounds("1h", "2160h"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetLeaseBounds("", "")
+
+	tests := []struct {
+		lease string
+		want  time.Duration
+		valid bool
+	}{
+		{"", 240 * time.Hour, true},
+		{"1h", time.Hour, true},
+		{"72h", 72 * time.Hour, true},
+		{"2160h", 2160 * time.Hour, true},
+		{"59m", 0, false},
+		{"2161h", 0, false},
+		{"0s", 0, false},
+		{"-1h", 0, false},
+		{"1d", 0, false},
+		{"forever", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, err := LeaseTime(&model.DomainOptions{LeaseTime: tt.lease}, 240*time.Hour)
+		if (err == nil) != tt.valid || got != tt.want {
+			t.Errorf("LeaseTime(%q) = %v, %v, want %v, valid %v", tt.lease, got, err, tt.want, tt.valid)
+		}
+		if err != nil && !IsInvalidLease(err) {
+			t.Errorf("LeaseTime(%q) = %v, not an invalid lease", tt.lease, err)
+		}
+	}
+}
+
+func TestSetLeaseBounds(t *testing.T) {
+	defer SetLeaseBounds("", "")
+
+	tests := []struct {
+		min, max string
+		valid    bool
+	}{
+		{"", "", true},
+		{"1h", "", true},
+		{"", "1h", true},
+		{"1h", "1h", true},
+		{"2h", "1h", false},
+		{"one hour", "", false},
+		{"", "1y", false},
+	}
+
+	for _, tt := range tests {
+		if err := SetLeaseBounds(tt.min, tt.max); (err == nil) != tt.valid {
+			t.Errorf("SetLeaseBounds(%q, %q) = %v, valid %v", tt.min, tt.max, err, tt.valid)
+		}
+	}
+}
+
+func TestLeaseTimeUnbounded(t *testing.T) {
+	if err := SetLeaseBounds("", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, lease := range []string{"1s", "87600h"} {
+		if err := ValidateLeaseTime(lease); err != nil {
+			t.Errorf("ValidateLeaseTime(%q) = %v", lease, err)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package backend
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	maxLabelLength = 63
+
+	reasonInvalidLabel = "must be 1-63 lowercase letters, digits or hyphens, and can not start or end with a hyphen"
+	reasonReserved     = "reserved"
+	reasonTaken        = "already taken"
+	reasonInUse        = "used by an active domain"
+	reasonNotFrozen    = "not frozen"
+
+	errInvalidPattern = "invalid reserved name pattern: %s"
+	errLoadPatterns   = "failed to load reserved names file: %s"
+)
+
+var labelRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// Names which can not be requested as normal (vanity) domain names.
+var reservedNames = map[string]bool{
+	"abuse":        true,
+	"admin":        true,
+	"api":          true,
+	"autoconfig":   true,
+	"autodiscover": true,
+	"dns":          true,
+	"empty":        true,
+	"ftp":          true,
+	"hostmaster":   true,
+	"imap":         true,
+	"localhost":    true,
+	"mail":         true,
+	"ns":           true,
+	"ns1":          true,
+	"ns2":          true,
+	"ns3":          true,
+	"ns4":          true,
+	"pop":          true,
+	"postmaster":   true,
+	"rancher":      true,
+	"root":         true,
+	"security":     true,
+	"smtp":         true,
+	"status":       true,
+	"support":      true,
+	"webmaster":    true,
+	"wpad":         true,
+	"www":          true,
+}
+
+// reservedPatterns are the configured patterns of reserved and offensive words, e.g. admin*, *porn*
+// they are matched against the whole label with path.Match.
+var (
+	reservedPatterns []string
+	patternsMu       sync.RWMutex
+)
+
+// NameError is returned when the requested name of a normal domain can not be used.
+type NameError struct {
+	Name     string
+	Reason   string
+	Taken    bool
+	NotFound bool
+}
+
+func (e *NameError) Error() string {
+	return fmt.Sprintf("name %q can not be used: %s", e.Name, e.Reason)
+}
+
+// NewNameTakenError returns the error of a name which is in use or frozen.
+func NewNameTakenError(name string) error {
+	return &NameError{Name: name, Reason: reasonTaken, Taken: true}
+}
+
+// NewNameInUseError returns the error of a name which can not be released because its domain is active.
+func NewNameInUseError(name string) error {
+	return &NameError{Name: name, Reason: reasonInUse, Taken: true}
+}
+
+// NewNotFrozenError returns the error of a name which is not frozen.
+func NewNotFrozenError(name string) error {
+	return &NameError{Name: name, Reason: reasonNotFrozen, NotFound: true}
+}
+
+// SetReservedPatterns sets the reserved name patterns from a file (one pattern per line, # for comments)
+// and a comma separated list.
+func SetReservedPatterns(file, list string) error {
+	patterns := make([]string, 0)
+
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return errors.Wrapf(err, errLoadPatterns, file)
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			patterns = append(patterns, strings.ToLower(line))
+		}
+		if err := scanner.Err(); err != nil {
+			return errors.Wrapf(err, errLoadPatterns, file)
+		}
+	}
+
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, strings.ToLower(p))
+		}
+	}
+
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return errors.Wrapf(err, errInvalidPattern, p)
+		}
+	}
+
+	patternsMu.Lock()
+	reservedPatterns = patterns
+	patternsMu.Unlock()
+
+	return nil
+}
+
+// IsReserved returns whether a label is a reserved name or matches any reserved pattern.
+func IsReserved(label string) bool {
+	if reservedNames[label] {
+		return true
+	}
+
+	patternsMu.RLock()
+	defer patternsMu.RUnlock()
+
+	for _, p := range reservedPatterns {
+		if ok, _ := path.Match(p, label); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// NameLabel returns the label of a requested name, the name can be the label or the label with the zone.
+// e.g. sample => sample, sample.lb.rancher.cloud => sample
+func NameLabel(name, zone string) (string, error) {
+	label := strings.ToLower(strings.TrimRight(name, "."))
+	label = strings.TrimSuffix(label, "."+strings.ToLower(strings.TrimRight(zone, ".")))
+
+	if err := ValidateLabel(label); err != nil {
+		return "", err
+	}
+
+	return label, nil
+}
+
+// ValidateLabel checks the syntax of a label and whether it is reserved.
+func ValidateLabel(label string) error {
+	if err := ValidateLabelSyntax(label); err != nil {
+		return err
+	}
+	if IsReserved(label) {
+		return &NameError{Name: label, Reason: reasonReserved}
+	}
+	return nil
+}
+
+// ValidateLabelSyntax only checks the syntax of a label.
+func ValidateLabelSyntax(label string) error {
+	if len(label) > maxLabelLength || !labelRegexp.MatchString(label) {
+		return &NameError{Name: label, Reason: reasonInvalidLabel}
+	}
+	return nil
+}
+
+// IsNameTaken returns whether err is caused by a name which is in use or frozen.
+func IsNameTaken(err error) bool {
+	e := nameError(err)
+	return e != nil && e.Taken
+}
+
+// IsInvalidName returns whether err is caused by a name which is malformed or reserved.
+func IsInvalidName(err error) bool {
+	e := nameError(err)
+	return e != nil && !e.Taken && !e.NotFound
+}
+
+// IsNotFrozen returns whether err is caused by a name which is not frozen.
+func IsNotFrozen(err error) bool {
+	e := nameError(err)
+	return e != nil && e.NotFound
+}
+
+func nameError(err error) *NameError {
+	e, _ := errors.Cause(err).(*NameError)
+	return e
+}
@@ -0,0 +1,124 @@
+package backend
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateLabel(t *testing.T) {
+	if err := SetReservedPatterns("", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		label string
+		valid bool
+	}{
+		{"sample", true},
+		{"a", true},
+		{"a1-b2", true},
+		{"0day", true},
+		{strings.Repeat("a", 63), true},
+		{strings.Repeat("a", 64), false},
+		{"", false},
+		{"-sample", false},
+		{"sample-", false},
+		{"Sample", false},
+		{"sam_ple", false},
+		{"sam.ple", false},
+		{"www", false},
+		{"ns1", false},
+		{"empty", false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateLabel(tt.label)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateLabel(%q) = %v, valid %v", tt.label, err, tt.valid)
+		}
+		if err != nil && !IsInvalidName(err) {
+			t.Errorf("ValidateLabel(%q) = %v, not an invalid name", tt.label, err)
+		}
+	}
+}
+
+func TestNameLabel(t *testing.T) {
+	if err := SetReservedPatterns("", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		label string
+		valid bool
+	}{
+		{"sample", "sample", true},
+		{"Sample", "sample", true},
+		{"sample.lb.rancher.cloud", "sample", true},
+		{"sample.lb.rancher.cloud.", "sample", true},
+		{"sample.LB.rancher.cloud", "sample", true},
+		{"sub.sample.lb.rancher.cloud", "", false},
+		{"sample.other.cloud", "", false},
+		{"www.lb.rancher.cloud", "", false},
+	}
+
+	for _, tt := range tests {
+		label, err := NameLabel(tt.name, "lb.rancher.cloud.")
+		if (err == nil) != tt.valid || label != tt.label {
+			t.Errorf("NameLabel(%q) = %q, %v, want %q, valid %v", tt.name, label, err, tt.label, tt.valid)
+		}
+	}
+}
+
+func TestReservedPatterns(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "reserved")
+	data := "# offensive words\n\n*porn*\n  Admin*  \n"
+	if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetReservedPatterns(file, "billing, ?x"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetReservedPatterns("", "")
+
+	tests := []struct {
+		label    string
+		reserved bool
+	}{
+		{"www", true},
+		{"freeporn1", true},
+		{"admin", true},
+		{"administrator", true},
+		{"myadmin", false},
+		{"billing", true},
+		{"billing2", false},
+		{"ax", true},
+		{"abx", false},
+		{"sample", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsReserved(tt.label); got != tt.reserved {
+			t.Errorf("IsReserved(%q) = %v, want %v", tt.label, got, tt.reserved)
+		}
+	}
+}
+
+func TestSetReservedPatternsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		list string
+	}{
+		{"missing file", filepath.Join(t.TempDir(), "missing"), ""},
+		{"invalid pattern", "", "[a-"},
+	}
+
+	for _, tt := range tests {
+		if err := SetReservedPatterns(tt.file, tt.list); err == nil {
+			t.Errorf("%s: SetReservedPatterns succeeded", tt.name)
+		}
+	}
+}
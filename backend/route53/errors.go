@@ -1,23 +1,42 @@
 package route53
 
 const (
+	errChangeRoute53Records      = "failed to change route53 records of %s"
 	errDeleteAFromDatabase       = "failed to delete A record %s from database"
+	errDeleteFrozenFromDatabase  = "failed to delete %s's frozen record from database"
+	errDeleteOptionFromDatabase  = "failed to delete %s's %s option from database"
+	errDeleteOptionsFromDatabase = "failed to delete %s's options from database"
 	errDeleteRecordsFromDatabase = "failed to delete %s record %s from database"
 	errDeleteRoute53Record       = "failed to delete route53 %s record: %s"
 	errExistRecord               = "%s record: %s already exist"
 	errFilterRecords             = "failed to filter %s records: %s"
 	errGenerateName              = "failed to generate valid record: %s"
+	errImportTokenToDatabase     = "failed to import %s's token to database"
 	errInsertFrozenToDatabase    = "failed to insert %s's frozen to database"
+	errInsertOptionToDatabase    = "failed to insert %s's %s option to database"
 	errInsertRecordToDatabase    = "failed to insert %s record: %s to database"
 	errInsertTokenToDatabase     = "failed to insert %s's token to database"
+	errInvalidRegion             = "%s is not an aws region for the latency records of %s"
+	errListOptionsFromDatabase   = "failed to list %s options from database"
+	errListRoute53Records        = "failed to list route53 records of %s"
+	errMissingRegion             = "host %s of %s has no region, every host of a regional domain needs one"
 	errNoRoute53Record           = "failed to found route53 %s record: %s"
+	errNotSupportDNSSEC          = "dnssec is not supported by the %s backend"
 	errNotValidGenerateName      = "generate name %s is already exist, will try another"
 	errParseFlag                 = "failed to parse flag: %s"
 	errQueryAFromDatabase        = "failed to query %s's A record from database"
+	errQueryFrozenFromDatabase   = "failed to query %s's frozen record from database"
+	errQueryOptionFromDatabase   = "failed to query %s's %s option from database"
 	errQueryTokenFromDatabase    = "failed to query %s's token record from database"
 	errQueryTXTFromDatabase      = "failed to query %s's TXT record from database"
 	errQueryCNAMEFromDatabase    = "failed to query %s's CNAME record from database"
+	errReservedGenerateName      = "generate name %s is reserved, will try another"
 	errRenewFrozenFromDatabase   = "failed to renew %s's frozen record from database"
 	errRenewTokenFromDatabase    = "failed to renew %s's token record from database"
+	errSignTokenToDatabase       = "failed to set whether %s only accepts signed requests to database"
+	errSuspendTokenFromDatabase  = "failed to suspend %s's token record from database"
+	errUpdateOptionToDatabase    = "failed to update %s's %s option to database"
+	errUnknownExportKind         = "unknown export entry kind: %s"
 	errUpsertRoute53Record       = "failed to upsert route53 %s record: %s"
+	errWeightedRegions           = "the hosts of %s can not have both weights and regions"
 )
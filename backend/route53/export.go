@@ -0,0 +1,331 @@
+package route53
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancher/rdns-server/backend"
+	"github.com/rancher/rdns-server/database"
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Export emits every domain with its records and token and every frozen prefix,
+// the domains are read from the database which holds the records of suspended domains as well.
+func (b *Backend) Export(emit func(*model.ExportEntry) error) error {
+	tokens, err := database.GetDatabase().ListAllTokens()
+	if err != nil {
+		return errors.Wrapf(err, errQueryTokenFromDatabase, b.Zone)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Fqdn < tokens[j].Fqdn })
+
+	entries := make(map[int64]*model.ExportEntry, len(tokens))
+	for _, t := range tokens {
+		e := &model.ExportEntry{
+			Kind:       model.ExportKindDomain,
+			Fqdn:       t.Fqdn,
+			Token:      t.Token,
+			State:      model.StateActive,
+			Expiration: convertExpiration(time.Unix(0, t.CreatedOn), int(b.leaseTimeOf(t).Nanoseconds())),
+			SignedOnly: t.SignedOnly,
+		}
+		if t.LeaseTime.Valid {
+			e.LeaseTime = time.Duration(t.LeaseTime.Int64).String()
+		}
+		if t.SuspendedOn.Valid {
+			e.State = model.StateSuspended
+		}
+		entries[t.ID] = e
+	}
+
+	as, err := database.GetDatabase().ListAllA()
+	if err != nil {
+		return errors.Wrapf(err, errQueryAFromDatabase, b.Zone)
+	}
+
+	// the sub domains belong to the empty.<fqdn> record of their domain
+	parents := make(map[int64]*model.ExportEntry)
+	for _, a := range as {
+		e, ok := entries[a.TID]
+		if !ok {
+			continue
+		}
+		switch a.Fqdn {
+		case e.Fqdn:
+			if a.Content != "" {
+				e.Hosts = strings.Split(a.Content, ",")
+			}
+		case fmt.Sprintf("empty.%s", e.Fqdn):
+			parents[a.ID] = e
+		}
+	}
+
+	subs, err := database.GetDatabase().ListAllSubA()
+	if err != nil {
+		return errors.Wrapf(err, errQueryAFromDatabase, b.Zone)
+	}
+	for _, s := range subs {
+		e, ok := parents[s.PID]
+		if !ok {
+			continue
+		}
+		if e.SubDomain == nil {
+			e.SubDomain = make(map[string][]string)
+		}
+		e.SubDomain[strings.Split(s.Fqdn, ".")[0]] = strings.Split(s.Content, ",")
+	}
+
+	txts, err := database.GetDatabase().ListAllTXT()
+	if err != nil {
+		return errors.Wrapf(err, errQueryTXTFromDatabase, b.Zone)
+	}
+	for _, t := range txts {
+		e, ok := entries[t.TID]
+		if !ok {
+			continue
+		}
+		if e.Texts == nil {
+			e.Texts = make(map[string]string)
+		}
+		e.Texts[t.Fqdn] = strings.Trim(t.Content, "\"")
+	}
+
+	cnames, err := database.GetDatabase().ListAllCNAME()
+	if err != nil {
+		return errors.Wrapf(err, errQueryCNAMEFromDatabase, b.Zone)
+	}
+	for _, c := range cnames {
+		if e, ok := entries[c.TID]; ok && c.Fqdn == e.Fqdn {
+			e.CNAME = c.Content
+		}
+	}
+
+	// the A records only hold the served hosts of a domain with a health check, weights or regions
+	ws, err := database.GetDatabase().ListAllDomainOptions(model.OptionHostWeight)
+	if err != nil {
+		return errors.Wrapf(err, errListOptionsFromDatabase, model.OptionHostWeight)
+	}
+	for _, w := range ws {
+		e, ok := entries[w.TID]
+		if !ok {
+			continue
+		}
+		weights := make(map[string]model.HostWeight)
+		if err := json.Unmarshal([]byte(w.Content), &weights); err != nil {
+			logrus.Warnf("skip invalid host weights %s: %v", w.Fqdn, err)
+			continue
+		}
+		e.Hosts = weightedHosts(weights)
+		e.Weights = weights
+	}
+
+	rs, err := database.GetDatabase().ListAllDomainOptions(model.OptionHostRegion)
+	if err != nil {
+		return errors.Wrapf(err, errListOptionsFromDatabase, model.OptionHostRegion)
+	}
+	for _, r := range rs {
+		e, ok := entries[r.TID]
+		if !ok {
+			continue
+		}
+		regions := make(map[string]string)
+		if err := json.Unmarshal([]byte(r.Content), &regions); err != nil {
+			logrus.Warnf("skip invalid host regions %s: %v", r.Fqdn, err)
+			continue
+		}
+		e.Hosts = regionalHosts(regions)
+		e.Regions = regions
+	}
+
+	hcs, err := database.GetDatabase().ListAllDomainOptions(model.OptionHealthCheck)
+	if err != nil {
+		return errors.Wrapf(err, errListOptionsFromDatabase, model.OptionHealthCheck)
+	}
+	for _, h := range hcs {
+		e, ok := entries[h.TID]
+		if !ok {
+			continue
+		}
+		hs := &model.HealthState{}
+		if err := json.Unmarshal([]byte(h.Content), hs); err != nil {
+			logrus.Warnf("skip invalid health check %s: %v", h.Fqdn, err)
+			continue
+		}
+		e.Hosts = hs.HostNames()
+		e.HealthCheck = &hs.Check
+	}
+
+	for _, t := range tokens {
+		if err := emit(entries[t.ID]); err != nil {
+			return err
+		}
+	}
+
+	frozen, err := b.ListFrozen("")
+	if err != nil {
+		return err
+	}
+	for _, f := range frozen {
+		if err := emit(&model.ExportEntry{Kind: model.ExportKindFrozen, Prefix: f.Prefix, Expiration: f.Expiration}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Import creates or updates a domain or frozen prefix of an export, records which are not in the entry are kept.
+func (b *Backend) Import(e *model.ExportEntry) error {
+	switch e.Kind {
+	case model.ExportKindDomain:
+		return b.importDomain(e)
+	case model.ExportKindFrozen:
+		return b.importFrozen(e)
+	}
+	return errors.Errorf(errUnknownExportKind, e.Kind)
+}
+
+func (b *Backend) importDomain(e *model.ExportEntry) error {
+	logrus.Debugf("import domain: %s", e.Fqdn)
+
+	opts := &model.DomainOptions{
+		Fqdn:        e.Fqdn,
+		Hosts:       e.Hosts,
+		SubDomain:   e.SubDomain,
+		LeaseTime:   e.LeaseTime,
+		HealthCheck: e.HealthCheck,
+	}
+
+	lease, err := backend.LeaseTime(opts, 0)
+	if err != nil {
+		return err
+	}
+
+	// the records of a suspended domain are restored first, the entry is suspended again after its records are set
+	current, err := database.GetDatabase().QueryToken(e.Fqdn)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrapf(err, errQueryTokenFromDatabase, e.Fqdn)
+	}
+	if err == nil && current.SuspendedOn.Valid {
+		if err := b.resume(opts); err != nil {
+			return err
+		}
+	}
+
+	// the expiration is kept by moving the creation time of the token
+	t := &model.Token{
+		Token:      e.Token,
+		Fqdn:       e.Fqdn,
+		LeaseTime:  sql.NullInt64{Int64: lease.Nanoseconds(), Valid: lease > 0},
+		SignedOnly: e.SignedOnly,
+	}
+	t.CreatedOn = e.Expiration.Add(-b.leaseTimeOf(t)).UnixNano()
+
+	tID, err := database.GetDatabase().ImportToken(t)
+	if err != nil {
+		return errors.Wrapf(err, errImportTokenToDatabase, e.Fqdn)
+	}
+
+	prefix := strings.Split(e.Fqdn, ".")[0]
+	r, err := database.GetDatabase().QueryFrozen(prefix)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrapf(err, errQueryFrozenFromDatabase, prefix)
+	}
+	if r == "" {
+		if err := b.insertFrozen(prefix); err != nil {
+			return err
+		}
+	}
+
+	if e.CNAME != "" {
+		rrs := &route53.ResourceRecordSet{
+			Type: aws.String(typeCNAME),
+			Name: aws.String(e.Fqdn),
+			ResourceRecords: []*route53.ResourceRecord{
+				{
+					Value: aws.String(e.CNAME),
+				},
+			},
+			TTL: aws.Int64(int64(b.TTL)),
+		}
+		if _, err := b.setRecord(rrs, opts, typeCNAME, tID, 0, false); err != nil {
+			return err
+		}
+
+		rrs.Name = aws.String(fmt.Sprintf("\\052.%s", e.Fqdn))
+		if _, err := b.setRecord(rrs, opts, typeCNAME, tID, 0, false); err != nil {
+			return err
+		}
+	} else {
+		if err := b.MigrateRecord(&model.MigrateRecord{Fqdn: e.Fqdn, Hosts: e.Hosts, SubDomain: e.SubDomain, Weights: e.Weights, Regions: e.Regions, SignedOnly: e.SignedOnly}); err != nil {
+			return err
+		}
+	}
+
+	if e.HealthCheck != nil {
+		hs, err := b.setHealthCheck(opts, tID)
+		if err != nil {
+			return err
+		}
+		if e.CNAME == "" {
+			if err := b.serveHealthState(hs); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name, text := range e.Texts {
+		rrs := &route53.ResourceRecordSet{
+			Name: aws.String(name),
+			Type: aws.String(typeTXT),
+			ResourceRecords: []*route53.ResourceRecord{
+				{
+					Value: aws.String(fmt.Sprintf("\"%s\"", text)),
+				},
+			},
+			TTL: aws.Int64(int64(b.TTL)),
+		}
+		if _, err := b.setRecord(rrs, &model.DomainOptions{Fqdn: name}, typeTXT, tID, 0, false); err != nil {
+			return err
+		}
+	}
+
+	if e.State == model.StateSuspended {
+		return b.Suspend(opts)
+	}
+
+	return nil
+}
+
+// The expiration of a frozen prefix is its creation time with the frozen time
+func (b *Backend) importFrozen(e *model.ExportEntry) error {
+	logrus.Debugf("import frozen prefix: %s", e.Prefix)
+
+	createdOn := e.Expiration.Add(-b.Frozen).UnixNano()
+
+	r, err := database.GetDatabase().QueryFrozen(e.Prefix)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrapf(err, errQueryFrozenFromDatabase, e.Prefix)
+	}
+
+	if r != "" {
+		if err := database.GetDatabase().UpdateFrozen(e.Prefix, createdOn); err != nil {
+			return errors.Wrapf(err, errRenewFrozenFromDatabase, e.Prefix)
+		}
+		return nil
+	}
+
+	if err := database.GetDatabase().InsertFrozenOn(e.Prefix, createdOn); err != nil {
+		return errors.Wrapf(err, errInsertFrozenToDatabase, e.Prefix)
+	}
+
+	return nil
+}
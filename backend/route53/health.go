@@ -0,0 +1,160 @@
+package route53
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/rancher/rdns-server/database"
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ListHealthStates returns the health checks of every domain with the health of their hosts.
+func (b *Backend) ListHealthStates() ([]*model.HealthState, error) {
+	rs, err := database.GetDatabase().ListAllDomainOptions(model.OptionHealthCheck)
+	if err != nil {
+		return nil, errors.Wrapf(err, errListOptionsFromDatabase, model.OptionHealthCheck)
+	}
+
+	result := make([]*model.HealthState, 0, len(rs))
+	for _, r := range rs {
+		s := &model.HealthState{}
+		if err := json.Unmarshal([]byte(r.Content), s); err != nil {
+			logrus.Warnf("skip invalid health check %s: %v", r.Fqdn, err)
+			continue
+		}
+		result = append(result, s)
+	}
+
+	return result, nil
+}
+
+// SetHealthState keeps the health of the hosts and upserts the A records of the domain with the served hosts,
+// route53 has no plugin to drop the unhealthy hosts from the answers.
+// The health is merged into the current health check of the domain, which may be changed since it is listed.
+func (b *Backend) SetHealthState(s *model.HealthState) error {
+	cur, err := b.getHealthState(s.Fqdn)
+	if err != nil || cur == nil {
+		return err
+	}
+
+	merged := model.NewHealthState(cur.Fqdn, &cur.Check, cur.HostNames(), s)
+	if reflect.DeepEqual(merged, cur) {
+		return nil
+	}
+
+	if err := saveOption(merged.Fqdn, model.OptionHealthCheck, merged, 0); err != nil {
+		return err
+	}
+
+	// the records of a suspended domain are restored from the database when it is renewed
+	token, err := database.GetDatabase().QueryToken(s.Fqdn)
+	if err != nil {
+		return errors.Wrapf(err, errQueryTokenFromDatabase, s.Fqdn)
+	}
+	if token.SuspendedOn.Valid {
+		return nil
+	}
+
+	return b.serveHealthState(merged)
+}
+
+// Used to set the A and wildcard A records of a domain with the served hosts when they are changed
+func (b *Backend) serveHealthState(s *model.HealthState) error {
+	served := s.Served()
+	if len(served) <= 0 {
+		return nil
+	}
+
+	weights, err := b.getWeights(s.Fqdn)
+	if err != nil {
+		return err
+	}
+	regions, err := b.getRegions(s.Fqdn)
+	if err != nil {
+		return err
+	}
+
+	a, err := database.GetDatabase().QueryA(s.Fqdn)
+	if err != nil {
+		return errors.Wrapf(err, errQueryAFromDatabase, s.Fqdn)
+	}
+	if sameHosts(a.Content, model.PreferredHosts(served, weights)) {
+		return nil
+	}
+
+	e, err := database.GetDatabase().QueryA(fmt.Sprintf("empty.%s", s.Fqdn))
+	if err != nil || e.Fqdn == "" {
+		return errors.Wrapf(err, errQueryAFromDatabase, s.Fqdn)
+	}
+
+	return b.setHosts(&model.DomainOptions{Fqdn: s.Fqdn}, served, weights, regions, e.TID, e.ID)
+}
+
+// Used to set or delete the health check of a domain, the hosts which are still in the domain keep their health.
+// Returns the health state to pick the served hosts, nil when the domain has no health check.
+func (b *Backend) setHealthCheck(opts *model.DomainOptions, tID int64) (*model.HealthState, error) {
+	if opts.HealthCheck == nil {
+		return nil, deleteOption(opts.Fqdn, model.OptionHealthCheck)
+	}
+
+	old, err := b.getHealthState(opts.Fqdn)
+	if err != nil {
+		return nil, err
+	}
+
+	s := model.NewHealthState(opts.Fqdn, opts.HealthCheck, opts.Hosts, old)
+	if err := saveOption(s.Fqdn, model.OptionHealthCheck, s, tID); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Used to add the health check of a domain and the health of its hosts, the hosts include the unhealthy ones
+// which are not in the records
+func (b *Backend) setHealth(d *model.Domain) error {
+	s, err := b.getHealthState(d.Fqdn)
+	if err != nil || s == nil {
+		return err
+	}
+
+	d.Hosts = s.HostNames()
+	d.HealthCheck = &s.Check
+	d.Health = s.Hosts
+
+	return nil
+}
+
+// Used to get the health check of a domain, returns nil when the domain has none
+func (b *Backend) getHealthState(fqdn string) (*model.HealthState, error) {
+	s := &model.HealthState{}
+	ok, err := getOption(fqdn, model.OptionHealthCheck, s)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Used to get the hosts of the A records, the served hosts when the domain has a health check
+func servedHosts(opts *model.DomainOptions, s *model.HealthState) []string {
+	if s == nil {
+		return opts.Hosts
+	}
+	return s.Served()
+}
+
+func toResourceRecords(hosts []string) []*route53.ResourceRecord {
+	rr := make([]*route53.ResourceRecord, 0, len(hosts))
+	for _, h := range hosts {
+		rr = append(rr, &route53.ResourceRecord{
+			Value: aws.String(h),
+		})
+	}
+	return rr
+}
@@ -0,0 +1,67 @@
+package route53
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/rancher/rdns-server/database"
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/pkg/errors"
+)
+
+// Used to insert or update an option of a domain, the value is kept as JSON
+func saveOption(fqdn, kind string, v interface{}, tID int64) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	r := &model.RecordDomainOption{
+		Fqdn:      fqdn,
+		Kind:      kind,
+		Content:   string(data),
+		CreatedOn: time.Now().Unix(),
+		TID:       tID,
+	}
+
+	old, err := database.GetDatabase().QueryDomainOption(fqdn, kind)
+	if err != nil {
+		return errors.Wrapf(err, errQueryOptionFromDatabase, fqdn, kind)
+	}
+	if old.Fqdn != "" {
+		if _, err := database.GetDatabase().UpdateDomainOption(r); err != nil {
+			return errors.Wrapf(err, errUpdateOptionToDatabase, fqdn, kind)
+		}
+		return nil
+	}
+
+	if _, err := database.GetDatabase().InsertDomainOption(r); err != nil {
+		return errors.Wrapf(err, errInsertOptionToDatabase, fqdn, kind)
+	}
+	return nil
+}
+
+// Used to get an option of a domain into v, returns false when the domain has none
+func getOption(fqdn, kind string, v interface{}) (bool, error) {
+	r, err := database.GetDatabase().QueryDomainOption(fqdn, kind)
+	if err != nil {
+		return false, errors.Wrapf(err, errQueryOptionFromDatabase, fqdn, kind)
+	}
+	if r.Fqdn == "" {
+		return false, nil
+	}
+
+	if err := json.Unmarshal([]byte(r.Content), v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Used to delete an option of a domain
+func deleteOption(fqdn, kind string) error {
+	if err := database.GetDatabase().DeleteDomainOption(fqdn, kind); err != nil {
+		return errors.Wrapf(err, errDeleteOptionFromDatabase, fqdn, kind)
+	}
+	return nil
+}
@@ -0,0 +1,454 @@
+package route53
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancher/rdns-server/backend"
+	"github.com/rancher/rdns-server/database"
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	kindA     = "A"
+	kindSub   = "SUB"
+	kindTXT   = "TXT"
+	kindCNAME = "CNAME"
+	kindToken = "TOKEN"
+
+	// records which are changed within the settle time may still be written by a request, they are not compared
+	reconcileSettleTime = time.Minute
+)
+
+// dbRecord is a record of the record_a, sub_record_a, record_txt or record_cname table.
+type dbRecord struct {
+	kind    string
+	rType   string
+	fqdn    string
+	content string
+	tID     int64
+	pID     int64
+	changed int64
+}
+
+// Reconcile compares the hosted zone with the database and reports the differences,
+// they are repaired when repair is true:
+//   records which only exist in route53 are added to the database when their token exists, otherwise deleted from route53
+//   records which only exist in the database are deleted from the database
+//   records whose values differ are updated in the database with the values of route53
+//   records whose token does not exist are deleted from both
+//   tokens without any records are deleted
+func (b *Backend) Reconcile(repair bool) (*model.ReconcileReport, error) {
+	r := &model.ReconcileReport{
+		Repair:  repair,
+		Started: time.Now(),
+		Drifts:  make([]model.Drift, 0),
+	}
+
+	zone, sets, err := b.listZone()
+	if err != nil {
+		return r, err
+	}
+	r.Route53Records = len(zone)
+
+	tokens, err := database.GetDatabase().ListAllTokens()
+	if err != nil {
+		return r, errors.Wrapf(err, errQueryTokenFromDatabase, b.Zone)
+	}
+	r.Tokens = len(tokens)
+
+	byID := make(map[int64]*model.Token, len(tokens))
+	byFqdn := make(map[string]*model.Token, len(tokens))
+	for _, t := range tokens {
+		byID[t.ID] = t
+		byFqdn[strings.ToLower(t.Fqdn)] = t
+	}
+
+	records, parents, err := b.listDatabaseRecords()
+	if err != nil {
+		return r, err
+	}
+	r.DatabaseRecords = len(records)
+
+	settled := time.Now().Add(-reconcileSettleTime)
+	owned := make(map[int64]bool, len(tokens))
+
+	for _, rec := range records {
+		owned[rec.tID] = true
+
+		key := recordKey(rec.rType, rec.fqdn)
+		rrs, exist := zone[key]
+		delete(zone, key)
+
+		if rec.changed > settled.Unix() {
+			continue
+		}
+
+		token := byID[rec.tID]
+		d := model.Drift{
+			Type:     rec.kind,
+			Fqdn:     rec.fqdn,
+			Database: rec.content,
+		}
+		if exist {
+			d.Route53 = recordValues(rrs)
+		}
+
+		var err error
+		switch {
+		case token == nil:
+			d.Kind = model.DriftNoToken
+			if repair {
+				err = b.repairNoToken(rec, sets[key])
+			}
+		case token.SuspendedOn.Valid && rec.rType != typeTXT:
+			// the records of a suspended domain are removed or parked in route53 until it is renewed
+			continue
+		case !exist:
+			// records without values are only kept in the database, e.g. empty.<fqdn>
+			if rec.content == "" {
+				continue
+			}
+			d.Kind = model.DriftDatabaseOnly
+			if repair {
+				err = b.deleteRecordFromDatabase(&route53.ResourceRecordSet{Name: aws.String(rec.fqdn)}, rec.rType, rec.kind == kindSub)
+			}
+		case d.Route53 != normalizeValues(rec.content):
+			d.Kind = model.DriftMismatch
+			if repair {
+				_, err = b.setRecordToDatabase(withName(rrs, rec.fqdn), rec.rType, rec.tID, rec.pID, rec.kind == kindSub)
+			}
+		default:
+			continue
+		}
+
+		d.Repaired = repair && err == nil
+		r.AddDrift(d, err)
+	}
+
+	for _, rrs := range zone {
+		name := normalizeName(aws.StringValue(rrs.Name))
+		rType := aws.StringValue(rrs.Type)
+
+		root := b.rootOf(name)
+		if root == "" || backend.IsReserved(strings.Split(root, ".")[0]) {
+			// the records of the zone itself and of reserved names are not managed by rdns
+			continue
+		}
+
+		token := byFqdn[root]
+		if token != nil && token.SuspendedOn.Valid && rType != typeTXT {
+			continue
+		}
+		if token != nil && token.CreatedOn > settled.UnixNano() {
+			continue
+		}
+
+		kind := recordKind(rType, name, root)
+
+		// the record may be written to the database after the zone is listed
+		if b.existsInDatabase(kind, name) {
+			continue
+		}
+
+		d := model.Drift{
+			Kind:    model.DriftRoute53Only,
+			Type:    kind,
+			Fqdn:    name,
+			Route53: recordValues(rrs),
+		}
+
+		var err error
+		if repair {
+			err = b.repairRoute53Only(kind, name, rrs, sets[recordKey(rType, name)], token, parents[root])
+		}
+
+		d.Repaired = repair && err == nil
+		r.AddDrift(d, err)
+	}
+
+	for _, t := range tokens {
+		if owned[t.ID] || t.CreatedOn > settled.UnixNano() {
+			continue
+		}
+
+		d := model.Drift{
+			Kind: model.DriftNoRecords,
+			Type: kindToken,
+			Fqdn: t.Fqdn,
+		}
+
+		var err error
+		if repair {
+			err = database.GetDatabase().DeleteToken(t.Token)
+		}
+
+		d.Repaired = repair && err == nil
+		r.AddDrift(d, err)
+	}
+
+	r.Finished = time.Now()
+	r.Duration = r.Finished.Sub(r.Started).String()
+
+	return r, nil
+}
+
+// Used to list the A, TXT and CNAME record sets of the hosted zone, keyed by type and name. The weighted record
+// sets of a name are merged into one to be compared, they are returned as they are to be deleted
+func (b *Backend) listZone() (map[string]*route53.ResourceRecordSet, map[string][]*route53.ResourceRecordSet, error) {
+	result := make(map[string]*route53.ResourceRecordSet)
+	sets := make(map[string][]*route53.ResourceRecordSet)
+
+	input := &route53.ListResourceRecordSetsInput{
+		HostedZoneId: aws.String(b.ZoneID),
+	}
+
+	zone := strings.ToLower(b.Zone)
+	err := b.Svc.ListResourceRecordSetsPages(input, func(output *route53.ListResourceRecordSetsOutput, last bool) bool {
+		for _, rrs := range output.ResourceRecordSets {
+			rType := aws.StringValue(rrs.Type)
+			if rType != typeA && rType != typeTXT && rType != typeCNAME {
+				continue
+			}
+
+			name := normalizeName(aws.StringValue(rrs.Name))
+			if name == zone {
+				continue
+			}
+
+			key := recordKey(rType, name)
+			sets[key] = append(sets[key], rrs)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, errListRoute53Records, b.Zone)
+	}
+
+	for key, s := range sets {
+		result[key] = mergeSets(s)
+	}
+
+	return result, sets, nil
+}
+
+// Used to list the records of the database, the parents are the empty.<fqdn> records keyed by fqdn
+func (b *Backend) listDatabaseRecords() ([]*dbRecord, map[string]*model.RecordA, error) {
+	records := make([]*dbRecord, 0)
+	parents := make(map[string]*model.RecordA)
+
+	as, err := database.GetDatabase().ListAllA()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, errQueryAFromDatabase, b.Zone)
+	}
+
+	byID := make(map[int64]*model.RecordA, len(as))
+	for _, a := range as {
+		byID[a.ID] = a
+		if strings.HasPrefix(a.Fqdn, "empty.") {
+			parents[strings.ToLower(strings.TrimPrefix(a.Fqdn, "empty."))] = a
+		}
+		records = append(records, &dbRecord{
+			kind:    kindA,
+			rType:   typeA,
+			fqdn:    normalizeName(a.Fqdn),
+			content: a.Content,
+			tID:     a.TID,
+			changed: changedOn(a.CreatedOn, a.UpdatedOn),
+		})
+	}
+
+	subs, err := database.GetDatabase().ListAllSubA()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, errQueryAFromDatabase, b.Zone)
+	}
+	for _, s := range subs {
+		// the token of a sub domain record is the token of its parent
+		var tID int64
+		if p, ok := byID[s.PID]; ok {
+			tID = p.TID
+		}
+		records = append(records, &dbRecord{
+			kind:    kindSub,
+			rType:   typeA,
+			fqdn:    normalizeName(s.Fqdn),
+			content: s.Content,
+			tID:     tID,
+			pID:     s.PID,
+			changed: changedOn(s.CreatedOn, s.UpdatedOn),
+		})
+	}
+
+	txts, err := database.GetDatabase().ListAllTXT()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, errQueryTXTFromDatabase, b.Zone)
+	}
+	for _, t := range txts {
+		records = append(records, &dbRecord{
+			kind:    kindTXT,
+			rType:   typeTXT,
+			fqdn:    normalizeName(t.Fqdn),
+			content: t.Content,
+			tID:     t.TID,
+			changed: changedOn(t.CreatedOn, t.UpdatedOn),
+		})
+	}
+
+	cnames, err := database.GetDatabase().ListAllCNAME()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, errQueryCNAMEFromDatabase, b.Zone)
+	}
+	for _, c := range cnames {
+		records = append(records, &dbRecord{
+			kind:    kindCNAME,
+			rType:   typeCNAME,
+			fqdn:    normalizeName(c.Fqdn),
+			content: c.Content,
+			tID:     c.TID,
+			changed: changedOn(c.CreatedOn, c.UpdatedOn),
+		})
+	}
+
+	return records, parents, nil
+}
+
+// Used to delete a record whose token does not exist from route53 and the database
+func (b *Backend) repairNoToken(rec *dbRecord, sets []*route53.ResourceRecordSet) error {
+	if err := b.changeRecords(rec.fqdn, deleteChanges(sets)); err != nil {
+		return err
+	}
+
+	return b.deleteRecordFromDatabase(&route53.ResourceRecordSet{Name: aws.String(rec.fqdn)}, rec.rType, rec.kind == kindSub)
+}
+
+// Used to add a record which only exists in route53 to the database, or delete it from route53 when it has no token
+func (b *Backend) repairRoute53Only(kind, name string, rrs *route53.ResourceRecordSet, sets []*route53.ResourceRecordSet, token *model.Token, parent *model.RecordA) error {
+	rType := aws.StringValue(rrs.Type)
+
+	if token != nil {
+		switch {
+		case kind == kindSub && parent != nil:
+			_, err := b.setRecordToDatabase(withName(rrs, name), rType, 0, parent.ID, true)
+			return err
+		case kind != kindSub:
+			_, err := b.setRecordToDatabase(withName(rrs, name), rType, token.ID, 0, false)
+			return err
+		}
+	}
+
+	return b.changeRecords(name, deleteChanges(sets))
+}
+
+// Used to check whether a record exists in the database
+func (b *Backend) existsInDatabase(kind, name string) bool {
+	var (
+		fqdn string
+		err  error
+	)
+
+	switch kind {
+	case kindA:
+		var r *model.RecordA
+		if r, err = database.GetDatabase().QueryA(name); r != nil {
+			fqdn = r.Fqdn
+		}
+	case kindSub:
+		var r *model.SubRecordA
+		if r, err = database.GetDatabase().QuerySubA(name); r != nil {
+			fqdn = r.Fqdn
+		}
+	case kindTXT:
+		var r *model.RecordTXT
+		if r, err = database.GetDatabase().QueryTXT(name); r != nil {
+			fqdn = r.Fqdn
+		}
+	case kindCNAME:
+		var r *model.RecordCNAME
+		if r, err = database.GetDatabase().QueryCNAME(name); r != nil {
+			fqdn = r.Fqdn
+		}
+	}
+
+	if err != nil && err != sql.ErrNoRows {
+		logrus.Debugf("failed to query %s record %s: %v", kind, name, err)
+	}
+
+	return fqdn != ""
+}
+
+// Used to find the domain of a record name
+// e.g. _acme-challenge.x1.sample.lb.rancher.cloud => sample.lb.rancher.cloud
+func (b *Backend) rootOf(name string) string {
+	zone := strings.ToLower(b.Zone)
+	if !strings.HasSuffix(name, "."+zone) {
+		return ""
+	}
+
+	labels := strings.Split(strings.TrimSuffix(name, "."+zone), ".")
+	return labels[len(labels)-1] + "." + zone
+}
+
+// Used to find the kind of a record set, A records other than the domain and its wildcard are sub domain records
+func recordKind(rType, name, root string) string {
+	switch rType {
+	case typeTXT:
+		return kindTXT
+	case typeCNAME:
+		return kindCNAME
+	}
+	if name == root || name == `\052.`+root {
+		return kindA
+	}
+	return kindSub
+}
+
+func recordKey(rType, name string) string {
+	return rType + " " + name
+}
+
+// Used to normalize a record name as the database preferred
+// e.g. \052.Sample.lb.rancher.cloud. => \052.sample.lb.rancher.cloud
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimRight(name, "."))
+}
+
+// Used to get the values of a record set as the database preferred, sorted and comma separated
+func recordValues(rrs *route53.ResourceRecordSet) string {
+	values := make([]string, 0, len(rrs.ResourceRecords))
+	for _, rr := range rrs.ResourceRecords {
+		values = append(values, aws.StringValue(rr.Value))
+	}
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+// Used to sort the comma separated values of a database record
+func normalizeValues(content string) string {
+	if content == "" {
+		return ""
+	}
+	values := strings.Split(content, ",")
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+// Used to copy a record set with the name of the database record
+func withName(rrs *route53.ResourceRecordSet, name string) *route53.ResourceRecordSet {
+	c := *rrs
+	c.Name = aws.String(name)
+	return &c
+}
+
+func changedOn(created int64, updated sql.NullInt64) int64 {
+	if updated.Valid && updated.Int64 > created {
+		return updated.Int64
+	}
+	return created
+}
@@ -0,0 +1,104 @@
+package route53
+
+import (
+	"sort"
+
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/pkg/errors"
+)
+
+// Used to check the regions of the hosts of a domain, the regions are the aws regions of the latency records.
+// Every host of a regional domain needs a region and the hosts can not be weighted as well, route53 can not
+// mix the latency and weighted record sets of a name
+func validateRegions(opts *model.DomainOptions) error {
+	if len(opts.Regions) <= 0 {
+		return nil
+	}
+	if len(opts.Weights) > 0 {
+		return errors.Errorf(errWeightedRegions, opts.Fqdn)
+	}
+
+	known := make(map[string]bool)
+	for _, p := range endpoints.DefaultPartitions() {
+		for id := range p.Regions() {
+			known[id] = true
+		}
+	}
+
+	for _, h := range opts.Hosts {
+		r, ok := opts.Regions[h]
+		if !ok {
+			return errors.Errorf(errMissingRegion, h, opts.Fqdn)
+		}
+		if !known[r] {
+			return errors.Errorf(errInvalidRegion, r, opts.Fqdn)
+		}
+	}
+
+	return nil
+}
+
+// Used to build the latency record sets of a name, one for each region of the hosts and identified by the region
+func (b *Backend) regionSets(name string, hosts []string, regions map[string]string) []*route53.ResourceRecordSet {
+	grouped := make(map[string][]string)
+	for _, h := range hosts {
+		grouped[regions[h]] = append(grouped[regions[h]], h)
+	}
+
+	names := make([]string, 0, len(grouped))
+	for r := range grouped {
+		names = append(names, r)
+	}
+	sort.Strings(names)
+
+	sets := make([]*route53.ResourceRecordSet, 0, len(names))
+	for _, r := range names {
+		sets = append(sets, &route53.ResourceRecordSet{
+			Name:            aws.String(name),
+			Type:            aws.String(typeA),
+			SetIdentifier:   aws.String(r),
+			Region:          aws.String(r),
+			ResourceRecords: toResourceRecords(grouped[r]),
+			TTL:             aws.Int64(b.TTL),
+		})
+	}
+	return sets
+}
+
+// Used to set or delete the regions of the hosts of a domain, returns the regions of the hosts,
+// nil when the domain is not regional
+func (b *Backend) saveRegions(opts *model.DomainOptions, tID int64) (map[string]string, error) {
+	regions := model.HostRegions(opts.Hosts, opts.Regions)
+	if regions == nil {
+		return nil, deleteOption(opts.Fqdn, model.OptionHostRegion)
+	}
+
+	if err := saveOption(opts.Fqdn, model.OptionHostRegion, regions, tID); err != nil {
+		return nil, err
+	}
+	return regions, nil
+}
+
+// Used to get the regions of the hosts of a domain, returns nil when the domain is not regional
+func (b *Backend) getRegions(fqdn string) (map[string]string, error) {
+	regions := make(map[string]string)
+	ok, err := getOption(fqdn, model.OptionHostRegion, &regions)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return regions, nil
+}
+
+// Used to get the hosts of a regional domain, sorted
+func regionalHosts(regions map[string]string) []string {
+	hosts := make([]string, 0, len(regions))
+	for h := range regions {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
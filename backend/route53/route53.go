@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/rancher/rdns-server/backend"
 	"github.com/rancher/rdns-server/database"
 	"github.com/rancher/rdns-server/model"
 	"github.com/rancher/rdns-server/util"
@@ -28,10 +29,16 @@ const (
 	maxSlugHashTimes = 100
 	slugLength       = 6
 	tokenLength      = 32
+
+	// route53 accepts at most 1000 changes in one change batch
+	maxChangesPerBatch = 500
 )
 
 type Backend struct {
 	LeaseTime time.Duration
+	Frozen    time.Duration
+	Grace     time.Duration
+	Parking   string
 	Zone      string
 	ZoneID    string
 	TTL       int64
@@ -69,8 +76,24 @@ func NewBackend() (*Backend, error) {
 		return &Backend{}, errors.Wrapf(err, errParseFlag, "ttl")
 	}
 
+	frozen, err := time.ParseDuration(os.Getenv("FROZEN"))
+	if err != nil {
+		return &Backend{}, errors.Wrapf(err, errParseFlag, "frozen")
+	}
+
+	var grace time.Duration
+	if v := os.Getenv("GRACE_PERIOD"); v != "" {
+		grace, err = time.ParseDuration(v)
+		if err != nil {
+			return &Backend{}, errors.Wrapf(err, errParseFlag, "grace_period")
+		}
+	}
+
 	return &Backend{
 		LeaseTime: d,
+		Frozen:    frozen,
+		Grace:     grace,
+		Parking:   os.Getenv("PARKING_ADDRESS"),
 		Zone:      strings.TrimRight(aws.StringValue(z.HostedZone.Name), "."),
 		ZoneID:    aws.StringValue(z.HostedZone.Id),
 		Svc:       svc,
@@ -95,6 +118,11 @@ func (b *Backend) Get(opts *model.DomainOptions) (d model.Domain, err error) {
 		return d, errors.Wrapf(err, errQueryTokenFromDatabase, opts.Fqdn)
 	}
 
+	// route53 only holds the parking records of a suspended domain
+	if token.SuspendedOn.Valid {
+		return b.getSuspended(opts, token)
+	}
+
 	records, err := b.getRecords(opts, typeA)
 	if err != nil {
 		return d, err
@@ -125,9 +153,9 @@ func (b *Backend) Get(opts *model.DomainOptions) (d model.Domain, err error) {
 
 		d.Fqdn = opts.Fqdn
 		d.Hosts = strings.Split(e.Content, ",")
-		d.Expiration = convertExpiration(time.Unix(0, token.CreatedOn), int(b.LeaseTime.Nanoseconds()))
+		b.setState(&d, token)
 
-		return d, nil
+		return d, b.setDetails(&d)
 	}
 
 	// convert A & sub domain records to map
@@ -136,35 +164,53 @@ func (b *Backend) Get(opts *model.DomainOptions) (d model.Domain, err error) {
 	d.Fqdn = opts.Fqdn
 	d.Hosts = ca[opts.Fqdn]
 	d.SubDomain = cs
-	d.Expiration = convertExpiration(time.Unix(0, token.CreatedOn), int(b.LeaseTime.Nanoseconds()))
+	b.setState(&d, token)
 
-	return d, nil
+	return d, b.setDetails(&d)
 }
 
 func (b *Backend) Set(opts *model.DomainOptions) (d model.Domain, err error) {
 	logrus.Debugf("set A record for domain options: %s", opts.String())
 
-	for i := 0; i < maxSlugHashTimes; i++ {
-		fqdn := fmt.Sprintf("%s.%s", generateSlug(), b.Zone)
+	if err := validateRegions(opts); err != nil {
+		return d, err
+	}
 
-		// check whether this slug name can be used or not, if not found the slug name is valid, others not valid
-		r, err := database.GetDatabase().QueryFrozen(strings.Split(fqdn, ".")[0])
-		if err != nil && err != sql.ErrNoRows {
+	if opts.Normal {
+		fqdn, err := b.checkNormalName(opts.Fqdn, b.Get)
+		if err != nil {
 			return d, err
 		}
-		if r != "" {
-			logrus.Debugf(errNotValidGenerateName, strings.Split(fqdn, ".")[0])
-			continue
-		}
+		opts.Fqdn = fqdn
+	} else {
+		opts.Fqdn = ""
+		for i := 0; i < maxSlugHashTimes; i++ {
+			slug := generateSlug()
+			if backend.IsReserved(slug) {
+				logrus.Debugf(errReservedGenerateName, slug)
+				continue
+			}
+			fqdn := fmt.Sprintf("%s.%s", slug, b.Zone)
 
-		o := &model.DomainOptions{
-			Fqdn: fqdn,
-		}
+			// check whether this slug name can be used or not, if not found the slug name is valid, others not valid
+			r, err := database.GetDatabase().QueryFrozen(strings.Split(fqdn, ".")[0])
+			if err != nil && err != sql.ErrNoRows {
+				return d, err
+			}
+			if r != "" {
+				logrus.Debugf(errNotValidGenerateName, strings.Split(fqdn, ".")[0])
+				continue
+			}
 
-		d, err := b.Get(o)
-		if err != nil || d.Fqdn == "" {
-			opts.Fqdn = fqdn
-			break
+			o := &model.DomainOptions{
+				Fqdn: fqdn,
+			}
+
+			d, err := b.Get(o)
+			if err != nil || d.Fqdn == "" {
+				opts.Fqdn = fqdn
+				break
+			}
 		}
 	}
 
@@ -173,8 +219,8 @@ func (b *Backend) Set(opts *model.DomainOptions) (d model.Domain, err error) {
 	}
 
 	// save the slug name to the database in case of the name will be re-generate
-	if err := database.GetDatabase().InsertFrozen(strings.Split(opts.Fqdn, ".")[0]); err != nil {
-		return d, errors.Wrapf(err, errInsertFrozenToDatabase, strings.Split(opts.Fqdn, ".")[0])
+	if err := b.insertFrozen(strings.Split(opts.Fqdn, ".")[0]); err != nil {
+		return d, err
 	}
 
 	// save token to the database
@@ -199,21 +245,22 @@ func (b *Backend) Set(opts *model.DomainOptions) (d model.Domain, err error) {
 		return d, errors.Wrapf(err, errInsertRecordToDatabase, typeA, aws.StringValue(rrs.Name))
 	}
 
-	// set A and wildcard A record
-	rr := make([]*route53.ResourceRecord, 0)
-	for _, h := range opts.Hosts {
-		rr = append(rr, &route53.ResourceRecord{
-			Value: aws.String(h),
-		})
+	// save the health check, the weights and the regions, the hosts of a new domain start healthy
+	hs, err := b.setHealthCheck(opts, tID)
+	if err != nil {
+		return d, err
 	}
-	rrs.Name = aws.String(opts.Fqdn)
-	rrs.ResourceRecords = rr
-	if _, err := b.setRecord(rrs, opts, typeA, tID, pID, false); err != nil {
+	weights, err := b.saveWeights(opts, tID)
+	if err != nil {
+		return d, err
+	}
+	regions, err := b.saveRegions(opts, tID)
+	if err != nil {
 		return d, err
 	}
 
-	rrs.Name = aws.String(fmt.Sprintf("\\052.%s", opts.Fqdn))
-	if _, err := b.setRecord(rrs, opts, typeA, tID, pID, false); err != nil {
+	// set A and wildcard A record
+	if err := b.setHosts(opts, servedHosts(opts, hs), weights, regions, tID, pID); err != nil {
 		return d, err
 	}
 
@@ -244,6 +291,14 @@ func (b *Backend) Set(opts *model.DomainOptions) (d model.Domain, err error) {
 func (b *Backend) Update(opts *model.DomainOptions) (d model.Domain, err error) {
 	logrus.Debugf("update A record for domain options: %s", opts.String())
 
+	if err := validateRegions(opts); err != nil {
+		return d, err
+	}
+
+	if err := b.checkSuspended(opts.Fqdn); err != nil {
+		return d, err
+	}
+
 	records, err := b.getRecords(opts, typeA)
 	if err != nil {
 		return d, err
@@ -251,34 +306,36 @@ func (b *Backend) Update(opts *model.DomainOptions) (d model.Domain, err error)
 
 	_, a, s, _, _ := b.filterRecords(records.ResourceRecordSets, opts, typeA)
 
-	// convert A & sub domain records to map
-	as, cs := b.convertARecords(a, s)
-
-	rr := make([]*route53.ResourceRecord, 0)
-	for _, h := range opts.Hosts {
-		rr = append(rr, &route53.ResourceRecord{
-			Value: aws.String(h),
-		})
-	}
-
-	rrs := &route53.ResourceRecordSet{
-		Type:            aws.String(typeA),
-		Name:            aws.String(opts.Fqdn),
-		ResourceRecords: rr,
-		TTL:             aws.Int64(int64(b.TTL)),
-	}
+	// convert sub domain records to map
+	_, cs := b.convertARecords(a, s)
 
 	e, err := database.GetDatabase().QueryA(fmt.Sprintf("empty.%s", opts.Fqdn))
 	if err != nil || e.Fqdn == "" {
 		return d, errors.Wrapf(err, errQueryAFromDatabase, opts.Fqdn)
 	}
 
-	// update A and wildcard A records
-	if _, err := b.setRecord(rrs, opts, typeA, e.TID, e.ID, false); err != nil {
+	if opts.SignedOnly != nil {
+		if err := b.signToken(opts.Fqdn, *opts.SignedOnly); err != nil {
+			return d, err
+		}
+	}
+
+	// update the health check, the weights and the regions, the hosts which are still in the domain keep their health
+	hs, err := b.setHealthCheck(opts, e.TID)
+	if err != nil {
 		return d, err
 	}
-	rrs.Name = aws.String(fmt.Sprintf("\\052.%s", opts.Fqdn))
-	if _, err := b.setRecord(rrs, opts, typeA, e.TID, e.ID, false); err != nil {
+	weights, err := b.saveWeights(opts, e.TID)
+	if err != nil {
+		return d, err
+	}
+	regions, err := b.saveRegions(opts, e.TID)
+	if err != nil {
+		return d, err
+	}
+
+	// update A and wildcard A records
+	if err := b.setHosts(opts, servedHosts(opts, hs), weights, regions, e.TID, e.ID); err != nil {
 		return d, err
 	}
 
@@ -303,28 +360,9 @@ func (b *Backend) Update(opts *model.DomainOptions) (d model.Domain, err error)
 		}
 	}
 
-	// delete useless domain A records
+	// delete useless domain A records, a weighted domain has a record set for each host
 	if len(opts.Hosts) <= 0 {
-		name := opts.Fqdn
-		if _, ok := as[name]; ok {
-			rr := make([]*route53.ResourceRecord, 0)
-			for _, h := range as[name] {
-				rr = append(rr, &route53.ResourceRecord{
-					Value: aws.String(h),
-				})
-			}
-
-			rrs := &route53.ResourceRecordSet{
-				Name:            aws.String(name),
-				Type:            aws.String(typeA),
-				ResourceRecords: rr,
-				TTL:             aws.Int64(int64(b.TTL)),
-			}
-
-			if err := b.deleteRecord(rrs, opts, typeA, true); err != nil {
-				return d, err
-			}
-			rrs.Name = aws.String(fmt.Sprintf("\\052.%s", opts.Fqdn))
+		for _, rrs := range a {
 			if err := b.deleteRecord(rrs, opts, typeA, true); err != nil {
 				return d, err
 			}
@@ -390,6 +428,11 @@ func (b *Backend) Delete(opts *model.DomainOptions) error {
 		return errors.Wrapf(err, errDeleteAFromDatabase, emptyName)
 	}
 
+	// delete health check, weights and regions from database
+	if err := database.GetDatabase().DeleteDomainOptions(opts.Fqdn); err != nil {
+		return errors.Wrapf(err, errDeleteOptionsFromDatabase, opts.Fqdn)
+	}
+
 	return nil
 }
 
@@ -401,7 +444,15 @@ func (b *Backend) Renew(opts *model.DomainOptions) (d model.Domain, err error) {
 	if err != nil {
 		return d, errors.Wrapf(err, errQueryTokenFromDatabase, opts.Fqdn)
 	}
-	_, _, err = database.GetDatabase().RenewToken(t.Fqdn)
+
+	// restore the records of a suspended domain before it is active again
+	if t.SuspendedOn.Valid {
+		if err := b.resume(opts); err != nil {
+			return d, err
+		}
+	}
+
+	_, renewed, err := database.GetDatabase().RenewToken(t.Fqdn)
 	if err != nil {
 		return d, errors.Wrapf(err, errRenewTokenFromDatabase, opts.Fqdn)
 	}
@@ -413,34 +464,175 @@ func (b *Backend) Renew(opts *model.DomainOptions) (d model.Domain, err error) {
 
 	return model.Domain{
 		Fqdn:       opts.Fqdn,
-		Expiration: convertExpiration(time.Unix(0, t.CreatedOn), int(b.LeaseTime.Nanoseconds())),
+		Expiration: convertExpiration(time.Unix(0, renewed), int(b.leaseTimeOf(t).Nanoseconds())),
+		State:      model.StateActive,
 	}, nil
 }
 
-func (b *Backend) SetCNAME(opts *model.DomainOptions) (d model.Domain, err error) {
-	logrus.Debugf("set CNAME record for domain options: %s", opts.String())
+func (b *Backend) Suspend(opts *model.DomainOptions) error {
+	logrus.Debugf("suspend records for domain options: %s", opts.String())
+
+	t, err := database.GetDatabase().QueryToken(opts.Fqdn)
+	if err != nil {
+		return errors.Wrapf(err, errQueryTokenFromDatabase, opts.Fqdn)
+	}
+	if t.SuspendedOn.Valid {
+		return nil
+	}
 
-	for i := 0; i < maxSlugHashTimes; i++ {
-		fqdn := fmt.Sprintf("%s.%s", generateSlug(), b.Zone)
+	aRecords, err := b.getRecords(opts, typeA)
+	if err != nil {
+		return err
+	}
+	_, a, s, _, _ := b.filterRecords(aRecords.ResourceRecordSets, opts, typeA)
 
-		// check whether this slug name can be used or not, if not found the slug name is valid, others not valid
-		r, err := database.GetDatabase().QueryFrozen(strings.Split(fqdn, ".")[0])
-		if err != nil && err != sql.ErrNoRows {
-			return d, err
+	cRecords, err := b.getRecords(opts, typeCNAME)
+	if err != nil {
+		return err
+	}
+	_, _, _, _, c := b.filterRecords(cRecords.ResourceRecordSets, opts, typeCNAME)
+
+	// replace A, sub domain A and CNAME records with the parking address, or remove them to answer NXDOMAIN,
+	// the records are still kept in the database, so that they can be restored by renew
+	changes := make([]*route53.Change, 0)
+	parked := make(map[string]bool)
+	for _, rrs := range append(append(a, s...), c...) {
+		changes = append(changes, &route53.Change{
+			Action:            aws.String("DELETE"),
+			ResourceRecordSet: rrs,
+		})
+		// the weighted or latency record sets of a name are parked by one record set
+		if b.Parking != "" && !parked[aws.StringValue(rrs.Name)] {
+			parked[aws.StringValue(rrs.Name)] = true
+			changes = append(changes, &route53.Change{
+				Action: aws.String("CREATE"),
+				ResourceRecordSet: &route53.ResourceRecordSet{
+					Name: rrs.Name,
+					Type: aws.String(typeA),
+					ResourceRecords: []*route53.ResourceRecord{
+						{
+							Value: aws.String(b.Parking),
+						},
+					},
+					TTL: aws.Int64(b.TTL),
+				},
+			})
+		}
+	}
+
+	if err := b.changeRecords(opts.Fqdn, changes); err != nil {
+		return err
+	}
+
+	if err := database.GetDatabase().SuspendToken(t.Fqdn); err != nil {
+		return errors.Wrapf(err, errSuspendTokenFromDatabase, opts.Fqdn)
+	}
+
+	return nil
+}
+
+// PurgeRecords deletes the route53 records of expired domains in batched change sets and returns the tokens
+// whose records are deleted, the database records are deleted with the tokens.
+// A change batch is applied as a whole, so all domains of a failed batch are reported as failures.
+func (b *Backend) PurgeRecords(tokens []*model.Token, dryRun bool, r *model.PurgeReport) []*model.Token {
+	purged := make([]*model.Token, 0)
+	batch := make([]*route53.Change, 0)
+	pending := make([]*model.Token, 0)
+	pendingChanges := make([][]*route53.Change, 0)
+
+	flush := func() {
+		defer func() {
+			batch = make([]*route53.Change, 0)
+			pending = make([]*model.Token, 0)
+			pendingChanges = make([][]*route53.Change, 0)
+		}()
+
+		if len(batch) <= 0 || dryRun {
+			r.Records += len(batch)
+			purged = append(purged, pending...)
+			return
+		}
+
+		err := b.changeRecords(fmt.Sprintf("%d expired domains", len(pending)), batch)
+		if err == nil {
+			r.Records += len(batch)
+			purged = append(purged, pending...)
+			return
+		}
+		if len(pending) == 1 {
+			r.AddFailure(pending[0].Fqdn, model.PurgeActionPurge, err)
+			return
+		}
+
+		// a change batch fails as a whole, the changes of each domain are retried on their own
+		// so that only the domains whose changes fail are reported
+		logrus.Warnf("failed to purge %d expired domains in one batch, retrying each domain: %v", len(pending), err)
+		for i, t := range pending {
+			if err := b.changeRecords(t.Fqdn, pendingChanges[i]); err != nil {
+				r.AddFailure(t.Fqdn, model.PurgeActionPurge, err)
+				continue
+			}
+			r.Records += len(pendingChanges[i])
+			purged = append(purged, t)
 		}
-		if r != "" {
-			logrus.Debugf(errNotValidGenerateName, strings.Split(fqdn, ".")[0])
+	}
+
+	for _, t := range tokens {
+		changes, err := b.purgeChanges(t)
+		if err != nil {
+			r.AddFailure(t.Fqdn, model.PurgeActionPurge, err)
 			continue
 		}
+		if len(batch)+len(changes) > maxChangesPerBatch {
+			flush()
+		}
+		batch = append(batch, changes...)
+		pending = append(pending, t)
+		pendingChanges = append(pendingChanges, changes)
+	}
+	flush()
 
-		o := &model.DomainOptions{
-			Fqdn: fqdn,
+	return purged
+}
+
+func (b *Backend) SetCNAME(opts *model.DomainOptions) (d model.Domain, err error) {
+	logrus.Debugf("set CNAME record for domain options: %s", opts.String())
+
+	if opts.Normal {
+		fqdn, err := b.checkNormalName(opts.Fqdn, b.GetCNAME)
+		if err != nil {
+			return d, err
 		}
+		opts.Fqdn = fqdn
+	} else {
+		opts.Fqdn = ""
+		for i := 0; i < maxSlugHashTimes; i++ {
+			slug := generateSlug()
+			if backend.IsReserved(slug) {
+				logrus.Debugf(errReservedGenerateName, slug)
+				continue
+			}
+			fqdn := fmt.Sprintf("%s.%s", slug, b.Zone)
+
+			// check whether this slug name can be used or not, if not found the slug name is valid, others not valid
+			r, err := database.GetDatabase().QueryFrozen(strings.Split(fqdn, ".")[0])
+			if err != nil && err != sql.ErrNoRows {
+				return d, err
+			}
+			if r != "" {
+				logrus.Debugf(errNotValidGenerateName, strings.Split(fqdn, ".")[0])
+				continue
+			}
+
+			o := &model.DomainOptions{
+				Fqdn: fqdn,
+			}
 
-		d, err := b.GetCNAME(o)
-		if err != nil || d.Fqdn == "" {
-			opts.Fqdn = fqdn
-			break
+			d, err := b.GetCNAME(o)
+			if err != nil || d.Fqdn == "" {
+				opts.Fqdn = fqdn
+				break
+			}
 		}
 	}
 
@@ -449,8 +641,8 @@ func (b *Backend) SetCNAME(opts *model.DomainOptions) (d model.Domain, err error
 	}
 
 	// save the slug name to the database in case of the name will be re-generate
-	if err := database.GetDatabase().InsertFrozen(strings.Split(opts.Fqdn, ".")[0]); err != nil {
-		return d, errors.Wrapf(err, errInsertFrozenToDatabase, strings.Split(opts.Fqdn, ".")[0])
+	if err := b.insertFrozen(strings.Split(opts.Fqdn, ".")[0]); err != nil {
+		return d, err
 	}
 
 	// save token to the database
@@ -487,6 +679,26 @@ func (b *Backend) SetCNAME(opts *model.DomainOptions) (d model.Domain, err error
 func (b *Backend) GetCNAME(opts *model.DomainOptions) (d model.Domain, err error) {
 	logrus.Debugf("get CNAME record for domain options: %s", opts.String())
 
+	// get token from database
+	token, err := database.GetDatabase().QueryToken(b.findSlugWithZone(opts.Fqdn))
+	if err != nil {
+		return d, errors.Wrapf(err, errQueryTokenFromDatabase, opts.Fqdn)
+	}
+
+	// route53 only holds the parking records of a suspended domain
+	if token.SuspendedOn.Valid {
+		r, err := database.GetDatabase().QueryCNAME(opts.Fqdn)
+		if err != nil || r.Fqdn == "" {
+			return d, errors.Wrapf(err, errQueryCNAMEFromDatabase, opts.Fqdn)
+		}
+
+		d.Fqdn = opts.Fqdn
+		d.CNAME = r.Content
+		b.setState(&d, token)
+
+		return d, nil
+	}
+
 	records, err := b.getRecords(opts, typeCNAME)
 	if err != nil {
 		return d, err
@@ -497,15 +709,9 @@ func (b *Backend) GetCNAME(opts *model.DomainOptions) (d model.Domain, err error
 		return d, errors.Errorf(errFilterRecords, typeCNAME, opts.Fqdn)
 	}
 
-	// get token from database
-	token, err := database.GetDatabase().QueryToken(b.findSlugWithZone(opts.Fqdn))
-	if err != nil {
-		return d, errors.Wrapf(err, errQueryTokenFromDatabase, opts.Fqdn)
-	}
-
 	d.Fqdn = opts.Fqdn
 	d.CNAME = aws.StringValue(c[0].ResourceRecords[0].Value)
-	d.Expiration = convertExpiration(time.Unix(0, token.CreatedOn), int(b.LeaseTime.Nanoseconds()))
+	b.setState(&d, token)
 
 	return d, nil
 }
@@ -513,6 +719,10 @@ func (b *Backend) GetCNAME(opts *model.DomainOptions) (d model.Domain, err error
 func (b *Backend) UpdateCNAME(opts *model.DomainOptions) (d model.Domain, err error) {
 	logrus.Debugf("update CNAME record for domain options: %s", opts.String())
 
+	if err := b.checkSuspended(opts.Fqdn); err != nil {
+		return d, err
+	}
+
 	records, err := b.getRecords(opts, typeCNAME)
 	if err != nil {
 		return d, err
@@ -527,6 +737,12 @@ func (b *Backend) UpdateCNAME(opts *model.DomainOptions) (d model.Domain, err er
 		return d, errors.Wrapf(err, errQueryCNAMEFromDatabase, opts.Fqdn)
 	}
 
+	if opts.SignedOnly != nil {
+		if err := b.signToken(opts.Fqdn, *opts.SignedOnly); err != nil {
+			return d, err
+		}
+	}
+
 	rrs := &route53.ResourceRecordSet{
 		Name: aws.String(opts.Fqdn),
 		Type: aws.String(typeCNAME),
@@ -556,7 +772,7 @@ func (b *Backend) UpdateCNAME(opts *model.DomainOptions) (d model.Domain, err er
 
 	d.Fqdn = opts.Fqdn
 	d.CNAME = opts.CNAME
-	d.Expiration = convertExpiration(time.Unix(0, token.CreatedOn), int(b.LeaseTime.Nanoseconds()))
+	b.setState(&d, token)
 
 	return d, nil
 }
@@ -564,6 +780,11 @@ func (b *Backend) UpdateCNAME(opts *model.DomainOptions) (d model.Domain, err er
 func (b *Backend) DeleteCNAME(opts *model.DomainOptions) error {
 	logrus.Debugf("delete CNAME record for domain options: %s", opts.String())
 
+	token, err := database.GetDatabase().QueryToken(b.findSlugWithZone(opts.Fqdn))
+	if err == nil && token.SuspendedOn.Valid {
+		return b.deleteSuspendedCNAME(opts)
+	}
+
 	records, err := b.getRecords(opts, typeCNAME)
 	if err != nil {
 		return err
@@ -604,7 +825,7 @@ func (b *Backend) GetText(opts *model.DomainOptions) (d model.Domain, err error)
 
 	d.Fqdn = opts.Fqdn
 	d.Text = strings.Trim(aws.StringValue(t[0].ResourceRecords[0].Value), "\"")
-	d.Expiration = convertExpiration(time.Unix(0, token.CreatedOn), int(b.LeaseTime.Nanoseconds()))
+	d.Expiration = convertExpiration(time.Unix(0, token.CreatedOn), int(b.leaseTimeOf(token).Nanoseconds()))
 
 	return d, nil
 }
@@ -685,7 +906,7 @@ func (b *Backend) UpdateText(opts *model.DomainOptions) (d model.Domain, err err
 	d.Fqdn = opts.Fqdn
 	d.Hosts = opts.Hosts
 	d.Text = opts.Text
-	d.Expiration = convertExpiration(time.Unix(0, token.CreatedOn), int(b.LeaseTime.Nanoseconds()))
+	d.Expiration = convertExpiration(time.Unix(0, token.CreatedOn), int(b.leaseTimeOf(token).Nanoseconds()))
 
 	return d, nil
 }
@@ -730,7 +951,137 @@ func (b *Backend) SetToken(opts *model.DomainOptions, exist bool) (int64, error)
 		return id, err
 	}
 
-	return database.GetDatabase().InsertToken(generateToken(), opts.Fqdn)
+	// the token keeps the default lease time unless a lease time is requested
+	lease, err := backend.LeaseTime(opts, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := database.GetDatabase().InsertToken(generateToken(), opts.Fqdn, lease)
+	if err != nil || opts.SignedOnly == nil || !*opts.SignedOnly {
+		return id, err
+	}
+
+	return id, b.signToken(opts.Fqdn, true)
+}
+
+// RequiresSignature returns whether a domain only accepts signed requests.
+func (b *Backend) RequiresSignature(fqdn string) (bool, error) {
+	t, err := database.GetDatabase().QueryToken(fqdn)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, errQueryTokenFromDatabase, fqdn)
+	}
+	return t.SignedOnly, nil
+}
+
+// Used to set whether a domain only accepts signed requests
+func (b *Backend) signToken(fqdn string, signed bool) error {
+	if err := database.GetDatabase().SignToken(fqdn, signed); err != nil {
+		return errors.Wrapf(err, errSignTokenToDatabase, fqdn)
+	}
+	return nil
+}
+
+func (b *Backend) ListFrozen(prefix string) ([]model.Frozen, error) {
+	fs, err := database.GetDatabase().ListFrozen(prefix)
+	if err != nil {
+		return nil, errors.Wrapf(err, errQueryFrozenFromDatabase, prefix)
+	}
+
+	result := make([]model.Frozen, 0, len(fs))
+	for _, f := range fs {
+		result = append(result, b.toFrozen(f.Prefix, f.CreatedOn))
+	}
+
+	return result, nil
+}
+
+func (b *Backend) AddFrozen(opts *model.FrozenOptions) (f model.Frozen, err error) {
+	logrus.Debugf("add frozen prefix for options: %s", opts.String())
+
+	if err := backend.ValidateLabelSyntax(opts.Prefix); err != nil {
+		return f, err
+	}
+
+	d, err := opts.GetDuration(b.Frozen)
+	if err != nil {
+		return f, err
+	}
+
+	// the prefix expires when created_on + frozen is reached
+	createdOn := time.Now().Add(d - b.Frozen).UnixNano()
+	if err := database.GetDatabase().InsertFrozenOn(opts.Prefix, createdOn); err != nil {
+		if r, _ := database.GetDatabase().QueryFrozen(opts.Prefix); r != "" {
+			return f, backend.NewNameTakenError(opts.Prefix)
+		}
+		return f, errors.Wrapf(err, errInsertFrozenToDatabase, opts.Prefix)
+	}
+
+	return b.toFrozen(opts.Prefix, createdOn), nil
+}
+
+func (b *Backend) ExtendFrozen(opts *model.FrozenOptions) (f model.Frozen, err error) {
+	logrus.Debugf("extend frozen prefix for options: %s", opts.String())
+
+	r, err := database.GetDatabase().QueryFrozenPrefix(opts.Prefix)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return f, backend.NewNotFrozenError(opts.Prefix)
+		}
+		return f, errors.Wrapf(err, errQueryFrozenFromDatabase, opts.Prefix)
+	}
+
+	d, err := opts.GetDuration(b.Frozen)
+	if err != nil {
+		return f, err
+	}
+
+	// a prefix which is expired but not purged yet is extended from now
+	createdOn := r.CreatedOn
+	if now := time.Now().Add(-b.Frozen).UnixNano(); createdOn < now {
+		createdOn = now
+	}
+	createdOn += d.Nanoseconds()
+
+	if err := database.GetDatabase().UpdateFrozen(opts.Prefix, createdOn); err != nil {
+		return f, errors.Wrapf(err, errRenewFrozenFromDatabase, opts.Prefix)
+	}
+
+	return b.toFrozen(opts.Prefix, createdOn), nil
+}
+
+func (b *Backend) ReleaseFrozen(prefix string) error {
+	logrus.Debugf("release frozen prefix: %s", prefix)
+
+	r, err := database.GetDatabase().QueryFrozen(prefix)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrapf(err, errQueryFrozenFromDatabase, prefix)
+	}
+	if r == "" {
+		return backend.NewNotFrozenError(prefix)
+	}
+
+	// the prefix of an active or suspended domain can not be released, otherwise it can be used twice
+	fqdn := fmt.Sprintf("%s.%s", prefix, b.Zone)
+	if _, err := database.GetDatabase().QueryToken(fqdn); err == nil {
+		return backend.NewNameInUseError(prefix)
+	} else if err != sql.ErrNoRows {
+		return errors.Wrapf(err, errQueryTokenFromDatabase, fqdn)
+	}
+
+	if err := database.GetDatabase().DeleteFrozen(prefix); err != nil {
+		return errors.Wrapf(err, errDeleteFrozenFromDatabase, prefix)
+	}
+
+	return nil
+}
+
+// ListDS is not supported, the signing of a route53 hosted zone is managed by route53
+func (b *Backend) ListDS() ([]model.DS, error) {
+	return nil, errors.Errorf(errNotSupportDNSSEC, Name)
 }
 
 func (b *Backend) MigrateFrozen(opts *model.MigrateFrozen) error {
@@ -738,7 +1089,7 @@ func (b *Backend) MigrateFrozen(opts *model.MigrateFrozen) error {
 }
 
 func (b *Backend) MigrateToken(opts *model.MigrateToken) error {
-	return database.GetDatabase().MigrateToken(opts.Token, opts.Path, opts.Expiration.UnixNano())
+	return database.GetDatabase().MigrateToken(opts.Token, opts.Fqdn(), opts.Expiration.UnixNano())
 }
 
 func (b *Backend) MigrateRecord(opts *model.MigrateRecord) error {
@@ -756,12 +1107,18 @@ func (b *Backend) MigrateRecord(opts *model.MigrateRecord) error {
 			Fqdn:      opts.Fqdn,
 			Hosts:     opts.Hosts,
 			SubDomain: opts.SubDomain,
+			Weights:   opts.Weights,
+			Regions:   opts.Regions,
 		}
 		t, err := database.GetDatabase().QueryToken(b.findSlugWithZone(dopts.Fqdn))
 		if err != nil {
 			return errors.Wrapf(err, errQueryTokenFromDatabase, dopts.Fqdn)
 		}
 
+		if err := b.signToken(t.Fqdn, opts.SignedOnly); err != nil {
+			return err
+		}
+
 		// set empty A record, sometimes we need to hold domain records although domain has no hosts value
 		rrs := &route53.ResourceRecordSet{
 			Type: aws.String(typeA),
@@ -779,26 +1136,18 @@ func (b *Backend) MigrateRecord(opts *model.MigrateRecord) error {
 		}
 
 		// set A and wildcard A record
-		rr := make([]*route53.ResourceRecord, 0)
-		for _, h := range dopts.Hosts {
-			rr = append(rr, &route53.ResourceRecord{
-				Value: aws.String(h),
-			})
+		if err := validateRegions(dopts); err != nil {
+			return err
 		}
-
-		rrs = &route53.ResourceRecordSet{
-			Type:            aws.String(typeA),
-			Name:            aws.String(dopts.Fqdn),
-			ResourceRecords: rr,
-			TTL:             aws.Int64(int64(b.TTL)),
+		weights, err := b.saveWeights(dopts, t.ID)
+		if err != nil {
+			return err
 		}
-
-		if _, err := b.setRecord(rrs, dopts, typeA, t.ID, pID, false); err != nil {
+		regions, err := b.saveRegions(dopts, t.ID)
+		if err != nil {
 			return err
 		}
-
-		rrs.Name = aws.String(fmt.Sprintf("\\052.%s", dopts.Fqdn))
-		if _, err := b.setRecord(rrs, dopts, typeA, t.ID, pID, false); err != nil {
+		if err := b.setHosts(dopts, dopts.Hosts, weights, regions, t.ID, pID); err != nil {
 			return err
 		}
 
@@ -826,6 +1175,289 @@ func (b *Backend) MigrateRecord(opts *model.MigrateRecord) error {
 	return nil
 }
 
+// Used to get the records of a suspended domain from the database
+func (b *Backend) getSuspended(opts *model.DomainOptions, token *model.Token) (d model.Domain, err error) {
+	emptyName := fmt.Sprintf("%s.%s", "empty", opts.Fqdn)
+
+	e, err := database.GetDatabase().QueryA(emptyName)
+	if err != nil || e.Fqdn == "" {
+		return d, errors.Wrapf(err, errQueryAFromDatabase, emptyName)
+	}
+
+	if a, err := database.GetDatabase().QueryA(opts.Fqdn); err == nil && a.Content != "" {
+		d.Hosts = strings.Split(a.Content, ",")
+	}
+
+	subs, _ := database.GetDatabase().ListSubA(e.ID)
+	if len(subs) > 0 {
+		ss := make(map[string][]string, 0)
+		for _, sub := range subs {
+			ss[strings.Split(sub.Fqdn, ".")[0]] = strings.Split(sub.Content, ",")
+		}
+		d.SubDomain = ss
+	}
+
+	d.Fqdn = opts.Fqdn
+	b.setState(&d, token)
+
+	return d, b.setDetails(&d)
+}
+
+// Used to restore the records of a suspended domain from the database and remove its parking records
+func (b *Backend) resume(opts *model.DomainOptions) error {
+	restores := make(map[string][]*route53.ResourceRecordSet, 0)
+	restore := func(name, rType, content string) {
+		if content == "" {
+			return
+		}
+		rr := make([]*route53.ResourceRecord, 0)
+		for _, v := range strings.Split(content, ",") {
+			rr = append(rr, &route53.ResourceRecord{
+				Value: aws.String(v),
+			})
+		}
+		restores[name] = []*route53.ResourceRecordSet{
+			{
+				Name:            aws.String(name),
+				Type:            aws.String(rType),
+				ResourceRecords: rr,
+				TTL:             aws.Int64(b.TTL),
+			},
+		}
+	}
+
+	weights, err := b.getWeights(opts.Fqdn)
+	if err != nil {
+		return err
+	}
+	regions, err := b.getRegions(opts.Fqdn)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range []string{opts.Fqdn, fmt.Sprintf("\\052.%s", opts.Fqdn)} {
+		if r, err := database.GetDatabase().QueryA(name); err == nil {
+			restore(name, typeA, r.Content)
+			if (weights != nil || regions != nil) && r.Content != "" {
+				restores[name] = b.hostSets(name, strings.Split(r.Content, ","), weights, regions)
+			}
+		}
+		if r, err := database.GetDatabase().QueryCNAME(name); err == nil {
+			restore(name, typeCNAME, r.Content)
+		}
+	}
+
+	if e, err := database.GetDatabase().QueryA(fmt.Sprintf("empty.%s", opts.Fqdn)); err == nil {
+		subs, _ := database.GetDatabase().ListSubA(e.ID)
+		for _, sub := range subs {
+			restore(sub.Fqdn, typeA, sub.Content)
+		}
+	}
+
+	records, err := b.getRecords(opts, typeA)
+	if err != nil {
+		return err
+	}
+	_, a, s, _, _ := b.filterRecords(records.ResourceRecordSets, opts, typeA)
+
+	// parking records which are not replaced by a simple A record must be deleted first
+	changes := make([]*route53.Change, 0)
+	for _, rrs := range append(a, s...) {
+		name := strings.TrimRight(aws.StringValue(rrs.Name), ".")
+		if r, ok := restores[name]; ok && len(r) == 1 && r[0].SetIdentifier == nil && aws.StringValue(r[0].Type) == typeA {
+			continue
+		}
+		changes = append(changes, &route53.Change{
+			Action:            aws.String("DELETE"),
+			ResourceRecordSet: rrs,
+		})
+	}
+
+	for _, sets := range restores {
+		for _, rrs := range sets {
+			changes = append(changes, &route53.Change{
+				Action:            aws.String("UPSERT"),
+				ResourceRecordSet: rrs,
+			})
+		}
+	}
+
+	if err := b.changeRecords(opts.Fqdn, changes); err != nil {
+		return err
+	}
+
+	// the health of the hosts may be changed while the domain is suspended
+	hs, err := b.getHealthState(opts.Fqdn)
+	if err != nil || hs == nil {
+		return err
+	}
+	return b.serveHealthState(hs)
+}
+
+// Used to delete the parking records and the CNAME records in the database of a suspended domain
+func (b *Backend) deleteSuspendedCNAME(opts *model.DomainOptions) error {
+	records, err := b.getRecords(opts, typeA)
+	if err != nil {
+		return err
+	}
+	_, a, _, _, _ := b.filterRecords(records.ResourceRecordSets, opts, typeA)
+
+	for _, rr := range a {
+		if err := b.deleteRecord(rr, opts, typeA, false); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range []string{opts.Fqdn, fmt.Sprintf("\\052.%s", opts.Fqdn)} {
+		if err := database.GetDatabase().DeleteCNAME(name); err != nil {
+			return errors.Wrapf(err, errDeleteRecordsFromDatabase, typeCNAME, name)
+		}
+	}
+
+	return nil
+}
+
+// Used to get the changes which delete the A, sub domain A, CNAME (or parking) and TXT records of a domain
+func (b *Backend) purgeChanges(t *model.Token) ([]*route53.Change, error) {
+	opts := &model.DomainOptions{Fqdn: t.Fqdn}
+
+	aRecords, err := b.getRecords(opts, typeA)
+	if err != nil {
+		return nil, err
+	}
+	_, a, s, _, _ := b.filterRecords(aRecords.ResourceRecordSets, opts, typeA)
+
+	cRecords, err := b.getRecords(opts, typeCNAME)
+	if err != nil {
+		return nil, err
+	}
+	_, _, _, _, c := b.filterRecords(cRecords.ResourceRecordSets, opts, typeCNAME)
+
+	rrs := append(append(a, s...), c...)
+
+	txts, err := database.GetDatabase().QueryExpiredTXTs(t.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.Wrapf(err, errQueryTXTFromDatabase, t.Fqdn)
+	}
+	for _, txt := range txts {
+		tOpts := &model.DomainOptions{Fqdn: txt.Fqdn}
+		tRecords, err := b.getRecords(tOpts, typeTXT)
+		if err != nil {
+			return nil, err
+		}
+		_, _, _, ts, _ := b.filterRecords(tRecords.ResourceRecordSets, tOpts, typeTXT)
+		rrs = append(rrs, ts...)
+	}
+
+	changes := make([]*route53.Change, 0)
+	for _, rr := range rrs {
+		changes = append(changes, &route53.Change{
+			Action:            aws.String("DELETE"),
+			ResourceRecordSet: rr,
+		})
+	}
+
+	return changes, nil
+}
+
+// Used to apply changes to the hosted zone in one change batch
+func (b *Backend) changeRecords(fqdn string, changes []*route53.Change) error {
+	if len(changes) <= 0 {
+		return nil
+	}
+
+	input := route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(b.ZoneID),
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: changes,
+		},
+	}
+
+	if _, err := b.Svc.ChangeResourceRecordSets(&input); err != nil {
+		return errors.Wrapf(err, errChangeRoute53Records, fqdn)
+	}
+
+	return nil
+}
+
+// Used to get the lease time of a token, the default lease time is used unless the domain requested its own
+func (b *Backend) leaseTimeOf(token *model.Token) time.Duration {
+	if token.LeaseTime.Valid {
+		return time.Duration(token.LeaseTime.Int64)
+	}
+	return b.LeaseTime
+}
+
+// Used to reject a change of a suspended domain, its route53 records are the parking records until it is renewed
+func (b *Backend) checkSuspended(fqdn string) error {
+	t, err := database.GetDatabase().QueryToken(b.findSlugWithZone(fqdn))
+	if err != nil {
+		return errors.Wrapf(err, errQueryTokenFromDatabase, fqdn)
+	}
+	if t.SuspendedOn.Valid {
+		return backend.NewSuspendedError(fqdn)
+	}
+	return nil
+}
+
+// Used to set the expiration and state of a domain, a suspended domain is purged after the grace period
+func (b *Backend) setState(d *model.Domain, token *model.Token) {
+	d.Expiration = convertExpiration(time.Unix(0, token.CreatedOn), int(b.leaseTimeOf(token).Nanoseconds()))
+	d.State = model.StateActive
+	d.SignedOnly = token.SignedOnly
+
+	if token.SuspendedOn.Valid {
+		p := d.Expiration.Add(b.Grace)
+		d.State = model.StateSuspended
+		d.Purge = &p
+	}
+}
+
+// Used to check the requested name of a normal (vanity) domain, returns the fqdn of the name:
+//   the name must be a valid label which is not reserved, frozen or used by any record
+func (b *Backend) checkNormalName(name string, get func(*model.DomainOptions) (model.Domain, error)) (string, error) {
+	label, err := backend.NameLabel(name, b.Zone)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := database.GetDatabase().QueryFrozen(label)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if r != "" {
+		return "", backend.NewNameTakenError(label)
+	}
+
+	fqdn := fmt.Sprintf("%s.%s", label, b.Zone)
+	if d, err := get(&model.DomainOptions{Fqdn: fqdn}); err == nil && d.Fqdn != "" {
+		return "", backend.NewNameTakenError(label)
+	}
+
+	return fqdn, nil
+}
+
+// Used to convert a frozen prefix record, the prefix expires when the frozen duration has passed since created_on
+func (b *Backend) toFrozen(prefix string, createdOn int64) model.Frozen {
+	e := time.Unix(0, createdOn).Add(b.Frozen)
+	return model.Frozen{
+		Prefix:     prefix,
+		Expiration: &e,
+	}
+}
+
+// Used to save the slug name to the frozen table, the prefix is unique,
+// so a name which is claimed by a concurrent request is reported as taken
+func (b *Backend) insertFrozen(slug string) error {
+	if err := database.GetDatabase().InsertFrozen(slug); err != nil {
+		if r, _ := database.GetDatabase().QueryFrozen(slug); r != "" {
+			return backend.NewNameTakenError(slug)
+		}
+		return errors.Wrapf(err, errInsertFrozenToDatabase, slug)
+	}
+	return nil
+}
+
 // Used to set record to database
 func (b *Backend) setRecordToDatabase(rrs *route53.ResourceRecordSet, rType string, tID, pID int64, sub bool) (int64, error) {
 	content := make([]string, 0)
@@ -986,6 +1618,9 @@ func (b *Backend) deleteRecord(rrs *route53.ResourceRecordSet, opts *model.Domai
 					ResourceRecordSet: &route53.ResourceRecordSet{
 						Name:            rrs.Name,
 						Type:            aws.String(rType),
+						SetIdentifier:   rrs.SetIdentifier,
+						Weight:          rrs.Weight,
+						Region:          rrs.Region,
 						ResourceRecords: rrs.ResourceRecords,
 						TTL:             aws.Int64(int64(b.TTL)),
 					},
@@ -1074,7 +1709,7 @@ func (b *Backend) convertARecords(a, s []*route53.ResourceRecordSet) (aOutput, s
 		for _, r := range rs.ResourceRecords {
 			temp = append(temp, aws.StringValue(r.Value))
 		}
-		aOutput[name] = temp
+		aOutput[name] = append(aOutput[name], temp...)
 	}
 
 	for _, rs := range s {
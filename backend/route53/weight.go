@@ -0,0 +1,209 @@
+package route53
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/pkg/errors"
+)
+
+// Used to set the A and wildcard A records of a domain with its hosts, the hosts of a weighted domain are set as
+// weighted record sets of the preferred priority, one for each host and identified by the host, and the hosts of
+// a regional domain are set as latency record sets, one for each region.
+// The record sets which are replaced are deleted in the same change batch, the database holds the hosts which
+// are in route53
+func (b *Backend) setHosts(opts *model.DomainOptions, hosts []string, weights map[string]model.HostWeight, regions map[string]string, tID, pID int64) error {
+	hosts = model.PreferredHosts(hosts, weights)
+
+	changes := make([]*route53.Change, 0)
+	if len(hosts) > 0 {
+		records, err := b.getRecords(opts, typeA)
+		if err != nil {
+			return err
+		}
+		_, a, _, _, _ := b.filterRecords(records.ResourceRecordSets, opts, typeA)
+
+		sets := make([]*route53.ResourceRecordSet, 0)
+		for _, name := range []string{opts.Fqdn, fmt.Sprintf("\\052.%s", opts.Fqdn)} {
+			sets = append(sets, b.hostSets(name, hosts, weights, regions)...)
+		}
+
+		changes = append(changes, replacedSets(a, sets)...)
+		for _, rrs := range sets {
+			changes = append(changes, &route53.Change{
+				Action:            aws.String("UPSERT"),
+				ResourceRecordSet: rrs,
+			})
+		}
+	}
+
+	if err := b.changeRecords(opts.Fqdn, changes); err != nil {
+		return err
+	}
+
+	for _, name := range []string{opts.Fqdn, fmt.Sprintf("\\052.%s", opts.Fqdn)} {
+		rrs := &route53.ResourceRecordSet{
+			Name:            aws.String(name),
+			ResourceRecords: toResourceRecords(hosts),
+		}
+		if _, err := b.setRecordToDatabase(rrs, typeA, tID, pID, false); err != nil {
+			return errors.Wrapf(err, errInsertRecordToDatabase, typeA, opts.Fqdn)
+		}
+	}
+
+	return nil
+}
+
+// Used to build the record sets of a name, a single record set when the domain is neither weighted nor regional
+func (b *Backend) hostSets(name string, hosts []string, weights map[string]model.HostWeight, regions map[string]string) []*route53.ResourceRecordSet {
+	if regions != nil {
+		return b.regionSets(name, hosts, regions)
+	}
+	if weights == nil {
+		return []*route53.ResourceRecordSet{
+			{
+				Name:            aws.String(name),
+				Type:            aws.String(typeA),
+				ResourceRecords: toResourceRecords(hosts),
+				TTL:             aws.Int64(b.TTL),
+			},
+		}
+	}
+
+	sets := make([]*route53.ResourceRecordSet, 0, len(hosts))
+	for _, h := range hosts {
+		sets = append(sets, &route53.ResourceRecordSet{
+			Name:            aws.String(name),
+			Type:            aws.String(typeA),
+			SetIdentifier:   aws.String(h),
+			Weight:          aws.Int64(int64(weights[h].Weight)),
+			ResourceRecords: toResourceRecords([]string{h}),
+			TTL:             aws.Int64(b.TTL),
+		})
+	}
+	return sets
+}
+
+// Used to get the deletes of the listed record sets which are not upserted by the new ones, a weighted or latency
+// record set can not be upserted over a simple one of the same name and the other way around
+func replacedSets(listed, sets []*route53.ResourceRecordSet) []*route53.Change {
+	kept := make(map[string]bool, len(sets))
+	for _, rrs := range sets {
+		kept[setKey(rrs)] = true
+	}
+
+	changes := make([]*route53.Change, 0)
+	for _, rrs := range listed {
+		if kept[setKey(rrs)] {
+			continue
+		}
+		changes = append(changes, &route53.Change{
+			Action:            aws.String("DELETE"),
+			ResourceRecordSet: rrs,
+		})
+	}
+	return changes
+}
+
+// Used to identify a record set by its name and set identifier
+func setKey(rrs *route53.ResourceRecordSet) string {
+	return fmt.Sprintf("%s/%s", normalizeName(aws.StringValue(rrs.Name)), aws.StringValue(rrs.SetIdentifier))
+}
+
+// Used to set or delete the weights of the hosts of a domain, returns the weights of every host with the
+// defaults filled in, nil when the domain is not weighted
+func (b *Backend) saveWeights(opts *model.DomainOptions, tID int64) (map[string]model.HostWeight, error) {
+	weights := model.HostWeights(opts.Hosts, opts.Weights)
+	if weights == nil {
+		return nil, deleteOption(opts.Fqdn, model.OptionHostWeight)
+	}
+
+	if err := saveOption(opts.Fqdn, model.OptionHostWeight, weights, tID); err != nil {
+		return nil, err
+	}
+	return weights, nil
+}
+
+// Used to get the weights of the hosts of a domain, returns nil when the domain is not weighted
+func (b *Backend) getWeights(fqdn string) (map[string]model.HostWeight, error) {
+	weights := make(map[string]model.HostWeight)
+	ok, err := getOption(fqdn, model.OptionHostWeight, &weights)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return weights, nil
+}
+
+// Used to add the weights, the regions and the health of the hosts of a domain, route53 only holds the hosts
+// which are answered, so the hosts are taken from the weights, the regions and the health check when the domain
+// has them
+func (b *Backend) setDetails(d *model.Domain) error {
+	weights, err := b.getWeights(d.Fqdn)
+	if err != nil {
+		return err
+	}
+	if weights != nil {
+		d.Hosts = weightedHosts(weights)
+		d.Weights = weights
+	}
+
+	regions, err := b.getRegions(d.Fqdn)
+	if err != nil {
+		return err
+	}
+	if regions != nil {
+		d.Hosts = regionalHosts(regions)
+		d.Regions = regions
+	}
+
+	return b.setHealth(d)
+}
+
+// Used to get the hosts of a weighted domain, sorted
+func weightedHosts(weights map[string]model.HostWeight) []string {
+	hosts := make([]string, 0, len(weights))
+	for h := range weights {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Used to merge the weighted or latency record sets of the same name into one, to compare them with the database
+func mergeSets(sets []*route53.ResourceRecordSet) *route53.ResourceRecordSet {
+	if len(sets) == 1 {
+		return sets[0]
+	}
+
+	merged := *sets[0]
+	merged.SetIdentifier = nil
+	merged.Weight = nil
+	merged.Region = nil
+	merged.ResourceRecords = make([]*route53.ResourceRecord, 0, len(sets))
+	for _, rrs := range sets {
+		merged.ResourceRecords = append(merged.ResourceRecords, rrs.ResourceRecords...)
+	}
+	return &merged
+}
+
+// Used to get the deletes of the record sets
+func deleteChanges(sets []*route53.ResourceRecordSet) []*route53.Change {
+	changes := make([]*route53.Change, 0, len(sets))
+	for _, rrs := range sets {
+		changes = append(changes, &route53.Change{
+			Action:            aws.String("DELETE"),
+			ResourceRecordSet: rrs,
+		})
+	}
+	return changes
+}
+
+// Used to check whether the hosts are the ones in the database record
+func sameHosts(content string, hosts []string) bool {
+	return normalizeValues(content) == normalizeValues(strings.Join(hosts, ","))
+}
@@ -0,0 +1,27 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// SuspendedError is returned when the records of a suspended domain are changed, the domain must be renewed first.
+type SuspendedError struct {
+	Fqdn string
+}
+
+func (e *SuspendedError) Error() string {
+	return fmt.Sprintf("domain %s is suspended, renew it before changing its records", e.Fqdn)
+}
+
+// NewSuspendedError returns the error of a suspended domain whose records can not be changed.
+func NewSuspendedError(fqdn string) error {
+	return &SuspendedError{Fqdn: fqdn}
+}
+
+// IsSuspended returns whether err is caused by a change of a suspended domain.
+func IsSuspended(err error) bool {
+	_, ok := errors.Cause(err).(*SuspendedError)
+	return ok
+}
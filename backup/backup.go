@@ -0,0 +1,275 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rancher/rdns-server/backend"
+	"github.com/rancher/rdns-server/model"
+	"github.com/rancher/rdns-server/policy"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// maxLineSize is the size of the longest line which can be imported, a domain with many sub domains is a long line.
+const maxLineSize = 1024 * 1024
+
+// Export writes the header and every entry of the current backend to w, one JSON object per line.
+func Export(w io.Writer) error {
+	b := backend.GetBackend()
+	encoder := json.NewEncoder(w)
+
+	now := time.Now()
+	header := &model.ExportEntry{
+		Kind:     model.ExportKindHeader,
+		Version:  model.ExportVersion,
+		Backend:  b.GetName(),
+		Zone:     b.GetZone(),
+		Exported: &now,
+	}
+	if err := encoder.Encode(header); err != nil {
+		return errors.Wrapf(err, errEncodeEntry, header.Kind, header.Zone)
+	}
+
+	count := 0
+	err := b.Export(func(e *model.ExportEntry) error {
+		if err := encoder.Encode(e); err != nil {
+			return errors.Wrapf(err, errEncodeEntry, e.Kind, e.Name())
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, errExport)
+	}
+
+	logrus.Infof("export finished, backend: %s, zone: %s, entries: %d", header.Backend, header.Zone, count)
+
+	return nil
+}
+
+// Import reads an export from r and imports its entries into the current backend,
+// the entries are only validated when dryRun is true. An entry which fails is reported and skipped,
+// importing the same file again results in the same state.
+func Import(r io.Reader, dryRun bool) (*model.ImportReport, error) {
+	b := backend.GetBackend()
+	report := &model.ImportReport{
+		DryRun:   dryRun,
+		Started:  time.Now(),
+		Failures: make([]model.ImportFailure, 0),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	seen := make(map[string]bool)
+	header := false
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		e := &model.ExportEntry{}
+		if err := json.Unmarshal(text, e); err != nil {
+			if !header {
+				return nil, errors.Wrapf(err, errInvalidHeader, model.ExportKindHeader)
+			}
+			report.AddFailure(line, "", errors.Errorf(errDecodeEntry, err))
+			continue
+		}
+
+		if !header {
+			if err := validateHeader(e, b.GetZone()); err != nil {
+				return nil, err
+			}
+			report.Version = e.Version
+			report.Backend = e.Backend
+			header = true
+			continue
+		}
+
+		if err := ValidateEntry(e, b.GetZone()); err != nil {
+			report.AddFailure(line, e.Name(), err)
+			continue
+		}
+
+		key := e.Kind + "/" + e.Name()
+		if seen[key] {
+			report.AddFailure(line, e.Name(), errors.Errorf(errDuplicatedEntry, e.Kind, e.Name()))
+			continue
+		}
+		seen[key] = true
+
+		if !dryRun {
+			if err := b.Import(e); err != nil {
+				report.AddFailure(line, e.Name(), err)
+				continue
+			}
+		}
+
+		if e.Kind == model.ExportKindDomain {
+			report.Domains++
+		} else {
+			report.Frozen++
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, errReadFile, line+1)
+	}
+	if !header {
+		return nil, errors.Errorf(errInvalidHeader, model.ExportKindHeader)
+	}
+
+	report.Lines = line
+	report.Finished = time.Now()
+	report.Duration = report.Finished.Sub(report.Started).String()
+
+	logrus.Infof("import finished in %s, dry run: %t, domains: %d, frozen prefixes: %d, failures: %d",
+		report.Duration, dryRun, report.Domains, report.Frozen, len(report.Failures))
+	for _, f := range report.Failures {
+		logrus.Warnf("failed to import line %d %s: %s", f.Line, f.Name, f.Error)
+	}
+
+	return report, nil
+}
+
+// An export of another zone is refused, the backend of the export may differ
+func validateHeader(e *model.ExportEntry, zone string) error {
+	if e.Kind != model.ExportKindHeader {
+		return errors.Errorf(errInvalidHeader, model.ExportKindHeader)
+	}
+	if e.Version < 1 || e.Version > model.ExportVersion {
+		return errors.Errorf(errUnsupportVersion, e.Version, model.ExportVersion)
+	}
+	if !strings.EqualFold(strings.TrimRight(e.Zone, "."), strings.TrimRight(zone, ".")) {
+		return errors.Errorf(errInvalidZone, e.Zone, zone)
+	}
+	return nil
+}
+
+// ValidateEntry checks a domain or frozen prefix entry of an export of the zone,
+// reserved names are not checked because the names of an export are already in use.
+// The hosts and the CNAME target of a domain must pass the host policy like the ones of the api.
+func ValidateEntry(e *model.ExportEntry, zone string) error {
+	switch e.Kind {
+	case model.ExportKindDomain:
+		return validateDomain(e, zone)
+	case model.ExportKindFrozen:
+		if err := backend.ValidateLabelSyntax(e.Prefix); err != nil {
+			return err
+		}
+		if e.Expiration == nil {
+			return errors.Errorf(errEmptyField, "expiration", e.Prefix)
+		}
+		return nil
+	}
+	return errors.Errorf(errInvalidKind, e.Kind)
+}
+
+func validateDomain(e *model.ExportEntry, zone string) error {
+	label := strings.TrimSuffix(e.Fqdn, "."+zone)
+	if label == e.Fqdn {
+		return errors.Errorf(errNotFqdn, e.Fqdn, zone)
+	}
+	if err := backend.ValidateLabelSyntax(label); err != nil {
+		return err
+	}
+
+	if e.Token == "" {
+		return errors.Errorf(errEmptyField, "token", e.Fqdn)
+	}
+	if e.Expiration == nil {
+		return errors.Errorf(errEmptyField, "expiration", e.Fqdn)
+	}
+	if e.State != "" && e.State != model.StateActive && e.State != model.StateSuspended {
+		return errors.Errorf(errInvalidState, e.State, e.Fqdn)
+	}
+	if err := backend.ValidateLeaseTime(e.LeaseTime); err != nil {
+		return err
+	}
+
+	if e.CNAME != "" && (len(e.Hosts) > 0 || len(e.SubDomain) > 0) {
+		return errors.Errorf(errMixedRecords, e.Fqdn)
+	}
+	if err := ValidateHosts(e.Hosts, e.Fqdn); err != nil {
+		return err
+	}
+	for prefix, hosts := range e.SubDomain {
+		if err := backend.ValidateLabelSyntax(prefix); err != nil {
+			return err
+		}
+		if err := ValidateHosts(hosts, prefix+"."+e.Fqdn); err != nil {
+			return err
+		}
+	}
+
+	for name := range e.Texts {
+		if !strings.HasSuffix(name, "."+e.Fqdn) {
+			return errors.Errorf(errInvalidText, name, e.Fqdn)
+		}
+	}
+
+	return policy.GetPolicy().Check(&model.DomainOptions{
+		Fqdn:      e.Fqdn,
+		Hosts:     e.Hosts,
+		SubDomain: e.SubDomain,
+		CNAME:     e.CNAME,
+	})
+}
+
+// ValidateHosts checks that the hosts of an A record of fqdn are IPv4 addresses.
+func ValidateHosts(hosts []string, fqdn string) error {
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip == nil || ip.To4() == nil {
+			return errors.Errorf(errInvalidHost, h, fqdn)
+		}
+	}
+	return nil
+}
+
+// ExportFile exports to a file, an empty name or "-" means the standard output.
+func ExportFile(name string) error {
+	if name == "" || name == "-" {
+		return Export(os.Stdout)
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return errors.Wrapf(err, errOpenFile, name)
+	}
+
+	if err := Export(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// ImportFile imports from a file, an empty name or "-" means the standard input.
+func ImportFile(name string, dryRun bool) (*model.ImportReport, error) {
+	if name == "" || name == "-" {
+		return Import(os.Stdin, dryRun)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, errOpenFile, name)
+	}
+	defer f.Close()
+
+	return Import(f, dryRun)
+}
@@ -0,0 +1,20 @@
+package backup
+
+const (
+	errDecodeEntry      = "failed to decode entry: %v"
+	errDuplicatedEntry  = "duplicated %s entry: %s"
+	errEncodeEntry      = "failed to encode %s entry: %s"
+	errEmptyField       = "expected %s field: %s"
+	errExport           = "failed to export"
+	errInvalidHeader    = "invalid header, expected the first line to be a %s entry"
+	errInvalidHost      = "invalid host %q of %s"
+	errInvalidKind      = "invalid entry kind: %s"
+	errInvalidState     = "invalid state %q of %s"
+	errInvalidText      = "TXT record %s is not a name of %s"
+	errInvalidZone      = "zone %s does not match the zone %s of the backend"
+	errMixedRecords     = "%s can not have both hosts and CNAME"
+	errNotFqdn          = "%s is not a name of the zone %s"
+	errOpenFile         = "failed to open file %s"
+	errReadFile         = "failed to read line %d"
+	errUnsupportVersion = "unsupported export version %d, expected at most %d"
+)
@@ -0,0 +1,87 @@
+package check
+
+import (
+	"os"
+	"time"
+
+	"github.com/rancher/rdns-server/backend"
+	"github.com/rancher/rdns-server/leader"
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	flagInterval = "CHECK_INTERVAL"
+	flagFix      = "CHECK_FIX"
+)
+
+// checker is implemented by backends whose keys and leases can become inconsistent, e.g. etcd.
+type checker interface {
+	Check(fix bool) (*model.CheckReport, error)
+}
+
+// StartCheckDaemon checks the backend periodically on the leader, it is disabled when the interval is 0.
+func StartCheckDaemon(done chan struct{}) error {
+	interval, err := calculateInterval()
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		logrus.Info("check daemon is disabled")
+		return nil
+	}
+
+	fix := os.Getenv(flagFix) == "true"
+
+	go wait.JitterUntil(func() {
+		if !leader.IsLeader() {
+			logrus.Debugf("skip check process, not the leader")
+			return
+		}
+		if _, err := RunOnce(fix); err != nil {
+			logrus.Error(err)
+		}
+	}, interval, .1, true, done)
+
+	return nil
+}
+
+// RunOnce checks the backend and returns the report, the issues are fixed when fix is true.
+func RunOnce(fix bool) (*model.CheckReport, error) {
+	c, ok := backend.GetBackend().(checker)
+	if !ok {
+		return nil, errors.Errorf(errNotSupported, backend.GetBackend().GetName())
+	}
+
+	report, err := c.Check(fix)
+	if err != nil {
+		failuresCounter.Inc()
+		return nil, errors.Wrap(err, errCheck)
+	}
+
+	observe(report)
+
+	logrus.Infof("check process finished in %s, fix: %t, keys: %d, leases: %d, issues: %d",
+		report.Duration, fix, report.Keys, report.Leases, len(report.Issues))
+	for _, i := range report.Issues {
+		logrus.Warnf("issue %s of key %q lease %d, expected lease: %d, fixed: %t %s",
+			i.Kind, i.Key, i.Lease, i.ExpectedLease, i.Fixed, i.Error)
+	}
+
+	return report, nil
+}
+
+func calculateInterval() (time.Duration, error) {
+	v := os.Getenv(flagInterval)
+	if v == "" {
+		return 0, nil
+	}
+	i, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.Wrapf(err, errInvalidEnv, flagInterval, v)
+	}
+	return i, nil
+}
@@ -0,0 +1,7 @@
+package check
+
+const (
+	errCheck        = "failed to check"
+	errInvalidEnv   = "invalid environment %s: %s"
+	errNotSupported = "backend %s does not support check"
+)
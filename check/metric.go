@@ -0,0 +1,62 @@
+package check
+
+import (
+	"strconv"
+
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var issueKinds = []string{
+	model.IssueNoToken,
+	model.IssueLeaseMismatch,
+	model.IssueOrphanLease,
+	model.IssueUnknownLease,
+	model.IssueStaleFrozen,
+}
+
+var (
+	runsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rancher_dns_check_runs_total",
+		Help: "The number of the check runs",
+	}, []string{"fix"})
+
+	failuresCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rancher_dns_check_failures_total",
+		Help: "The number of the check runs which failed to read the keys or leases",
+	})
+
+	issuesGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rancher_dns_check_issues",
+		Help: "The number of the issues which are found by the last check run",
+	}, []string{"kind"})
+
+	fixedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rancher_dns_check_fixed_total",
+		Help: "The number of the issues which are fixed",
+	}, []string{"kind"})
+
+	lastRunGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "rancher_dns_check_last_run_timestamp_seconds",
+		Help: "The time when the last check run finished",
+	})
+)
+
+func observe(r *model.CheckReport) {
+	runsCounter.WithLabelValues(strconv.FormatBool(r.Fix)).Inc()
+
+	counts := make(map[string]int, len(issueKinds))
+	for _, i := range r.Issues {
+		counts[i.Kind]++
+		if i.Fixed {
+			fixedCounter.WithLabelValues(i.Kind).Inc()
+		}
+	}
+	for _, k := range issueKinds {
+		issuesGauge.WithLabelValues(k).Set(float64(counts[k]))
+	}
+
+	lastRunGauge.Set(float64(r.Finished.Unix()))
+}
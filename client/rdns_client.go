@@ -9,9 +9,12 @@ import (
 	"net/http"
 	"reflect"
 	"sort"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/rancher/rdns-server/model"
+	"github.com/rancher/rdns-server/util"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -25,6 +28,7 @@ const (
 	jsonContentType = "application/json"
 	secretKey       = "rdns-token"
 	cnamePath       = "/cname"
+	nonceLength     = 32
 )
 
 func jsonBody(payload interface{}) (io.Reader, error) {
@@ -55,15 +59,44 @@ type Client struct {
 }
 
 func (c *Client) request(method string, url string, body io.Reader) (*http.Request, error) {
+	var payload []byte
+	if body != nil {
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = b
+		body = bytes.NewReader(b)
+	}
+
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Add(contentType, jsonContentType)
 
+	// sign the request when the server has issued a signing secret for the domain,
+	// otherwise the caller falls back to the bearer token
+	if secret := c.getSigningSecret(); secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		nonce := util.RandStringWithAll(nonceLength)
+		signature := util.SignRequest(secret, method, req.URL.EscapedPath(), util.CanonicalQuery(req.URL.RawQuery), util.HashBody(payload), timestamp, nonce)
+
+		req.Header.Set(util.SignatureTimestamp, timestamp)
+		req.Header.Set(util.SignatureNonce, nonce)
+		req.Header.Set("Authorization", fmt.Sprintf("%s %s", util.SignatureScheme, signature))
+	}
+
 	return req, nil
 }
 
+// setBearer sets the bearer token unless the request has been signed.
+func setBearer(req *http.Request, token string) {
+	if req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+}
+
 func (c *Client) do(req *http.Request) (model.Response, error) {
 	var data model.Response
 	resp, err := c.httpClient.Do(req)
@@ -138,7 +171,7 @@ func (c *Client) GetDomain(cname bool) (d *model.Domain, err error) {
 		return d, errors.Wrap(err, "GetDomain: failed to build a request")
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	setBearer(req, token)
 
 	o, err := c.do(req)
 	if err != nil {
@@ -217,7 +250,7 @@ func (c *Client) UpdateDomain(hosts []string, subDomain map[string][]string, cna
 		return "", errors.Wrap(err, "UpdateDomain: failed to build a request")
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	setBearer(req, token)
 
 	_, err = c.do(req)
 	if err != nil {
@@ -242,7 +275,7 @@ func (c *Client) DeleteDomain() (string, error) {
 		return "", errors.Wrap(err, "DeleteDomain: failed to build a request")
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	setBearer(req, token)
 
 	_, err = c.do(req)
 	if err != nil {
@@ -267,7 +300,7 @@ func (c *Client) RenewDomain() (string, error) {
 		return "", errors.Wrap(err, "RenewDomain: failed to build a request")
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	setBearer(req, token)
 
 	_, err = c.do(req)
 	if err != nil {
@@ -293,8 +326,9 @@ func (c *Client) setSecret(resp *model.Response) error {
 		},
 		Type: k8scorev1.SecretTypeOpaque,
 		StringData: map[string]string{
-			"token": resp.Token,
-			"fqdn":  resp.Data.Fqdn,
+			"token":  resp.Token,
+			"fqdn":   resp.Data.Fqdn,
+			"secret": resp.Secret,
 		},
 	}
 	_, err := c.secrets.Create(s)
@@ -322,6 +356,15 @@ func (c *Client) getSecret() (string, string, error) {
 	return string(sec.Data["fqdn"]), string(sec.Data["token"]), nil
 }
 
+// getSigningSecret returns the secret which signs requests, it is empty if the server has not issued one
+func (c *Client) getSigningSecret() string {
+	sec, err := c.managementSecretLister.Get(c.clusterName, secretKey)
+	if err != nil {
+		return ""
+	}
+	return string(sec.Data["secret"])
+}
+
 func NewClient(secrets SecretCreator, secretLister SecretLister, clusterName string) *Client {
 	return &Client{
 		httpClient:             http.DefaultClient,
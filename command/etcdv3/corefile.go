@@ -0,0 +1,134 @@
+package etcdv3
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/pkg/errors"
+)
+
+// upstreamNone is the value of CORE_DNS_UPSTREAM which forwards no names, e.g. in air-gapped installs.
+const upstreamNone = "none"
+
+// Used to build the options of the generated Corefile from the environments
+func newCoreFile() (*model.CoreFile, error) {
+	cf := &model.CoreFile{
+		Domain:         os.Getenv("DOMAIN"),
+		EtcdPrefixPath: os.Getenv("ETCD_PREFIX_PATH"),
+		EtcdEndpoints:  strings.Join(strings.Split(os.Getenv("ETCD_ENDPOINTS"), ","), " "),
+		TTL:            os.Getenv("TTL"),
+		WildCardBound:  strconv.Itoa(len(strings.Split(strings.TrimRight(os.Getenv("DOMAIN"), "."), ".")) + 1),
+		TransferTo:     strings.Join(strings.Split(os.Getenv("CORE_DNS_TRANSFER_TO"), ","), " "),
+		NotifyTo:       strings.Join(strings.Split(os.Getenv("CORE_DNS_NOTIFY"), ","), " "),
+		TsigKey:        strings.Join(strings.SplitN(os.Getenv("CORE_DNS_TSIG_KEY"), ":", 3), " "),
+		DNSSECRollover: strings.Join(strings.Split(os.Getenv("CORE_DNS_DNSSEC_ROLLOVER"), ","), " "),
+		RegionsFile:    os.Getenv("CORE_DNS_REGIONS_FILE"),
+		TLSCertFile:    os.Getenv("CORE_DNS_TLS_CERT_FILE"),
+		TLSKeyFile:     os.Getenv("CORE_DNS_TLS_KEY_FILE"),
+
+		PrometheusAddress: os.Getenv("CORE_DNS_PROMETHEUS"),
+		HealthAddress:     os.Getenv("CORE_DNS_HEALTH"),
+	}
+
+	var err error
+	bools := map[string]*bool{
+		"CORE_DNS_DNSSEC":        &cf.DNSSEC,
+		"CORE_DNS_CNAME_FLATTEN": &cf.CNAMEFlatten,
+		"CORE_DNS_LOADBALANCE":   &cf.LoadBalance,
+		"CORE_DNS_QUERY_LOG":     &cf.QueryLog,
+	}
+	for k, v := range bools {
+		if *v, err = strconv.ParseBool(os.Getenv(k)); err != nil {
+			return nil, errors.Errorf("invalid %s: %s", strings.ToLower(k), os.Getenv(k))
+		}
+	}
+
+	ints := map[string]*int{
+		"CORE_DNS_WEIGHTED_ANSWERS": &cf.WeightedAnswers,
+		"CORE_DNS_PORT":             &cf.Port,
+		"CORE_DNS_TLS_PORT":         &cf.TLSPort,
+		"CORE_DNS_HTTPS_PORT":       &cf.HTTPSPort,
+	}
+	for k, v := range ints {
+		if os.Getenv(k) == "" {
+			continue
+		}
+		if *v, err = strconv.Atoi(os.Getenv(k)); err != nil {
+			return nil, errors.Errorf("invalid %s: %s", strings.ToLower(k), os.Getenv(k))
+		}
+	}
+
+	if u := os.Getenv("CORE_DNS_UPSTREAM"); u != upstreamNone {
+		for _, s := range strings.Split(u, ",") {
+			cf.Upstreams = append(cf.Upstreams, strings.TrimSpace(s))
+		}
+	}
+
+	if cf.Cache, err = parseCacheSize(os.Getenv("CORE_DNS_CACHE_SIZE")); err != nil {
+		return nil, err
+	}
+
+	if cf.ExtraZones, err = parseExtraZones(os.Getenv("CORE_DNS_DB_ZONE"), os.Getenv("CORE_DNS_DB_FILE"), os.Getenv("CORE_DNS_EXTRA_ZONES")); err != nil {
+		return nil, err
+	}
+
+	return cf, nil
+}
+
+// Used to parse the capacities of the cache, a single capacity is used for both the successful and the denial
+// answers and 0 disables the cache
+func parseCacheSize(value string) (model.CoreFileCache, error) {
+	cache := model.CoreFileCache{Enabled: true}
+	if value == "" {
+		return cache, nil
+	}
+
+	sizes := strings.Split(value, ",")
+	if len(sizes) > 2 {
+		return cache, errors.Errorf("invalid core_dns_cache_size: %s", value)
+	}
+	for i, s := range sizes {
+		v, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return cache, errors.Errorf("invalid core_dns_cache_size: %s", value)
+		}
+		if i == 0 {
+			cache.Success, cache.Denial = v, v
+		} else {
+			cache.Denial = v
+		}
+	}
+
+	if cache.Success == 0 && cache.Denial == 0 {
+		cache.Enabled = false
+	}
+	return cache, nil
+}
+
+// Used to parse the zones which are served from zone files, the zone of core_dns_db_file and core_dns_db_zone
+// comes first
+func parseExtraZones(dbZone, dbFile, value string) ([]model.CoreFileZone, error) {
+	zones := make([]model.CoreFileZone, 0)
+	if dbZone != "" || dbFile != "" {
+		if dbZone == "" || dbFile == "" {
+			return nil, errors.New("core_dns_db_file and core_dns_db_zone must both be set")
+		}
+		zones = append(zones, model.CoreFileZone{Zone: dbZone, File: dbFile})
+	}
+
+	if value == "" {
+		return zones, nil
+	}
+	for _, z := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(z), ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("invalid core_dns_extra_zones: %s", z)
+		}
+		zones = append(zones, model.CoreFileZone{Zone: parts[0], File: parts[1]})
+	}
+
+	return zones, nil
+}
@@ -1,17 +1,24 @@
 package etcdv3
 
 import (
-	"net/http"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
 	"os"
-	"strconv"
 	"strings"
 	"text/template"
 
 	"github.com/rancher/rdns-server/backend"
 	"github.com/rancher/rdns-server/backend/etcdv3"
+	"github.com/rancher/rdns-server/backup"
+	"github.com/rancher/rdns-server/check"
 	"github.com/rancher/rdns-server/coredns"
+	"github.com/rancher/rdns-server/health"
+	"github.com/rancher/rdns-server/leader"
 	"github.com/rancher/rdns-server/metric"
 	"github.com/rancher/rdns-server/model"
+	"github.com/rancher/rdns-server/policy"
+	"github.com/rancher/rdns-server/purge"
 	"github.com/rancher/rdns-server/service"
 
 	"github.com/pkg/errors"
@@ -21,19 +28,96 @@ import (
 
 var (
 	flags = map[string]map[string]string{
-		"DOMAIN":           {"used to set etcd root domain.": "lb.rancher.cloud"},
-		"ETCD_ENDPOINTS":   {"used to set etcd endpoints.": "http://127.0.0.1:2379"},
-		"ETCD_PREFIX_PATH": {"used to set etcd prefix path.": "/rdnsv3"},
-		"ETCD_LEASE_TIME":  {"used to set etcd lease time.": "240h"},
-		"CORE_DNS_FILE":    {"used to set coredns file.": "/etc/rdns/config/Corefile"},
-		"CORE_DNS_PORT":    {"used to set coredns port.": "53"},
-		"CORE_DNS_CPU":     {"used to set coredns cpu, a number (e.g. 3) or a percent (e.g. 50%).": "50%"},
-		"CORE_DNS_DB_FILE": {"used to set coredns file plugin db's file name (e.g. /etc/rdns/config/dbfile).": ""},
-		"CORE_DNS_DB_ZONE": {"used to set coredns file plugin db's zone (e.g. api.lb.rancher.cloud).": ""},
-		"TTL":              {"used to set coredns ttl.": "60"},
+		"DOMAIN":                    {"used to set etcd root domain.": "lb.rancher.cloud"},
+		"ETCD_ENDPOINTS":            {"used to set etcd endpoints.": "http://127.0.0.1:2379"},
+		"ETCD_PREFIX_PATH":          {"used to set etcd prefix path.": "/rdnsv3"},
+		"ETCD_LEASE_TIME":           {"used to set etcd lease time.": "240h"},
+		"CORE_DNS_FILE":             {"used to set coredns file.": "/etc/rdns/config/Corefile"},
+		"CORE_DNS_PORT":             {"used to set coredns port.": "53"},
+		"CORE_DNS_CPU":              {"used to set coredns cpu, a number (e.g. 3) or a percent (e.g. 50%).": "50%"},
+		"CORE_DNS_DB_FILE":          {"used to set coredns file plugin db's file name (e.g. /etc/rdns/config/dbfile).": ""},
+		"CORE_DNS_DB_ZONE":          {"used to set coredns file plugin db's zone (e.g. api.lb.rancher.cloud).": ""},
+		"TTL":                       {"used to set coredns ttl.": "60"},
+		"CORE_DNS_TRANSFER_TO":      {"used to set the addresses or networks which are allowed to transfer the zone, separated by comma (e.g. 10.0.0.2,192.168.0.0/24).": ""},
+		"CORE_DNS_NOTIFY":           {"used to set the secondaries which are notified of the zone changes, separated by comma (e.g. 10.0.0.2,10.0.0.3:5353).": ""},
+		"CORE_DNS_TSIG_KEY":         {"used to set the tsig key which signs the zone transfers, name:algorithm:secret (e.g. transfer.:hmac-sha256:c2VjcmV0).": ""},
+		"CORE_DNS_DNSSEC":           {"used to set whether the answers are signed with dnssec, the keys are generated and kept in etcd.": "false"},
+		"CORE_DNS_DNSSEC_ROLLOVER":  {"used to set the lifetimes of the zone signing keys and the key signing keys, separated by comma (e.g. 720h,8760h).": ""},
+		"CORE_DNS_WEIGHTED_ANSWERS": {"used to set the number of the hosts which are answered of a weighted domain.": "1"},
+		"CORE_DNS_REGIONS_FILE":     {"used to set the file of the regions of the client networks, which enables the regional answers (e.g. /etc/rdns/config/regions).": ""},
+		"CORE_DNS_CNAME_FLATTEN":    {"used to set whether the CNAMEs are answered with the addresses of their targets, which allows a CNAME at the domain apex.": "false"},
+		"CORE_DNS_UPSTREAM":         {"used to set the upstream resolvers of the names out of the zones, separated by comma, none when they are not forwarded (e.g. 10.0.0.2,10.0.0.3:53).": "8.8.8.8:53,8.8.4.4:53"},
+		"CORE_DNS_CACHE_SIZE":       {"used to set the capacities of the cache of the successful and the denial answers, separated by comma, 0 to disable the cache (e.g. 9984,9984).": ""},
+		"CORE_DNS_LOADBALANCE":      {"used to set whether the order of the answers is shuffled.": "true"},
+		"CORE_DNS_QUERY_LOG":        {"used to set whether every query is logged to stdout.": "true"},
+		"CORE_DNS_EXTRA_ZONES":      {"used to set the zones which are served from zone files, zone:file separated by comma (e.g. api.lb.rancher.cloud:/etc/rdns/config/api.db).": ""},
+		"CORE_DNS_PROMETHEUS":       {"used to set the address of the coredns metrics listener (e.g. :9153).": ""},
+		"CORE_DNS_HEALTH":           {"used to set the address of the coredns health listener (e.g. :8080).": ""},
+		"CORE_DNS_TLS_PORT":         {"used to set the port of the dns over tls listener (e.g. 853).": ""},
+		"CORE_DNS_HTTPS_PORT":       {"used to set the port of the dns over https listener (e.g. 443).": ""},
+		"CORE_DNS_TLS_CERT_FILE":    {"used to set the certificate of the dns over tls and https listeners.": ""},
+		"CORE_DNS_TLS_KEY_FILE":     {"used to set the private key of the dns over tls and https listeners.": ""},
 	}
 )
 
+// optionalFlags are the flags which may be empty.
+var optionalFlags = map[string]bool{
+	"CORE_DNS_DB_FILE":         true,
+	"CORE_DNS_DB_ZONE":         true,
+	"CORE_DNS_TRANSFER_TO":     true,
+	"CORE_DNS_NOTIFY":          true,
+	"CORE_DNS_TSIG_KEY":        true,
+	"CORE_DNS_DNSSEC_ROLLOVER": true,
+	"CORE_DNS_REGIONS_FILE":    true,
+	"CORE_DNS_CACHE_SIZE":      true,
+	"CORE_DNS_EXTRA_ZONES":     true,
+	"CORE_DNS_PROMETHEUS":      true,
+	"CORE_DNS_HEALTH":          true,
+	"CORE_DNS_TLS_PORT":        true,
+	"CORE_DNS_HTTPS_PORT":      true,
+	"CORE_DNS_TLS_CERT_FILE":   true,
+	"CORE_DNS_TLS_KEY_FILE":    true,
+}
+
+const leaderPath = "/leaderv3"
+
+var globalFlags = []string{
+	"FROZEN",
+	"LEADER_ELECTION_TTL",
+	"MIN_LEASE_TIME",
+	"MAX_LEASE_TIME",
+	"GRACE_PERIOD",
+	"PARKING_ADDRESS",
+	"PURGE_INTERVAL",
+	"PURGE_BATCH_SIZE",
+	"PURGE_DRY_RUN",
+	"HEALTH_CHECK_INTERVAL",
+	"HEALTH_CHECK_WORKERS",
+	"HEALTH_CHECK_INTERNAL",
+	"CHECK_INTERVAL",
+	"CHECK_FIX",
+	"PLAIN_LISTEN",
+	"TLS_CERT_FILE",
+	"TLS_KEY_FILE",
+	"TLS_CLIENT_CA_FILE",
+	"TLS_CLIENT_AUTH",
+	"TLS_ADMIN_NAMES",
+	"HOST_POLICY_FILE",
+	"HOST_POLICY_DENY",
+	"HOST_POLICY_ALLOW",
+	"RESERVED_NAMES_FILE",
+	"RESERVED_NAMES",
+	"AUTH_CHAIN",
+	"AUTH_SIGNATURE_SKEW",
+	"AUTH_API_KEYS_FILE",
+	"AUTH_JWT_ISSUER",
+	"AUTH_JWT_AUDIENCE",
+	"AUTH_JWT_JWKS_URL",
+	"AUTH_JWT_SECRET",
+	"AUTH_JWT_FQDNS_CLAIM",
+	"AUTH_JWT_ADMIN_CLAIM",
+}
+
 func Flags() []cli.Flag {
 	fgs := make([]cli.Flag, 0)
 	for key, value := range flags {
@@ -66,27 +150,160 @@ func Action(c *cli.Context) error {
 		}
 	}()
 
+	if err := setPolicy(); err != nil {
+		return err
+	}
+
 	if err := generateCoreFile(); err != nil {
 		return err
 	}
 
 	done := make(chan struct{})
 
+	ttl, err := leader.GetElectionTTL()
+	if err != nil {
+		return err
+	}
+	leader.StartElection(leader.NewEtcdElector(b.C, b.Prefix+leaderPath, ttl), done)
+
 	go metric.StartMetricDaemon(done)
 
+	go purge.StartPurgerDaemon(done)
+
+	if err := health.StartHealthDaemon(done); err != nil {
+		return err
+	}
+
+	if err := check.StartCheckDaemon(done); err != nil {
+		return err
+	}
+
 	go coredns.StartCoreDNSDaemon()
 
-	go func() {
-		if err := http.ListenAndServe(c.GlobalString("listen"), service.NewRouter()); err != nil {
-			logrus.Error(err)
-			done <- struct{}{}
-		}
-	}()
+	if err := service.StartServer(c.GlobalString("listen"), done); err != nil {
+		return err
+	}
 
 	<-done
 	return nil
 }
 
+func Subcommands() []cli.Command {
+	return []cli.Command{
+		{
+			Name:  "check",
+			Usage: "check the etcd keys and leases and report the inconsistent ones",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "fix",
+					Usage: "used to fix the inconsistent keys and leases.",
+				},
+			},
+			Action: CheckAction,
+		},
+		{
+			Name:  "export",
+			Usage: "export the domains, tokens and frozen prefixes as NDJSON",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "file",
+					Usage: "used to set the file to write, the standard output is used by default.",
+				},
+			},
+			Action: ExportAction,
+		},
+		{
+			Name:  "import",
+			Usage: "import the domains, tokens and frozen prefixes of an export",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "file",
+					Usage: "used to set the file to read, the standard input is used by default.",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "used to validate the file without importing it.",
+				},
+			},
+			Action: ImportAction,
+		},
+	}
+}
+
+// CheckAction runs the check process once with the flags of the etcdv3 command and prints the report.
+func CheckAction(c *cli.Context) error {
+	b, err := setSubcommand(c)
+	if err != nil {
+		return err
+	}
+	defer closeBackend(b)
+
+	r, err := check.RunOnce(c.Bool("fix"))
+	if err != nil {
+		return err
+	}
+
+	return printReport(r)
+}
+
+// ExportAction writes the export of the etcdv3 backend to a file or the standard output.
+func ExportAction(c *cli.Context) error {
+	b, err := setSubcommand(c)
+	if err != nil {
+		return err
+	}
+	defer closeBackend(b)
+
+	return backup.ExportFile(c.String("file"))
+}
+
+// ImportAction imports an export into the etcdv3 backend and prints the report.
+func ImportAction(c *cli.Context) error {
+	b, err := setSubcommand(c)
+	if err != nil {
+		return err
+	}
+	defer closeBackend(b)
+
+	r, err := backup.ImportFile(c.String("file"), c.Bool("dry-run"))
+	if err != nil {
+		return err
+	}
+
+	return printReport(r)
+}
+
+// Used to set up a subcommand with the flags of the etcdv3 command
+func setSubcommand(c *cli.Context) (*etcdv3.Backend, error) {
+	if err := setEnvironments(c.Parent()); err != nil {
+		return nil, errors.Wrapf(err, "failed to set environments")
+	}
+
+	b, err := setBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setPolicy(); err != nil {
+		closeBackend(b)
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func closeBackend(b *etcdv3.Backend) {
+	if err := b.C.Close(); err != nil {
+		logrus.Fatalf("failed to close etcd-v3 client: %v", err)
+	}
+}
+
+func printReport(r interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
 func setEnvironments(c *cli.Context) error {
 	if c.GlobalBool("debug") {
 		logrus.SetLevel(logrus.DebugLevel)
@@ -97,14 +314,34 @@ func setEnvironments(c *cli.Context) error {
 			return err
 		}
 		if os.Getenv(k) == "" {
-			if k == "CORE_DNS_DB_FILE" || k == "CORE_DNS_DB_ZONE" {
+			if optionalFlags[k] {
 				continue
 			}
 			return errors.Errorf("expected argument: %s", strings.ToLower(k))
 		}
 	}
 
-	return os.Setenv("FROZEN", c.GlobalString("frozen"))
+	for _, k := range globalFlags {
+		if err := os.Setenv(k, c.GlobalString(strings.ToLower(k))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setPolicy() error {
+	p, err := policy.NewPolicy()
+	if err != nil {
+		return err
+	}
+	policy.SetPolicy(p)
+
+	if err := backend.SetLeaseBounds(os.Getenv("MIN_LEASE_TIME"), os.Getenv("MAX_LEASE_TIME")); err != nil {
+		return err
+	}
+
+	return backend.SetReservedPatterns(os.Getenv("RESERVED_NAMES_FILE"), os.Getenv("RESERVED_NAMES"))
 }
 
 func setBackend() (*etcdv3.Backend, error) {
@@ -122,27 +359,23 @@ func generateCoreFile() error {
 	if fp == "" {
 		return errors.New("failed to get core dns file")
 	}
-	_, err := os.Stat(fp)
+	if _, err := os.Stat(fp); err == nil {
+		return nil
+	}
+
+	// render CoreFile template
+	cf, err := newCoreFile()
 	if err != nil {
-		// render CoreFile template
-		cf := &model.CoreFile{
-			CoreDNSDBFile:  os.Getenv("CORE_DNS_DB_FILE"),
-			CoreDNSDBZone:  os.Getenv("CORE_DNS_DB_ZONE"),
-			Domain:         os.Getenv("DOMAIN"),
-			EtcdPrefixPath: os.Getenv("ETCD_PREFIX_PATH"),
-			EtcdEndpoints:  strings.Join(strings.Split(os.Getenv("ETCD_ENDPOINTS"), ","), " "),
-			TTL:            os.Getenv("TTL"),
-			WildCardBound:  strconv.Itoa(len(strings.Split(strings.TrimRight(os.Getenv("DOMAIN"), "."), ".")) + 1),
-		}
-		p := template.Must(template.New("corefile-tmpl").Parse(model.CoreFileTmpl))
-		f, err := os.OpenFile(fp, os.O_WRONLY|os.O_CREATE, os.ModePerm)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-		if err := p.Execute(f, cf); err != nil {
-			return err
-		}
+		return errors.Wrapf(err, "invalid core dns options")
 	}
-	return nil
+	if err := cf.Validate(); err != nil {
+		return errors.Wrapf(err, "invalid core dns options")
+	}
+
+	p := template.Must(template.New("corefile-tmpl").Funcs(template.FuncMap{"join": strings.Join}).Parse(model.CoreFileTmpl))
+	buf := &bytes.Buffer{}
+	if err := p.Execute(buf, cf); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fp, buf.Bytes(), os.ModePerm)
 }
@@ -0,0 +1,198 @@
+package migrate
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/rancher/rdns-server/backend"
+	"github.com/rancher/rdns-server/backend/etcdv3"
+	"github.com/rancher/rdns-server/backend/route53"
+	"github.com/rancher/rdns-server/database"
+	"github.com/rancher/rdns-server/database/mysql"
+	"github.com/rancher/rdns-server/migrate"
+	"github.com/rancher/rdns-server/policy"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var (
+	// flags are the flags of both backends, the ttl is the route53 ttl
+	flags = map[string]map[string]string{
+		"AWS_HOSTED_ZONE_ID":    {"used to set aws hosted zone ID.": ""},
+		"AWS_ACCESS_KEY_ID":     {"used to set aws access key ID.": ""},
+		"AWS_SECRET_ACCESS_KEY": {"used to set aws secret access key.": ""},
+		"DATABASE":              {"used to set database driver.": "mysql"},
+		"DATABASE_LEASE_TIME":   {"used to set database lease time.": "240h"},
+		"DSN":                   {"used to set database dsn.": ""},
+		"TTL":                   {"used to set route53 ttl.": "10"},
+		"DOMAIN":                {"used to set etcd root domain.": "lb.rancher.cloud"},
+		"ETCD_ENDPOINTS":        {"used to set etcd endpoints.": "http://127.0.0.1:2379"},
+		"ETCD_PREFIX_PATH":      {"used to set etcd prefix path.": "/rdnsv3"},
+		"ETCD_LEASE_TIME":       {"used to set etcd lease time.": "240h"},
+	}
+)
+
+var globalFlags = []string{
+	"FROZEN",
+	"MIN_LEASE_TIME",
+	"MAX_LEASE_TIME",
+	"GRACE_PERIOD",
+	"PARKING_ADDRESS",
+	"RESERVED_NAMES_FILE",
+	"RESERVED_NAMES",
+	"HOST_POLICY_FILE",
+	"HOST_POLICY_DENY",
+	"HOST_POLICY_ALLOW",
+}
+
+func Flags() []cli.Flag {
+	fgs := []cli.Flag{
+		cli.StringFlag{
+			Name:  "from",
+			Usage: "used to set the backend to migrate from, route53 or etcdv3.",
+			Value: route53.Name,
+		},
+		cli.StringFlag{
+			Name:  "to",
+			Usage: "used to set the backend to migrate to, route53 or etcdv3.",
+			Value: etcdv3.Name,
+		},
+		cli.StringFlag{
+			Name:  "state-file",
+			Usage: "used to set the file which keeps the migrated entries, a migration is resumed with the same file.",
+		},
+		cli.BoolFlag{
+			Name:  "verify-only",
+			Usage: "used to compare both backends without migrating anything.",
+		},
+	}
+	for key, value := range flags {
+		for k, v := range value {
+			f := cli.StringFlag{
+				Name:   strings.ToLower(key),
+				EnvVar: key,
+				Usage:  k,
+				Value:  v,
+			}
+			fgs = append(fgs, f)
+		}
+	}
+	return fgs
+}
+
+// Action migrates every domain and frozen prefix from one backend to the other and prints the cutover report,
+// it fails when the target is not ready for the cutover.
+func Action(c *cli.Context) error {
+	if err := setEnvironments(c); err != nil {
+		return errors.Wrapf(err, "failed to set environments")
+	}
+
+	d, err := setDatabase(c)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	r53, err := route53.NewBackend()
+	if err != nil {
+		return err
+	}
+
+	ev3, err := etcdv3.NewBackend()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := ev3.C.Close(); err != nil {
+			logrus.Fatalf("failed to close etcd-v3 client: %v", err)
+		}
+	}()
+
+	if err := backend.SetLeaseBounds(os.Getenv("MIN_LEASE_TIME"), os.Getenv("MAX_LEASE_TIME")); err != nil {
+		return err
+	}
+	if err := backend.SetReservedPatterns(os.Getenv("RESERVED_NAMES_FILE"), os.Getenv("RESERVED_NAMES")); err != nil {
+		return err
+	}
+
+	// the hosts of the migrated domains must pass the host policy of the target
+	p, err := policy.NewPolicy()
+	if err != nil {
+		return err
+	}
+	policy.SetPolicy(p)
+
+	backends := map[string]backend.Backend{
+		route53.Name: r53,
+		etcdv3.Name:  ev3,
+	}
+	from, ok := backends[c.String("from")]
+	if !ok {
+		return errors.Errorf("unknown backend: %s", c.String("from"))
+	}
+	to, ok := backends[c.String("to")]
+	if !ok {
+		return errors.Errorf("unknown backend: %s", c.String("to"))
+	}
+
+	r, err := migrate.Run(from, to, &migrate.Options{
+		StateFile:  c.String("state-file"),
+		VerifyOnly: c.Bool("verify-only"),
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(r); err != nil {
+		return err
+	}
+
+	if !r.Ready {
+		return errors.Errorf("%s is not ready for the cutover, %d failures", r.To, len(r.Failures))
+	}
+
+	return nil
+}
+
+func setEnvironments(c *cli.Context) error {
+	if c.GlobalBool("debug") {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+
+	for k := range flags {
+		if err := os.Setenv(k, c.String(strings.ToLower(k))); err != nil {
+			return err
+		}
+		if os.Getenv(k) == "" {
+			return errors.Errorf("expected argument: %s", strings.ToLower(k))
+		}
+	}
+
+	for _, k := range globalFlags {
+		if err := os.Setenv(k, c.GlobalString(strings.ToLower(k))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setDatabase(c *cli.Context) (d *mysql.Database, err error) {
+	switch c.String("database") {
+	case mysql.DriverName:
+		d, err = mysql.NewDatabase(c.String("dsn"))
+		if err != nil {
+			return nil, err
+		}
+		database.SetDatabase(d)
+	default:
+		return nil, errors.New("no suitable database found")
+	}
+
+	return d, nil
+}
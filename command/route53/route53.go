@@ -1,16 +1,21 @@
 package route53
 
 import (
-	"net/http"
+	"encoding/json"
 	"os"
 	"strings"
 
 	"github.com/rancher/rdns-server/backend"
 	"github.com/rancher/rdns-server/backend/route53"
+	"github.com/rancher/rdns-server/backup"
 	"github.com/rancher/rdns-server/database"
 	"github.com/rancher/rdns-server/database/mysql"
+	"github.com/rancher/rdns-server/health"
+	"github.com/rancher/rdns-server/leader"
 	"github.com/rancher/rdns-server/metric"
+	"github.com/rancher/rdns-server/policy"
 	"github.com/rancher/rdns-server/purge"
+	"github.com/rancher/rdns-server/reconcile"
 	"github.com/rancher/rdns-server/service"
 
 	"github.com/pkg/errors"
@@ -30,6 +35,45 @@ var (
 	}
 )
 
+const leaderLockName = "rdns-server-leader"
+
+var globalFlags = []string{
+	"FROZEN",
+	"LEADER_ELECTION_TTL",
+	"MIN_LEASE_TIME",
+	"MAX_LEASE_TIME",
+	"GRACE_PERIOD",
+	"PARKING_ADDRESS",
+	"PURGE_INTERVAL",
+	"PURGE_BATCH_SIZE",
+	"PURGE_DRY_RUN",
+	"HEALTH_CHECK_INTERVAL",
+	"HEALTH_CHECK_WORKERS",
+	"HEALTH_CHECK_INTERNAL",
+	"RECONCILE_INTERVAL",
+	"RECONCILE_REPAIR",
+	"PLAIN_LISTEN",
+	"TLS_CERT_FILE",
+	"TLS_KEY_FILE",
+	"TLS_CLIENT_CA_FILE",
+	"TLS_CLIENT_AUTH",
+	"TLS_ADMIN_NAMES",
+	"HOST_POLICY_FILE",
+	"HOST_POLICY_DENY",
+	"HOST_POLICY_ALLOW",
+	"RESERVED_NAMES_FILE",
+	"RESERVED_NAMES",
+	"AUTH_CHAIN",
+	"AUTH_SIGNATURE_SKEW",
+	"AUTH_API_KEYS_FILE",
+	"AUTH_JWT_ISSUER",
+	"AUTH_JWT_AUDIENCE",
+	"AUTH_JWT_JWKS_URL",
+	"AUTH_JWT_SECRET",
+	"AUTH_JWT_FQDNS_CLAIM",
+	"AUTH_JWT_ADMIN_CLAIM",
+}
+
 func Flags() []cli.Flag {
 	fgs := make([]cli.Flag, 0)
 	for key, value := range flags {
@@ -61,23 +105,154 @@ func Action(c *cli.Context) error {
 		return err
 	}
 
+	if err := setPolicy(); err != nil {
+		return err
+	}
+
 	done := make(chan struct{})
 
+	ttl, err := leader.GetElectionTTL()
+	if err != nil {
+		return err
+	}
+	leader.StartElection(leader.NewMySQLElector(d.Db, leaderLockName, ttl), done)
+
 	go metric.StartMetricDaemon(done)
 
 	go purge.StartPurgerDaemon(done)
 
-	go func() {
-		if err := http.ListenAndServe(c.GlobalString("listen"), service.NewRouter()); err != nil {
-			logrus.Error(err)
-			done <- struct{}{}
-		}
-	}()
+	if err := health.StartHealthDaemon(done); err != nil {
+		return err
+	}
+
+	if err := reconcile.StartReconcileDaemon(done); err != nil {
+		return err
+	}
+
+	if err := service.StartServer(c.GlobalString("listen"), done); err != nil {
+		return err
+	}
 
 	<-done
 	return nil
 }
 
+func Subcommands() []cli.Command {
+	return []cli.Command{
+		{
+			Name:  "reconcile",
+			Usage: "compare route53 with the database and report the differences",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "repair",
+					Usage: "used to repair the differences, route53 is preferred when the values differ.",
+				},
+			},
+			Action: ReconcileAction,
+		},
+		{
+			Name:  "export",
+			Usage: "export the domains, tokens and frozen prefixes as NDJSON",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "file",
+					Usage: "used to set the file to write, the standard output is used by default.",
+				},
+			},
+			Action: ExportAction,
+		},
+		{
+			Name:  "import",
+			Usage: "import the domains, tokens and frozen prefixes of an export",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "file",
+					Usage: "used to set the file to read, the standard input is used by default.",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "used to validate the file without importing it.",
+				},
+			},
+			Action: ImportAction,
+		},
+	}
+}
+
+// ReconcileAction runs the reconcile process once with the flags of the route53 command and prints the report.
+func ReconcileAction(c *cli.Context) error {
+	d, err := setSubcommand(c)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	r, err := reconcile.RunOnce(c.Bool("repair"))
+	if err != nil {
+		return err
+	}
+
+	return printReport(r)
+}
+
+// ExportAction writes the export of the route53 backend to a file or the standard output.
+func ExportAction(c *cli.Context) error {
+	d, err := setSubcommand(c)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return backup.ExportFile(c.String("file"))
+}
+
+// ImportAction imports an export into the route53 backend and prints the report.
+func ImportAction(c *cli.Context) error {
+	d, err := setSubcommand(c)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	r, err := backup.ImportFile(c.String("file"), c.Bool("dry-run"))
+	if err != nil {
+		return err
+	}
+
+	return printReport(r)
+}
+
+// Used to set up a subcommand with the flags of the route53 command
+func setSubcommand(c *cli.Context) (*mysql.Database, error) {
+	p := c.Parent()
+	if err := setEnvironments(p); err != nil {
+		return nil, errors.Wrapf(err, "failed to set environments")
+	}
+
+	d, err := setDatabase(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setBackend(); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	if err := setPolicy(); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func printReport(r interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
 func setEnvironments(c *cli.Context) error {
 	if c.GlobalBool("debug") {
 		logrus.SetLevel(logrus.DebugLevel)
@@ -92,7 +267,13 @@ func setEnvironments(c *cli.Context) error {
 		}
 	}
 
-	return os.Setenv("FROZEN", c.GlobalString("frozen"))
+	for _, k := range globalFlags {
+		if err := os.Setenv(k, c.GlobalString(strings.ToLower(k))); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func setDatabase(c *cli.Context) (d *mysql.Database, err error) {
@@ -110,6 +291,20 @@ func setDatabase(c *cli.Context) (d *mysql.Database, err error) {
 	return d, nil
 }
 
+func setPolicy() error {
+	p, err := policy.NewPolicy()
+	if err != nil {
+		return err
+	}
+	policy.SetPolicy(p)
+
+	if err := backend.SetLeaseBounds(os.Getenv("MIN_LEASE_TIME"), os.Getenv("MAX_LEASE_TIME")); err != nil {
+		return err
+	}
+
+	return backend.SetReservedPatterns(os.Getenv("RESERVED_NAMES_FILE"), os.Getenv("RESERVED_NAMES"))
+}
+
 func setBackend() error {
 	b, err := route53.NewBackend()
 	if err != nil {
@@ -40,10 +40,22 @@ type Transferer interface {
 	// MinTTL returns the minimum TTL to be used in the SOA record.
 	MinTTL(state request.Request) uint32
 
+	// SOAFields returns the other fields of the SOA record, empty fields take the defaults.
+	SOAFields(state request.Request) SOAFields
+
 	// Transfer handles a zone transfer it writes to the client just
 	// like any other handler.
 	Transfer(ctx context.Context, state request.Request) (int, error)
 }
 
+// SOAFields are the fields of a SOA record besides the serial and the minimum TTL.
+type SOAFields struct {
+	Mname   string
+	Rname   string
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+}
+
 // Options are extra options that can be specified for a lookup.
 type Options struct{}
@@ -57,15 +57,8 @@ func A(ctx context.Context, b ServiceBackend, zone string, state request.Request
 				continue
 			}
 			// This means we can not complete the CNAME, try to look else where.
-			target := newRecord.Target
-			// Lookup
-			m1, e1 := b.Lookup(ctx, state, target, state.QType())
-			if e1 != nil {
-				continue
-			}
-			// Len(m1.Answer) > 0 here is well?
 			records = append(records, newRecord)
-			records = append(records, m1.Answer...)
+			records = append(records, lookupTarget(ctx, b, state, newRecord.Target)...)
 			continue
 
 		case dns.TypeA:
@@ -125,14 +118,8 @@ func AAAA(ctx context.Context, b ServiceBackend, zone string, state request.Requ
 				continue
 			}
 			// This means we can not complete the CNAME, try to look else where.
-			target := newRecord.Target
-			m1, e1 := b.Lookup(ctx, state, target, state.QType())
-			if e1 != nil {
-				continue
-			}
-			// Len(m1.Answer) > 0 here is well?
 			records = append(records, newRecord)
-			records = append(records, m1.Answer...)
+			records = append(records, lookupTarget(ctx, b, state, newRecord.Target)...)
 			continue
 			// both here again
 
@@ -414,6 +401,23 @@ func SOA(ctx context.Context, b ServiceBackend, zone string, state request.Reque
 		Expire:  86400,
 		Minttl:  minTTL,
 	}
+
+	f := b.SOAFields(state)
+	if f.Mname != "" {
+		soa.Ns = f.Mname
+	}
+	if f.Rname != "" {
+		soa.Mbox = f.Rname
+	}
+	if f.Refresh > 0 {
+		soa.Refresh = f.Refresh
+	}
+	if f.Retry > 0 {
+		soa.Retry = f.Retry
+	}
+	if f.Expire > 0 {
+		soa.Expire = f.Expire
+	}
 	return []dns.RR{soa}, nil
 }
 
@@ -440,6 +444,16 @@ func newAddress(s msg.Service, name string, ip net.IP, what uint16) dns.RR {
 	return &dns.AAAA{Hdr: hdr, AAAA: ip}
 }
 
+// lookupTarget resolves the target of a CNAME which is not in the zone with the upstream, the records keep the
+// ttls of the upstream. None are returned when the target can not be resolved, the CNAME is answered alone then.
+func lookupTarget(ctx context.Context, b ServiceBackend, state request.Request, target string) []dns.RR {
+	m, err := b.Lookup(ctx, state, target, state.QType())
+	if err != nil || m == nil || m.Rcode != dns.RcodeSuccess {
+		return nil
+	}
+	return m.Answer
+}
+
 // checkForApex checks the special apex.dns directory for records that will be returned as A or AAAA.
 func checkForApex(ctx context.Context, b ServiceBackend, zone string, state request.Request, opt Options) ([]msg.Service, error) {
 	if state.Name() != zone {
@@ -0,0 +1,198 @@
+package rdns
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rancher/rdns-server/coredns/plugin/rdns/msg"
+
+	etcdcv3 "github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+const (
+	cacheResyncStarted   = "started"
+	cacheResyncCompacted = "compacted"
+	cacheResyncBroken    = "broken"
+)
+
+// recordCache is the keys of a zone in memory, it is loaded by a range read and kept current by the watch of the
+// zone. The queries are answered from it once it is loaded, even when the watch is broken and it is stale.
+type recordCache struct {
+	sync.RWMutex
+	prefix string
+	loaded bool
+	keys   []string // sorted, to scan the keys of a prefix
+	kvs    map[string]*mvccpb.KeyValue
+}
+
+func newRecordCache(prefix string) *recordCache {
+	return &recordCache{
+		prefix: prefix,
+		kvs:    make(map[string]*mvccpb.KeyValue),
+	}
+}
+
+// Used to get the cache which holds the path, returns nil when the cache is not loaded yet
+func (e *ETCD) cacheOf(path string) *recordCache {
+	for _, c := range e.caches {
+		if strings.HasPrefix(path+"/", c.prefix) {
+			c.RLock()
+			loaded := c.loaded
+			c.RUnlock()
+			if loaded {
+				return c
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// Used to load the keys of a zone with a range read, returns the revision of the read and the revision of the
+// last change of the zone: the highest mod revision of its keys, or the revision of the read when a key is deleted
+// since the cache was loaded last time
+func (e *ETCD) loadCache(ctx context.Context, zone string) (int64, int64, bool, error) {
+	c := e.caches[zone]
+
+	ctx, cancel := context.WithTimeout(ctx, etcdTimeout)
+	defer cancel()
+
+	r, err := e.Client.Get(ctx, c.prefix, etcdcv3.WithPrefix())
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	var rev int64
+	for _, kv := range r.Kvs {
+		if kv.ModRevision > rev {
+			rev = kv.ModRevision
+		}
+	}
+
+	deleted := c.reset(r.Kvs)
+	if deleted {
+		rev = r.Header.Revision
+	}
+	cacheRecordsGauge.WithLabelValues(zone).Set(float64(len(r.Kvs)))
+	cacheStaleGauge.WithLabelValues(zone).Set(0)
+
+	return r.Header.Revision, rev, deleted, nil
+}
+
+// Used to apply the events of the watch of a zone
+func (e *ETCD) updateCache(zone string, events []*etcdcv3.Event) {
+	c := e.caches[zone]
+
+	n := c.apply(events)
+	cacheRecordsGauge.WithLabelValues(zone).Set(float64(n))
+	cacheUpdatedGauge.WithLabelValues(zone).SetToCurrentTime()
+}
+
+// Used to report how long the cache of a zone has not followed etcd
+func (e *ETCD) staleCache(zone string, since time.Time) {
+	cacheStaleGauge.WithLabelValues(zone).Set(time.Since(since).Seconds())
+}
+
+// Used to replace the keys of the cache, returns whether a key of the loaded cache is deleted
+func (c *recordCache) reset(kvs []*mvccpb.KeyValue) bool {
+	keys := make([]string, 0, len(kvs))
+	m := make(map[string]*mvccpb.KeyValue, len(kvs))
+	for _, kv := range kvs {
+		k := string(kv.Key)
+		keys = append(keys, k)
+		m[k] = kv
+	}
+	sort.Strings(keys)
+
+	c.Lock()
+	defer c.Unlock()
+
+	deleted := false
+	if c.loaded {
+		for k := range c.kvs {
+			if _, ok := m[k]; !ok {
+				deleted = true
+				break
+			}
+		}
+	}
+
+	c.keys, c.kvs, c.loaded = keys, m, true
+	return deleted
+}
+
+// Used to apply the puts and deletes of the events, returns the number of keys
+func (c *recordCache) apply(events []*etcdcv3.Event) int {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, ev := range events {
+		k := string(ev.Kv.Key)
+		i := sort.SearchStrings(c.keys, k)
+		exist := i < len(c.keys) && c.keys[i] == k
+
+		switch ev.Type {
+		case mvccpb.PUT:
+			if !exist {
+				c.keys = append(c.keys, "")
+				copy(c.keys[i+1:], c.keys[i:])
+				c.keys[i] = k
+			}
+			c.kvs[k] = ev.Kv
+		case mvccpb.DELETE:
+			if exist {
+				c.keys = append(c.keys[:i], c.keys[i+1:]...)
+			}
+			delete(c.kvs, k)
+		}
+	}
+
+	return len(c.keys)
+}
+
+// Used to get the key of the path and the keys under it, the same as a range read of etcd
+func (c *recordCache) get(path string, recursive bool) []*mvccpb.KeyValue {
+	c.RLock()
+	defer c.RUnlock()
+
+	if recursive {
+		if kvs := c.scan(strings.TrimSuffix(path, "/")+"/", 0); len(kvs) > 0 {
+			return kvs
+		}
+	}
+
+	if kv, ok := c.kvs[strings.TrimSuffix(path, "/")]; ok {
+		return []*mvccpb.KeyValue{kv}
+	}
+	return nil
+}
+
+// Used to check whether any key starts with the prefix
+func (c *recordCache) exist(prefix string) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return len(c.scan(prefix, 1)) > 0
+}
+
+// Used to get the keys which start with the prefix, all of them when limit is 0
+func (c *recordCache) scan(prefix string, limit int) []*mvccpb.KeyValue {
+	kvs := make([]*mvccpb.KeyValue, 0)
+	for i := sort.SearchStrings(c.keys, prefix); i < len(c.keys) && strings.HasPrefix(c.keys[i], prefix); i++ {
+		kvs = append(kvs, c.kvs[c.keys[i]])
+		if limit > 0 && len(kvs) >= limit {
+			break
+		}
+	}
+	return kvs
+}
+
+// Used to get the prefix of the keys of a zone
+// e.g. lb.rancher.cloud. => /rdnsv3/cloud/rancher/lb/
+func cachePrefix(zone, pathPrefix string) string {
+	return msg.Path(zone, pathPrefix) + "/"
+}
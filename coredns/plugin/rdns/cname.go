@@ -0,0 +1,79 @@
+package rdns
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// maxLookups is the number of the upstream lookups which may be nested to resolve a chain of CNAMEs, the upstream
+// queries this server again when a target is in the zone, so a loop of CNAMEs would never end.
+const maxLookups = 8
+
+var (
+	errNoUpstream = errors.New("no upstream to resolve the CNAME target")
+	errLookupLoop = errors.New("too many nested lookups to resolve the CNAME target")
+)
+
+// lookupKey is the context key of the number of the nested upstream lookups.
+type lookupKey struct{}
+
+// Used to resolve the target of a CNAME which is not in the zone with the upstream
+func (e *ETCD) lookup(ctx context.Context, state request.Request, name string, typ uint16) (*dns.Msg, error) {
+	if e.Upstream == nil {
+		upstreamLookupsCounter.WithLabelValues(lookupResultFailed).Inc()
+		return nil, errNoUpstream
+	}
+
+	n, _ := ctx.Value(lookupKey{}).(int)
+	if n >= maxLookups {
+		upstreamLookupsCounter.WithLabelValues(lookupResultLoop).Inc()
+		return nil, errLookupLoop
+	}
+
+	m, err := e.Upstream.Lookup(context.WithValue(ctx, lookupKey{}, n+1), state, name, typ)
+	if err != nil || m == nil || m.Rcode != dns.RcodeSuccess {
+		upstreamLookupsCounter.WithLabelValues(lookupResultFailed).Inc()
+		return m, err
+	}
+
+	upstreamLookupsCounter.WithLabelValues(lookupResultResolved).Inc()
+	return m, nil
+}
+
+// Used to flatten the CNAME chain of an answer into the addresses of its target which are owned by the query name,
+// e.g. the apex of a zone can not hold a CNAME. The ttl of the addresses is the lowest ttl of the chain, so that
+// they expire with the upstream records. The answer is kept as it is when the chain ends in no address
+func flattenCNAME(state request.Request, records []dns.RR) []dns.RR {
+	chained := false
+	ttl := uint32(math.MaxUint32)
+	addrs := make([]dns.RR, 0, len(records))
+	for _, rr := range records {
+		switch rr.Header().Rrtype {
+		case dns.TypeCNAME:
+			chained = true
+		case state.QType():
+			addrs = append(addrs, rr)
+		default:
+			continue
+		}
+		if rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	if !chained || len(addrs) == 0 {
+		return records
+	}
+
+	result := make([]dns.RR, 0, len(addrs))
+	for _, rr := range addrs {
+		rr = dns.Copy(rr)
+		rr.Header().Name = state.QName()
+		rr.Header().Ttl = ttl
+		result = append(result, rr)
+	}
+	return dns.Dedup(result, nil)
+}
@@ -0,0 +1,526 @@
+package rdns
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/coredns/coredns/request"
+	etcdcv3 "github.com/coreos/etcd/clientv3"
+	"github.com/miekg/dns"
+)
+
+const (
+	dnssecPath = "/dnssecv3"
+
+	signatureValidity  = 7 * 24 * time.Hour // validity of a signature
+	signatureRefresh   = 3 * 24 * time.Hour // a cached signature is signed again when it expires within
+	signatureInception = time.Hour          // a signature is valid from before it is signed for the clock skew
+	maxSignatures      = 10000              // max cached signatures, the cache is cleared when it is full
+
+	keyRefresh            = time.Minute         // interval to load and roll the keys of etcd
+	defaultZSKLifetime    = 30 * 24 * time.Hour // default time a zone signing key signs
+	zskPrePublish         = 48 * time.Hour      // a zone signing key is published before it signs
+	zskPostRetire         = 48 * time.Hour      // a zone signing key is published after it is retired
+	kskPrePublish         = 7 * 24 * time.Hour  // a key signing key is published before it signs, to add its DS
+	kskPostRetire         = 7 * 24 * time.Hour  // a key signing key is published after it is retired, to remove its DS
+	generatedKeyBits      = 256
+	generatedKeyAlgorithm = dns.ECDSAP256SHA256
+)
+
+// dnssecConfig is the dnssec configuration of the plugin, the keys are loaded from files or kept in etcd.
+type dnssecConfig struct {
+	enabled     bool
+	keyFiles    []string
+	zskLifetime time.Duration
+	kskLifetime time.Duration // the key signing keys are not rolled when it is 0
+	keyrings    map[string]*keyring
+}
+
+// keyring is the keys of a zone which are published and which are signing, with the signatures they signed.
+type keyring struct {
+	sync.RWMutex
+	zone    string
+	dnskeys []dns.RR
+	zsks    []*signingKey
+	ksks    []*signingKey
+
+	cacheLock sync.Mutex
+	cache     map[string]*dns.RRSIG
+}
+
+type signingKey struct {
+	dnskey *dns.DNSKEY
+	signer crypto.Signer
+}
+
+// Used to get the keyring of a zone, returns nil when dnssec is not enabled
+func (e *ETCD) keyring(zone string) *keyring {
+	if !e.dnssec.enabled {
+		return nil
+	}
+	return e.dnssec.keyrings[zone]
+}
+
+// Used to load the keys of every zone, the keys of etcd are loaded and rolled again until ctx is done
+func (e *ETCD) startDNSSEC(ctx context.Context) error {
+	if !e.dnssec.enabled {
+		return nil
+	}
+
+	if len(e.dnssec.keyFiles) > 0 {
+		keys, err := loadKeyFiles(e.dnssec.keyFiles)
+		if err != nil {
+			return err
+		}
+		for zone, r := range e.dnssec.keyrings {
+			if len(keys[zone]) == 0 {
+				return fmt.Errorf("no dnssec key of zone %s", zone)
+			}
+			if err := r.set(keys[zone], time.Now()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for zone, r := range e.dnssec.keyrings {
+		if err := e.refreshKeys(ctx, zone, r); err != nil {
+			log.Errorf("Failed to load the dnssec keys of %s: %v", zone, err)
+		}
+		go e.maintainKeys(ctx, zone, r)
+	}
+
+	return nil
+}
+
+func (e *ETCD) maintainKeys(ctx context.Context, zone string, r *keyring) {
+	ticker := time.NewTicker(keyRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.refreshKeys(ctx, zone, r); err != nil {
+				log.Errorf("Failed to load the dnssec keys of %s: %v", zone, err)
+			}
+		}
+	}
+}
+
+// Used to load the keys of a zone from etcd and roll them when it is time. The keys of a zone are kept in one key,
+// which is only put when it is not changed by another replica since it is read, the replica which loses reads it again
+func (e *ETCD) refreshKeys(ctx context.Context, zone string, r *keyring) error {
+	path := e.dnssecKeyPath(zone)
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(ctx, etcdTimeout)
+		resp, err := e.Client.Get(ctx, path)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		ks := &model.DNSSECKeySet{Zone: zone}
+		var rev int64
+		if resp.Count > 0 {
+			if err := json.Unmarshal(resp.Kvs[0].Value, ks); err != nil {
+				return err
+			}
+			rev = resp.Kvs[0].ModRevision
+		}
+
+		now := time.Now()
+		changed, err := rollKeys(ks, now, e.dnssec.zskLifetime, e.dnssec.kskLifetime)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return r.set(ks.Keys, now)
+		}
+
+		data, err := json.Marshal(ks)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel = context.WithTimeout(ctx, etcdTimeout)
+		txn, err := e.Client.Txn(ctx).
+			If(etcdcv3.Compare(etcdcv3.ModRevision(path), "=", rev)).
+			Then(etcdcv3.OpPut(path, string(data))).
+			Commit()
+		cancel()
+		if err != nil {
+			return err
+		}
+		if txn.Succeeded {
+			log.Infof("Rolled the dnssec keys of %s", zone)
+			return r.set(ks.Keys, now)
+		}
+	}
+
+	return fmt.Errorf("dnssec keys of %s are changed by another replica", zone)
+}
+
+// Used to get the etcd key of the keys of a zone
+// e.g. lb.rancher.cloud. => /rdnsv3/dnssecv3/lb.rancher.cloud
+func (e *ETCD) dnssecKeyPath(zone string) string {
+	return fmt.Sprintf("/%s%s/%s", strings.Trim(e.PathPrefix, "/"), dnssecPath, strings.TrimSuffix(zone, "."))
+}
+
+// Used to roll the keys of a zone, returns whether they are changed:
+//
+//	the keys which are removed are dropped
+//	a key signing key and a zone signing key are generated when there are none
+//	a successor of the newest key is published before the newest one has signed for its lifetime,
+//	it signs from the end of that lifetime and the newest one is retired then
+func rollKeys(ks *model.DNSSECKeySet, now time.Time, zskLifetime, kskLifetime time.Duration) (bool, error) {
+	changed := false
+
+	keys := ks.Keys[:0]
+	for _, k := range ks.Keys {
+		if k.Remove != nil && !now.Before(*k.Remove) {
+			changed = true
+			continue
+		}
+		keys = append(keys, k)
+	}
+	ks.Keys = keys
+
+	roles := []struct {
+		flags      uint16
+		lifetime   time.Duration
+		prePublish time.Duration
+		postRetire time.Duration
+	}{
+		{model.DNSSECKeyFlagZSK, zskLifetime, zskPrePublish, zskPostRetire},
+		{model.DNSSECKeyFlagKSK, kskLifetime, kskPrePublish, kskPostRetire},
+	}
+
+	for _, role := range roles {
+		var newest *model.DNSSECKey
+		for i := range ks.Keys {
+			k := &ks.Keys[i]
+			if k.Flags == role.flags && (newest == nil || k.Activate.After(newest.Activate)) {
+				newest = k
+			}
+		}
+
+		if newest == nil {
+			k, err := generateKey(ks.Zone, role.flags, now, now)
+			if err != nil {
+				return changed, err
+			}
+			ks.Keys = append(ks.Keys, k)
+			changed = true
+			continue
+		}
+
+		if role.lifetime <= 0 || newest.Retire != nil {
+			continue
+		}
+
+		prePublish := role.prePublish
+		if prePublish > role.lifetime/2 {
+			prePublish = role.lifetime / 2
+		}
+		activate := newest.Activate.Add(role.lifetime)
+		if now.Before(activate.Add(-prePublish)) {
+			continue
+		}
+		// the resolvers need to get the new DNSKEY records before it signs
+		if min := now.Add(model.DNSSECKeyTTL * time.Second); activate.Before(min) {
+			activate = min
+		}
+
+		k, err := generateKey(ks.Zone, role.flags, now, activate)
+		if err != nil {
+			return changed, err
+		}
+		remove := activate.Add(role.postRetire)
+		newest.Retire, newest.Remove = &activate, &remove
+
+		ks.Keys = append(ks.Keys, k)
+		changed = true
+	}
+
+	return changed, nil
+}
+
+func generateKey(zone string, flags uint16, publish, activate time.Time) (model.DNSSECKey, error) {
+	k := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: dns.Fqdn(zone), Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: model.DNSSECKeyTTL},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: generatedKeyAlgorithm,
+	}
+
+	priv, err := k.Generate(generatedKeyBits)
+	if err != nil {
+		return model.DNSSECKey{}, err
+	}
+
+	return model.DNSSECKey{
+		KeyTag:     k.KeyTag(),
+		Flags:      k.Flags,
+		Algorithm:  k.Algorithm,
+		PublicKey:  k.PublicKey,
+		PrivateKey: k.PrivateKeyString(priv),
+		Publish:    publish,
+		Activate:   activate,
+	}, nil
+}
+
+// Used to load keys from the files of bind, each name is the prefix of a .key and a .private file,
+// e.g. Klb.rancher.cloud.+013+12345. Returns the keys by zone, which always sign
+func loadKeyFiles(names []string) (map[string][]model.DNSSECKey, error) {
+	keys := make(map[string][]model.DNSSECKey)
+
+	for _, name := range names {
+		name = strings.TrimSuffix(strings.TrimSuffix(name, ".key"), ".private")
+
+		pub, err := os.Open(name + ".key")
+		if err != nil {
+			return nil, err
+		}
+		rr, err := dns.ReadRR(pub, name+".key")
+		pub.Close()
+		if err != nil {
+			return nil, err
+		}
+		k, ok := rr.(*dns.DNSKEY)
+		if !ok {
+			return nil, fmt.Errorf("%s.key is not a DNSKEY record", name)
+		}
+
+		priv, err := os.Open(name + ".private")
+		if err != nil {
+			return nil, err
+		}
+		p, err := k.ReadPrivateKey(priv, name+".private")
+		priv.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		zone := strings.ToLower(dns.Fqdn(k.Hdr.Name))
+		keys[zone] = append(keys[zone], model.DNSSECKey{
+			KeyTag:     k.KeyTag(),
+			Flags:      k.Flags,
+			Algorithm:  k.Algorithm,
+			PublicKey:  k.PublicKey,
+			PrivateKey: k.PrivateKeyString(p),
+		})
+	}
+
+	return keys, nil
+}
+
+// Used to set the keys which are published and which sign at the time
+func (r *keyring) set(keys []model.DNSSECKey, now time.Time) error {
+	dnskeys := make([]dns.RR, 0, len(keys))
+	zsks := make([]*signingKey, 0)
+	ksks := make([]*signingKey, 0)
+
+	for i := range keys {
+		k := &keys[i]
+		if !k.IsPublished(now) {
+			continue
+		}
+
+		dnskey := k.DNSKEY(r.zone)
+		dnskeys = append(dnskeys, dnskey)
+
+		if k.State(now) != model.DNSSECKeyActive {
+			continue
+		}
+
+		p, err := dnskey.NewPrivateKey(k.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("invalid private key %d of %s: %v", k.KeyTag, r.zone, err)
+		}
+		signer, ok := p.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("private key %d of %s can not sign", k.KeyTag, r.zone)
+		}
+
+		if k.IsKSK() {
+			ksks = append(ksks, &signingKey{dnskey: dnskey, signer: signer})
+		} else {
+			zsks = append(zsks, &signingKey{dnskey: dnskey, signer: signer})
+		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.dnskeys, r.zsks, r.ksks = dnskeys, zsks, ksks
+	return nil
+}
+
+func (r *keyring) dnskeyRecords() []dns.RR {
+	r.RLock()
+	defer r.RUnlock()
+
+	rrs := make([]dns.RR, 0, len(r.dnskeys))
+	for _, k := range r.dnskeys {
+		rrs = append(rrs, dns.Copy(k))
+	}
+	return rrs
+}
+
+// Used to sign the rrsets of a section which belong to the zone. The DNSKEY records are signed by the key signing
+// keys and the others by the zone signing keys, a key signs all when there is no key of the other kind
+func (r *keyring) signSection(rrs []dns.RR, now time.Time) []dns.RR {
+	r.RLock()
+	zsks, ksks := r.zsks, r.ksks
+	r.RUnlock()
+
+	sets := make([][]dns.RR, 0)
+	index := make(map[string]int)
+	for _, rr := range rrs {
+		h := rr.Header()
+		if h.Rrtype == dns.TypeRRSIG || h.Rrtype == dns.TypeOPT || !dns.IsSubDomain(r.zone, h.Name) {
+			continue
+		}
+
+		k := fmt.Sprintf("%s/%d", strings.ToLower(h.Name), h.Rrtype)
+		i, ok := index[k]
+		if !ok {
+			i = len(sets)
+			index[k] = i
+			sets = append(sets, nil)
+		}
+		sets[i] = append(sets[i], rr)
+	}
+
+	for _, set := range sets {
+		keys := zsks
+		if set[0].Header().Rrtype == dns.TypeDNSKEY && len(ksks) > 0 || len(zsks) == 0 {
+			keys = ksks
+		}
+
+		for _, k := range keys {
+			sig, err := r.sign(set, k, now)
+			if err != nil {
+				log.Errorf("Failed to sign %s: %v", set[0].Header().Name, err)
+				continue
+			}
+			rrs = append(rrs, sig)
+		}
+	}
+
+	return rrs
+}
+
+// Used to sign a rrset, a cached signature is used until it is about to expire
+func (r *keyring) sign(set []dns.RR, k *signingKey, now time.Time) (*dns.RRSIG, error) {
+	tag := k.dnskey.KeyTag()
+
+	ss := make([]string, 0, len(set)+1)
+	ss = append(ss, fmt.Sprint(tag))
+	for _, rr := range set {
+		ss = append(ss, rr.String())
+	}
+	sort.Strings(ss[1:])
+	key := strings.Join(ss, "\n")
+
+	r.cacheLock.Lock()
+	sig, ok := r.cache[key]
+	r.cacheLock.Unlock()
+	if ok && time.Unix(int64(sig.Expiration), 0).Sub(now) > signatureRefresh {
+		return dns.Copy(sig).(*dns.RRSIG), nil
+	}
+
+	sig = &dns.RRSIG{
+		Hdr:        dns.RR_Header{Ttl: set[0].Header().Ttl},
+		KeyTag:     tag,
+		SignerName: r.zone,
+		Algorithm:  k.dnskey.Algorithm,
+		Inception:  uint32(now.Add(-signatureInception).Unix()),
+		Expiration: uint32(now.Add(signatureValidity).Unix()),
+	}
+	if err := sig.Sign(k.signer, set); err != nil {
+		return nil, err
+	}
+
+	r.cacheLock.Lock()
+	if len(r.cache) >= maxSignatures {
+		r.cache = make(map[string]*dns.RRSIG)
+	}
+	r.cache[key] = sig
+	r.cacheLock.Unlock()
+
+	return dns.Copy(sig).(*dns.RRSIG), nil
+}
+
+// Used to deny a name or a type with a NSEC record which only covers the query name, which is known as black lies.
+// The type bitmap holds RRSIG, NSEC and the types which exist at the name but the query type, the types of the
+// apex are always there, a name which does not exist has no other types
+func (r *keyring) blackLie(name string, qtype uint16, exist []uint16, ttl uint32) *dns.NSEC {
+	types := append([]uint16{dns.TypeRRSIG, dns.TypeNSEC}, exist...)
+	if strings.EqualFold(name, r.zone) {
+		types = append(types, dns.TypeNS, dns.TypeSOA, dns.TypeDNSKEY)
+	}
+
+	bitmap := make([]uint16, 0, len(types))
+	seen := make(map[uint16]bool, len(types))
+	for _, t := range types {
+		if t != qtype && !seen[t] {
+			seen[t] = true
+			bitmap = append(bitmap, t)
+		}
+	}
+	sort.Slice(bitmap, func(i, j int) bool { return bitmap[i] < bitmap[j] })
+
+	return &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: ttl},
+		NextDomain: `\000.` + name,
+		TypeBitMap: bitmap,
+	}
+}
+
+// signingWriter signs the answers of a zone when the query has the DO bit. A NXDOMAIN is answered as NODATA,
+// so that a NODATA and a NXDOMAIN are both denied by the NSEC record of the query name only
+type signingWriter struct {
+	dns.ResponseWriter
+	state request.Request
+	r     *keyring
+	ttl   uint32
+	types func() []uint16 // Types which exist at the query name, for the NSEC record of a NODATA answer
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *signingWriter) WriteMsg(m *dns.Msg) error {
+	now := time.Now()
+
+	switch {
+	case m.Rcode == dns.RcodeNameError:
+		m.Rcode = dns.RcodeSuccess
+		m.Ns = append(m.Ns, w.r.blackLie(w.state.Name(), w.state.QType(), nil, w.ttl))
+	case m.Rcode == dns.RcodeSuccess && len(m.Answer) == 0:
+		var exist []uint16
+		if w.types != nil {
+			exist = w.types()
+		}
+		m.Ns = append(m.Ns, w.r.blackLie(w.state.Name(), w.state.QType(), exist, w.ttl))
+	}
+
+	m.Answer = w.r.signSection(m.Answer, now)
+	m.Ns = w.r.signSection(m.Ns, now)
+
+	w.state.SizeAndDo(m)
+	m = w.state.Scrub(m)
+
+	return w.ResponseWriter.WriteMsg(m)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"regexp"
 	"strings"
 	"time"
@@ -23,6 +24,7 @@ import (
 const (
 	priority    = 10  // default priority when nothing is set
 	ttl         = 300 // default ttl when nothing is set
+	minTTL      = 30  // default minimum ttl of the SOA record when nothing is set
 	etcdTimeout = 5 * time.Second
 )
 
@@ -35,9 +37,22 @@ type ETCD struct {
 	PathPrefix    string
 	Upstream      *upstream.Upstream
 	Client        *etcdcv3.Client
-	WildcardBound int8 // Calculate the boundary of WildcardDNS
+	WildcardBound int8             // Calculate the boundary of WildcardDNS
+	SOA           plugin.SOAFields // Fields of the SOA record, empty fields take the defaults
+	MinimumTTL    uint32           // Minimum ttl of the SOA record
 
-	endpoints []string // Stored here as well, to aid in testing.
+	endpoints  []string            // Stored here as well, to aid in testing.
+	transferTo []*net.IPNet        // Networks which are allowed to transfer the zones, none when empty
+	tsigKeys   map[string]*tsigKey // Keys which sign the transfers, transfers need not be signed when empty
+	revisions  map[string]*int64   // Etcd revisions of the last changes of the zones, see watchRevisions
+	notifyTo   []string            // Secondaries which are notified of the changes, none when empty
+	notifies   map[string]chan struct{}
+	caches     map[string]*recordCache // Keys of the zones in memory, see watchRevisions
+	health     *recordCache            // Health of the hosts of the domains, see watchHealth
+	weighted   int                     // Hosts which are answered of a weighted domain, see pickWeighted
+	regions    *regionDB               // Regions of the clients, hosts are answered regardless of them when it is nil
+	flatten    bool                    // Answer the addresses of the CNAME targets instead of the chains, see flattenCNAME
+	dnssec     dnssecConfig            // Keys which sign the answers, answers are not signed when it is not enabled
 }
 
 // Services implements the ServiceBackend interface.
@@ -58,7 +73,7 @@ func (e *ETCD) Reverse(ctx context.Context, state request.Request, exact bool, o
 
 // Lookup implements the ServiceBackend interface.
 func (e *ETCD) Lookup(ctx context.Context, state request.Request, name string, typ uint16) (*dns.Msg, error) {
-	return e.Upstream.Lookup(ctx, state, name, typ)
+	return e.lookup(ctx, state, name, typ)
 }
 
 // IsNameError implements the ServiceBackend interface.
@@ -100,10 +115,23 @@ func (e *ETCD) Records(ctx context.Context, state request.Request, exact bool) (
 
 	kvs := e.filterKvs(r.Kvs, segments, qType)
 
-	return e.loopNodes(kvs, segments, star, state.QType())
+	sx, err := e.loopNodes(kvs, segments, star, state.QType())
+	if err != nil {
+		return nil, err
+	}
+	return e.pickWeighted(e.pickRegional(e.dropUnhealthy(sx), state)), nil
 }
 
 func (e *ETCD) get(ctx context.Context, path string, recursive bool) (*etcdcv3.GetResponse, error) {
+	// the cache answers once it is loaded, etcd is only read before that
+	if c := e.cacheOf(path); c != nil {
+		kvs := c.get(path, recursive)
+		if len(kvs) == 0 {
+			return nil, errKeyNotFound
+		}
+		return &etcdcv3.GetResponse{Kvs: kvs, Count: int64(len(kvs))}, nil
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, etcdTimeout)
 	defer cancel()
 	if recursive == true {
@@ -231,11 +259,15 @@ func (e *ETCD) filterKvs(kvs []*mvccpb.KeyValue, segments []string, qType uint16
 }
 
 func (e *ETCD) pathExist(ctx context.Context, ss []string) bool {
+	path, _ := msg.PathWithWildcard(strings.Join(ss, "."), e.PathPrefix)
+
+	if c := e.cacheOf(path); c != nil {
+		return c.exist(path)
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, etcdTimeout)
 	defer cancel()
 
-	path, _ := msg.PathWithWildcard(strings.Join(ss, "."), e.PathPrefix)
-
 	r, err := e.Client.Get(ctx, path, etcdcv3.WithPrefix())
 	if err != nil {
 		return false
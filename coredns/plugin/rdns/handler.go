@@ -2,8 +2,10 @@ package rdns
 
 import (
 	"context"
+	"strings"
 
 	"github.com/rancher/rdns-server/coredns/plugin"
+	"github.com/rancher/rdns-server/coredns/plugin/rdns/msg"
 
 	"github.com/coredns/coredns/request"
 	"github.com/miekg/dns"
@@ -19,6 +21,24 @@ func (e *ETCD) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (
 		return plugin.NextOrFailure(ctx, e.Name(), e.Next, w, r)
 	}
 
+	// the answers of the zone are signed when the query has the DO bit, the next plugin gets the original writer.
+	// The services of the query name are kept for the NSEC record of a NODATA answer, so the lookup is not run again
+	next := w
+	var b plugin.ServiceBackend = e
+	keys := e.keyring(zone)
+	if keys != nil && state.Do() && state.QType() != dns.TypeAXFR && state.QType() != dns.TypeIXFR {
+		sr := &servicesRecorder{ETCD: e, name: state.Name()}
+		b = sr
+		w = &signingWriter{
+			ResponseWriter: w,
+			state:          state,
+			r:              keys,
+			ttl:            e.MinTTL(state),
+			types:          func() []uint16 { return e.existingTypes(sr.services) },
+		}
+		state.W = w
+	}
+
 	var (
 		records, extra []dns.RR
 		err            error
@@ -26,34 +46,53 @@ func (e *ETCD) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (
 
 	switch state.QType() {
 	case dns.TypeA:
-		records, err = plugin.A(ctx, e, zone, state, nil, opt)
+		records, err = plugin.A(ctx, b, zone, state, nil, opt)
+		if e.flatten {
+			records = flattenCNAME(state, records)
+		}
 	case dns.TypeAAAA:
-		records, err = plugin.AAAA(ctx, e, zone, state, nil, opt)
+		records, err = plugin.AAAA(ctx, b, zone, state, nil, opt)
+		if e.flatten {
+			records = flattenCNAME(state, records)
+		}
 	case dns.TypeTXT:
-		records, err = plugin.TXT(ctx, e, zone, state, opt)
+		records, err = plugin.TXT(ctx, b, zone, state, opt)
 	case dns.TypeCNAME:
-		records, err = plugin.CNAME(ctx, e, zone, state, opt)
+		records, err = plugin.CNAME(ctx, b, zone, state, opt)
+		// the names are answered with the addresses of their targets, they have no CNAME to query
+		if e.flatten {
+			records = nil
+		}
 	case dns.TypePTR:
-		records, err = plugin.PTR(ctx, e, zone, state, opt)
+		records, err = plugin.PTR(ctx, b, zone, state, opt)
 	case dns.TypeMX:
-		records, extra, err = plugin.MX(ctx, e, zone, state, opt)
+		records, extra, err = plugin.MX(ctx, b, zone, state, opt)
 	case dns.TypeSRV:
-		records, extra, err = plugin.SRV(ctx, e, zone, state, opt)
+		records, extra, err = plugin.SRV(ctx, b, zone, state, opt)
 	case dns.TypeSOA:
-		records, err = plugin.SOA(ctx, e, zone, state, opt)
+		records, err = plugin.SOA(ctx, b, zone, state, opt)
+	case dns.TypeAXFR, dns.TypeIXFR:
+		return e.Transfer(ctx, state)
+	case dns.TypeDNSKEY:
+		if keys != nil && state.Name() == zone {
+			records = keys.dnskeyRecords()
+			break
+		}
+		// Do a fake A lookup, so we can distinguish between NODATA and NXDOMAIN
+		_, err = plugin.A(ctx, b, zone, state, nil, opt)
 	case dns.TypeNS:
 		if state.Name() == zone {
-			records, extra, err = plugin.NS(ctx, e, zone, state, opt)
+			records, extra, err = plugin.NS(ctx, b, zone, state, opt)
 			break
 		}
 		fallthrough
 	default:
 		// Do a fake A lookup, so we can distinguish between NODATA and NXDOMAIN
-		_, err = plugin.A(ctx, e, zone, state, nil, opt)
+		_, err = plugin.A(ctx, b, zone, state, nil, opt)
 	}
 	if err != nil && e.IsNameError(err) {
 		if e.Fall.Through(state.Name()) {
-			return plugin.NextOrFailure(ctx, e.Name(), e.Next, w, r)
+			return plugin.NextOrFailure(ctx, e.Name(), e.Next, next, r)
 		}
 		// Make err nil when returning here, so we don't log spam for NXDOMAIN.
 		return plugin.BackendError(ctx, e, zone, dns.RcodeNameError, state, nil /* err */, opt)
@@ -71,6 +110,7 @@ func (e *ETCD) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (
 	m.Authoritative = true
 	m.Answer = append(m.Answer, records...)
 	m.Extra = append(m.Extra, extra...)
+	e.setClientSubnet(state, m)
 
 	w.WriteMsg(m)
 	return dns.RcodeSuccess, nil
@@ -78,3 +118,56 @@ func (e *ETCD) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (
 
 // Name implements the Handler interface.
 func (e *ETCD) Name() string { return "rdns" }
+
+// servicesRecorder keeps the services which are found at the query name while the query is answered
+type servicesRecorder struct {
+	*ETCD
+	name     string
+	services []msg.Service
+}
+
+// Services implements the ServiceBackend interface.
+func (r *servicesRecorder) Services(ctx context.Context, state request.Request, exact bool, opt plugin.Options) ([]msg.Service, error) {
+	services, err := r.ETCD.Services(ctx, state, exact, opt)
+	if err == nil && strings.EqualFold(state.Name(), r.name) {
+		r.services = append(r.services, services...)
+	}
+	return services, err
+}
+
+// Reverse implements the ServiceBackend interface.
+func (r *servicesRecorder) Reverse(ctx context.Context, state request.Request, exact bool, opt plugin.Options) ([]msg.Service, error) {
+	return r.Services(ctx, state, exact, opt)
+}
+
+// Used to get the types of the records which exist at the query name from the services of its lookup, a name with
+// a CNAME record has no other types unless the CNAME records are flattened, then the target may have both addresses
+func (e *ETCD) existingTypes(services []msg.Service) []uint16 {
+	exist := make(map[uint16]bool)
+	for _, serv := range services {
+		if serv.Text != "" {
+			exist[dns.TypeTXT] = true
+		}
+		if serv.Host == "" {
+			continue
+		}
+		what, _ := serv.HostType()
+		if what == dns.TypeCNAME && e.flatten {
+			exist[dns.TypeA], exist[dns.TypeAAAA] = true, true
+			continue
+		}
+		exist[what] = true
+	}
+
+	if exist[dns.TypeCNAME] {
+		return []uint16{dns.TypeCNAME}
+	}
+
+	types := make([]uint16, 0)
+	for _, t := range []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeTXT} {
+		if exist[t] {
+			types = append(types, t)
+		}
+	}
+	return types
+}
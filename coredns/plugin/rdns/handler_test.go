@@ -0,0 +1,32 @@
+package rdns
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rancher/rdns-server/coredns/plugin/rdns/msg"
+
+	"github.com/miekg/dns"
+)
+
+func TestExistingTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		flatten  bool
+		services []msg.Service
+		types    []uint16
+	}{
+		{"none", false, nil, []uint16{}},
+		{"addresses", false, []msg.Service{{Host: "1.1.1.1"}, {Host: "2001:db8::1"}}, []uint16{dns.TypeA, dns.TypeAAAA}},
+		{"text", false, []msg.Service{{Text: "challenge"}}, []uint16{dns.TypeTXT}},
+		{"cname has no other types", false, []msg.Service{{Host: "target.example.com"}, {Text: "challenge"}}, []uint16{dns.TypeCNAME}},
+		{"flattened cname", true, []msg.Service{{Host: "target.example.com"}}, []uint16{dns.TypeA, dns.TypeAAAA}},
+	}
+
+	for _, tt := range tests {
+		e := &ETCD{flatten: tt.flatten}
+		if types := e.existingTypes(tt.services); !reflect.DeepEqual(types, tt.types) {
+			t.Errorf("%s: existingTypes = %v, want %v", tt.name, types, tt.types)
+		}
+	}
+}
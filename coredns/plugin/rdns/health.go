@@ -0,0 +1,108 @@
+package rdns
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rancher/rdns-server/coredns/plugin/rdns/msg"
+	"github.com/rancher/rdns-server/model"
+
+	etcdcv3 "github.com/coreos/etcd/clientv3"
+)
+
+// healthPath is where rdns-server keeps the health of the hosts of the domains, beside the zones.
+const healthPath = "healthv3"
+
+// Used to watch the health of the hosts until ctx is done, the health is kept in a cache the same way as the keys
+// of a zone. The hosts are answered without their health until it is loaded
+func (e *ETCD) watchHealth(ctx context.Context) {
+	c := e.health
+
+	for {
+		r, err := e.loadHealth(ctx)
+		if err == nil {
+			wch := e.Client.Watch(etcdcv3.WithRequireLeader(ctx), c.prefix, etcdcv3.WithPrefix(), etcdcv3.WithRev(r+1))
+			for resp := range wch {
+				if err = resp.Err(); err != nil {
+					break
+				}
+				c.apply(resp.Events)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchRetry):
+		}
+
+		log.Warningf("Restart the watch of the health of the hosts: %v", err)
+	}
+}
+
+// Used to load the health of the hosts with a range read, returns the revision of the read
+func (e *ETCD) loadHealth(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, etcdTimeout)
+	defer cancel()
+
+	r, err := e.Client.Get(ctx, e.health.prefix, etcdcv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+
+	e.health.reset(r.Kvs)
+
+	return r.Header.Revision, nil
+}
+
+// Used to drop the unhealthy hosts of the domains from the services, a domain keeps all of its hosts when every
+// host is unhealthy. The hosts of the sub domains have no health check and are always kept
+func (e *ETCD) dropUnhealthy(sx []msg.Service) []msg.Service {
+	if e.health == nil {
+		return sx
+	}
+
+	dropped := make(map[string]map[string]bool)
+	result := make([]msg.Service, 0, len(sx))
+	for _, serv := range sx {
+		fqdn := strings.TrimSuffix(msg.Domain(path.Dir(serv.Key)), ".")
+
+		d, ok := dropped[fqdn]
+		if !ok {
+			d = e.droppedHosts(fqdn)
+			dropped[fqdn] = d
+		}
+
+		if d[serv.Host] {
+			continue
+		}
+		result = append(result, serv)
+	}
+
+	return result
+}
+
+// Used to get the unhealthy hosts of a domain which are dropped, none when the domain has no health check
+func (e *ETCD) droppedHosts(fqdn string) map[string]bool {
+	kvs := e.health.get(e.health.prefix+strings.Replace(fqdn, ".", "_", -1), false)
+	if len(kvs) == 0 {
+		return nil
+	}
+
+	s := &model.HealthState{}
+	if err := json.Unmarshal(kvs[0].Value, s); err != nil {
+		log.Warningf("Skip the invalid health of %s: %v", fqdn, err)
+		return nil
+	}
+
+	return s.Dropped()
+}
+
+// Used to get the prefix of the health of the hosts
+// e.g. rdnsv3 => /rdnsv3/healthv3/
+func healthPrefix(pathPrefix string) string {
+	return path.Join("/", pathPrefix, healthPath) + "/"
+}
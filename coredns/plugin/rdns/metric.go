@@ -0,0 +1,58 @@
+package rdns
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	notifyResultAcknowledged = "acknowledged"
+	notifyResultRejected     = "rejected"
+	notifyResultFailed       = "failed"
+
+	lookupResultResolved = "resolved"
+	lookupResultFailed   = "failed"
+	lookupResultLoop     = "loop"
+)
+
+var (
+	notifyCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rancher_dns_notify_total",
+		Help: "The number of the NOTIFY messages which are sent to the secondaries, by result",
+	}, []string{"zone", "secondary", "result"})
+
+	notifyPendingGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rancher_dns_notify_pending",
+		Help: "The number of the NOTIFY messages to the secondary which are not acknowledged yet",
+	}, []string{"zone", "secondary"})
+
+	cacheRecordsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rancher_dns_cache_records",
+		Help: "The number of the etcd keys of the zone which are cached in memory",
+	}, []string{"zone"})
+
+	cacheUpdatedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rancher_dns_cache_last_update_timestamp_seconds",
+		Help: "The time the cache of the zone last got a change from the etcd watch",
+	}, []string{"zone"})
+
+	cacheStaleGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rancher_dns_cache_stale_seconds",
+		Help: "The seconds since the cache of the zone stopped following etcd, 0 while the watch is running",
+	}, []string{"zone"})
+
+	cacheResyncCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rancher_dns_cache_resyncs_total",
+		Help: "The number of the range reads which load the cache of the zone again, by reason",
+	}, []string{"zone", "reason"})
+
+	regionAnswersCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rancher_dns_region_answers_total",
+		Help: "The number of the answers of the regional domains, by the region of the client",
+	}, []string{"region"})
+
+	upstreamLookupsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rancher_dns_upstream_lookups_total",
+		Help: "The number of the upstream lookups of the CNAME targets which are not in the zones, by result",
+	}, []string{"result"})
+)
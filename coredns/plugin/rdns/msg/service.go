@@ -32,6 +32,9 @@ type Service struct {
 	// answer.
 	Group string `json:"group,omitempty"`
 
+	// Region is the region of the clients which the host is answered to, see the regions of the rdns plugin.
+	Region string `json:"region,omitempty"`
+
 	// Etcd key where we found this service and ignored from json un-/marshalling
 	Key string `json:"-"`
 }
@@ -0,0 +1,173 @@
+package rdns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/rancher/rdns-server/coredns/plugin"
+
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+const (
+	notifyDelay    = 3 * time.Second  // the changes within the delay are coalesced into one NOTIFY
+	notifyTimeout  = 5 * time.Second  // timeout of each NOTIFY
+	notifyRetry    = 10 * time.Second // wait before the first retry, doubled after every retry
+	notifyMaxRetry = 5 * time.Minute  // max wait between two retries
+)
+
+// Used to send NOTIFY messages of every zone to the secondaries until ctx is done
+func (e *ETCD) notifySecondaries(ctx context.Context) {
+	for zone, changed := range e.notifies {
+		go e.notifyZone(ctx, zone, changed)
+	}
+}
+
+// Used to tell the secondaries that a zone is changed, a change is dropped when a NOTIFY is already waiting
+func (e *ETCD) notifyChanged(zone string) {
+	changed, ok := e.notifies[zone]
+	if !ok {
+		return
+	}
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+}
+
+// Used to send a NOTIFY to every secondary after a burst of changes, each one is sent again until it is
+// acknowledged. A NOTIFY which is not acknowledged yet is given up when a newer one is sent
+func (e *ETCD) notifyZone(ctx context.Context, zone string, changed <-chan struct{}) {
+	cancel := context.CancelFunc(func() {})
+	defer func() {
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(notifyDelay):
+		}
+		// the changes within the delay are in this NOTIFY
+		select {
+		case <-changed:
+		default:
+		}
+
+		cancel()
+		cancel = e.sendNotifies(ctx, zone)
+	}
+}
+
+// Used to send the NOTIFY of the current serial to every secondary, returns the cancel of the retries
+func (e *ETCD) sendNotifies(ctx context.Context, zone string) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+
+	m := e.newNotify(ctx, zone)
+	for _, to := range e.notifyTo {
+		go e.notifyUntilAcknowledged(ctx, zone, to, m.Copy())
+	}
+
+	return cancel
+}
+
+func (e *ETCD) notifyUntilAcknowledged(ctx context.Context, zone, to string, m *dns.Msg) {
+	notifyPendingGauge.WithLabelValues(zone, to).Inc()
+	defer notifyPendingGauge.WithLabelValues(zone, to).Dec()
+
+	wait := notifyRetry
+	for {
+		err := sendNotify(ctx, m, to)
+		if err == nil {
+			notifyCounter.WithLabelValues(zone, to, notifyResultAcknowledged).Inc()
+			log.Debugf("NOTIFY of %s is acknowledged by %s", zone, to)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if _, ok := err.(*notifyRejectedError); ok {
+			notifyCounter.WithLabelValues(zone, to, notifyResultRejected).Inc()
+		} else {
+			notifyCounter.WithLabelValues(zone, to, notifyResultFailed).Inc()
+		}
+		log.Warningf("Failed to notify %s of %s, retry in %s: %v", to, zone, wait, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		wait *= 2
+		if wait > notifyMaxRetry {
+			wait = notifyMaxRetry
+		}
+	}
+}
+
+// Used to build the NOTIFY of a zone, which holds the SOA of the current serial
+func (e *ETCD) newNotify(ctx context.Context, zone string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetNotify(zone)
+	m.Authoritative = true
+
+	if soa, err := plugin.SOA(ctx, e, zone, request.Request{Req: m}, plugin.Options{}); err == nil {
+		m.Answer = soa
+	}
+
+	return m
+}
+
+// notifyRejectedError is returned when a secondary answers a NOTIFY with an error.
+type notifyRejectedError struct {
+	rcode int
+}
+
+func (err *notifyRejectedError) Error() string {
+	return fmt.Sprintf("NOTIFY is answered with %s", dns.RcodeToString[err.rcode])
+}
+
+func sendNotify(ctx context.Context, m *dns.Msg, to string) error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	m.Id = dns.Id()
+
+	c := &dns.Client{Net: "udp", Timeout: notifyTimeout}
+	r, _, err := c.ExchangeContext(ctx, m, to)
+	if err != nil {
+		return err
+	}
+	if r.Opcode != dns.OpcodeNotify || r.Rcode != dns.RcodeSuccess {
+		return &notifyRejectedError{rcode: r.Rcode}
+	}
+	return nil
+}
+
+// Used to parse the addresses of the secondaries, the port is 53 when it is not set
+func parseNotifyTo(args []string) ([]string, error) {
+	to := make([]string, 0, len(args))
+	for _, arg := range args {
+		host, port, err := net.SplitHostPort(arg)
+		if err != nil {
+			host, port = arg, "53"
+		}
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid notify address: %s", arg)
+		}
+		to = append(to, net.JoinHostPort(host, port))
+	}
+	return to, nil
+}
@@ -0,0 +1,215 @@
+package rdns
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/rancher/rdns-server/coredns/plugin/rdns/msg"
+
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// regionNone is the region label of the clients which are in no network of the regions file.
+const regionNone = "none"
+
+// regionDB is the regions of the networks of the clients, it is loaded from a file with a network and its region
+// on each line, separated by spaces or a comma, e.g. 10.0.0.0/8 eu-west-1. A GeoIP database exported as CSV
+// with the network and the region columns fits in. The longest network which holds a client decides its region.
+type regionDB struct {
+	lengths4 []int             // Prefix lengths of the ipv4 networks, longest first
+	lengths6 []int             // Prefix lengths of the ipv6 networks, longest first
+	networks map[string]string // Regions by networks, e.g. 10.0.0.0/8 => eu-west-1
+}
+
+// Used to load the regions file, the empty lines and the comments which start with # are skipped
+func loadRegions(file string) (*regionDB, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	db := &regionDB{networks: make(map[string]string)}
+	seen := make(map[int]bool)
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected a network and its region", file, n)
+		}
+
+		_, ipnet, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, n, err)
+		}
+		db.networks[ipnet.String()] = fields[1]
+
+		ones, bits := ipnet.Mask.Size()
+		if seen[bits<<8|ones] {
+			continue
+		}
+		seen[bits<<8|ones] = true
+		if bits == net.IPv4len*8 {
+			db.lengths4 = append(db.lengths4, ones)
+		} else {
+			db.lengths6 = append(db.lengths6, ones)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(db.lengths4)))
+	sort.Sort(sort.Reverse(sort.IntSlice(db.lengths6)))
+
+	return db, nil
+}
+
+// Used to get the region of a client and the prefix length of its network, an empty region when the client is in
+// no network of the file
+func (db *regionDB) lookup(ip net.IP) (string, int) {
+	lengths, bits := db.lengths6, net.IPv6len*8
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, lengths, bits = ip4, db.lengths4, net.IPv4len*8
+	}
+
+	for _, l := range lengths {
+		mask := net.CIDRMask(l, bits)
+		n := &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+		if r, ok := db.networks[n.String()]; ok {
+			return r, l
+		}
+	}
+
+	return "", 0
+}
+
+// Used to answer the hosts of the region of the client of the regional domains, a domain is regional when one of
+// its hosts has a region. The clients of the regions without hosts get the hosts without a region, or all of the
+// hosts when every host has a region. The other services are kept as they are
+func (e *ETCD) pickRegional(sx []msg.Service, state request.Request) []msg.Service {
+	if e.regions == nil {
+		return sx
+	}
+
+	region, looked := "", false
+	dropped := make(map[int]bool)
+	for _, group := range groupHosts(sx) {
+		regional := false
+		for _, i := range group {
+			if sx[i].Region != "" {
+				regional = true
+				break
+			}
+		}
+		if !regional {
+			continue
+		}
+
+		if !looked {
+			ip, _ := clientAddress(state)
+			region, _ = e.regions.lookup(ip)
+			looked = true
+
+			label := region
+			if label == "" {
+				label = regionNone
+			}
+			regionAnswersCounter.WithLabelValues(label).Inc()
+		}
+
+		kept := regionHosts(sx, group, region)
+		if kept == nil {
+			continue
+		}
+		for _, i := range group {
+			if !kept[i] {
+				dropped[i] = true
+			}
+		}
+	}
+
+	return dropServices(sx, dropped)
+}
+
+// Used to get the hosts of a domain which are answered to the clients of the region, the hosts without a region
+// when the region has no hosts. Returns nil when all of the hosts are answered
+func regionHosts(sx []msg.Service, group []int, region string) map[int]bool {
+	kept := make(map[int]bool)
+	if region != "" {
+		for _, i := range group {
+			if sx[i].Region == region {
+				kept[i] = true
+			}
+		}
+	}
+	if len(kept) == 0 {
+		for _, i := range group {
+			if sx[i].Region == "" {
+				kept[i] = true
+			}
+		}
+	}
+
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+// Used to answer the client subnet option of a query when the regions are enabled, the scope of the answer is the
+// network of the regions file which holds the client, or the source network of the option when there is none
+func (e *ETCD) setClientSubnet(state request.Request, m *dns.Msg) {
+	if e.regions == nil {
+		return
+	}
+	ip, subnet := clientAddress(state)
+	if subnet == nil {
+		return
+	}
+
+	_, scope := e.regions.lookup(ip)
+	if scope == 0 {
+		scope = int(subnet.SourceNetmask)
+	}
+
+	o := state.Req.IsEdns0()
+	m.SetEdns0(o.UDPSize(), o.Do())
+	opt := m.IsEdns0()
+	opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        subnet.Family,
+		SourceNetmask: subnet.SourceNetmask,
+		SourceScope:   uint8(scope),
+		Address:       subnet.Address,
+	})
+}
+
+// Used to get the address of the client of a query, the address of the client subnet option when the query has
+// one, otherwise the source address of the query which is the address of the resolver
+func clientAddress(state request.Request) (net.IP, *dns.EDNS0_SUBNET) {
+	if o := state.Req.IsEdns0(); o != nil {
+		for _, opt := range o.Option {
+			if s, ok := opt.(*dns.EDNS0_SUBNET); ok && s.SourceNetmask > 0 {
+				return s.Address, s
+			}
+		}
+	}
+	return net.ParseIP(state.IP()), nil
+}
@@ -0,0 +1,182 @@
+package rdns
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	etcdcv3 "github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+const (
+	// watchRetry is the wait before a broken watch of a zone starts over.
+	watchRetry = 5 * time.Second
+	// serialPath is the path of the revisions of the deletes of the zones, under the path prefix.
+	serialPath = "/serialv3"
+)
+
+// Used to watch the keys of every zone until ctx is done, the cache of a zone is loaded by a range read and kept
+// current by the watch, and the revision of a zone only moves when one of its keys is changed. The revision of
+// a zone is the highest mod revision of its keys, a delete leaves no key behind, so the revision of the last delete
+// is kept under the serial path and the revision never moves backwards after a restart. A watch starts at the
+// revision of the range read, so a watch which is compacted or broken loads the cache again and starts over
+func (e *ETCD) watchRevisions(ctx context.Context) {
+	for _, zone := range e.Zones {
+		go e.watchRevision(ctx, zone)
+	}
+}
+
+func (e *ETCD) watchRevision(ctx context.Context, zone string) {
+	path := cachePrefix(zone, e.PathPrefix)
+	reason := cacheResyncStarted
+	var since time.Time // when the cache stopped following etcd
+
+	for {
+		cacheResyncCounter.WithLabelValues(zone, reason).Inc()
+		reason = cacheResyncBroken
+
+		read, rev, deleted, err := e.loadCache(ctx, zone)
+		if err == nil {
+			since = time.Time{}
+			if deleted {
+				e.saveDeleteRevision(ctx, zone, rev)
+			}
+			if deleted := e.deleteRevision(ctx, zone); deleted > rev {
+				rev = deleted
+			}
+			if e.setZoneRevision(zone, rev) {
+				e.notifyChanged(zone)
+			}
+
+			wch := e.Client.Watch(etcdcv3.WithRequireLeader(ctx), path, etcdcv3.WithPrefix(), etcdcv3.WithRev(read+1))
+			for resp := range wch {
+				if err = resp.Err(); err != nil {
+					if resp.CompactRevision != 0 {
+						reason = cacheResyncCompacted
+					}
+					break
+				}
+				if n := len(resp.Events); n > 0 {
+					e.updateCache(zone, resp.Events)
+					rev := resp.Events[n-1].Kv.ModRevision
+					if e.setZoneRevision(zone, rev) {
+						if hasDelete(resp.Events) {
+							e.saveDeleteRevision(ctx, zone, rev)
+						}
+						e.notifyChanged(zone)
+					}
+				}
+			}
+		}
+
+		// the cache still answers the queries while it is stale
+		if since.IsZero() {
+			since = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchRetry):
+		}
+		e.staleCache(zone, since)
+
+		log.Warningf("Restart the watch of %s: %v", zone, err)
+	}
+}
+
+// Used to get the revision of the last change of a zone, returns 0 when it is not watched yet
+func (e *ETCD) zoneRevision(zone string) int64 {
+	rev, ok := e.revisions[zone]
+	if !ok {
+		return 0
+	}
+	return atomic.LoadInt64(rev)
+}
+
+// Used to move the revision of a zone forwards, returns whether it is moved
+func (e *ETCD) setZoneRevision(zone string, rev int64) bool {
+	r, ok := e.revisions[zone]
+	if !ok {
+		return false
+	}
+	for {
+		old := atomic.LoadInt64(r)
+		if rev <= old {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(r, old, rev) {
+			return true
+		}
+	}
+}
+
+func (e *ETCD) currentRevision(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, etcdTimeout)
+	defer cancel()
+
+	r, err := e.Client.Get(ctx, e.PathPrefix, etcdcv3.WithCountOnly())
+	if err != nil {
+		return 0, err
+	}
+	return r.Header.Revision, nil
+}
+
+// Used to get the revision of the last delete of a zone, returns 0 when it is not kept
+func (e *ETCD) deleteRevision(ctx context.Context, zone string) int64 {
+	ctx, cancel := context.WithTimeout(ctx, etcdTimeout)
+	defer cancel()
+
+	r, err := e.Client.Get(ctx, deleteRevisionPath(zone, e.PathPrefix))
+	if err != nil || len(r.Kvs) == 0 {
+		return 0
+	}
+	rev, err := strconv.ParseInt(string(r.Kvs[0].Value), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return rev
+}
+
+// Used to keep the revision of the last delete of a zone, the kept revision only moves forwards when the replicas
+// of the plugin keep it at the same time
+func (e *ETCD) saveDeleteRevision(ctx context.Context, zone string, rev int64) {
+	ctx, cancel := context.WithTimeout(ctx, etcdTimeout)
+	defer cancel()
+
+	// the revisions are padded to compare them as strings
+	key, value := deleteRevisionPath(zone, e.PathPrefix), fmt.Sprintf("%020d", rev)
+
+	r, err := e.Client.Txn(ctx).
+		If(etcdcv3.Compare(etcdcv3.CreateRevision(key), "=", 0)).
+		Then(etcdcv3.OpPut(key, value)).
+		Commit()
+	if err == nil && !r.Succeeded {
+		_, err = e.Client.Txn(ctx).
+			If(etcdcv3.Compare(etcdcv3.Value(key), "<", value)).
+			Then(etcdcv3.OpPut(key, value)).
+			Commit()
+	}
+	if err != nil {
+		log.Warningf("Failed to keep the revision of the last delete of %s: %v", zone, err)
+	}
+}
+
+// Used to get the path of the revision of the last delete of a zone
+// e.g. lb.rancher.cloud. => /rdnsv3/serialv3/lb.rancher.cloud
+func deleteRevisionPath(zone, pathPrefix string) string {
+	return fmt.Sprintf("%s%s/%s", strings.TrimSuffix(pathPrefix, "/"), serialPath, strings.TrimSuffix(zone, "."))
+}
+
+func hasDelete(events []*etcdcv3.Event) bool {
+	for _, ev := range events {
+		if ev.Type == mvccpb.DELETE {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,16 @@
 package rdns
 
 import (
+	"context"
 	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
 	"strconv"
+	"strings"
+	"time"
+
+	rplugin "github.com/rancher/rdns-server/coredns/plugin"
 
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
@@ -11,6 +19,7 @@ import (
 	"github.com/coredns/coredns/plugin/pkg/upstream"
 	etcdcv3 "github.com/coreos/etcd/clientv3"
 	"github.com/mholt/caddy"
+	"github.com/miekg/dns"
 )
 
 var log = clog.NewWithPlugin("rdns")
@@ -21,6 +30,21 @@ func Setup(c *caddy.Controller) error {
 		return plugin.Error("rdns", err)
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	c.OnStartup(func() error {
+		if err := e.startDNSSEC(ctx); err != nil {
+			return plugin.Error("rdns", err)
+		}
+		e.watchRevisions(ctx)
+		go e.watchHealth(ctx)
+		e.notifySecondaries(ctx)
+		return nil
+	})
+	c.OnShutdown(func() error {
+		cancel()
+		return nil
+	})
+
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		e.Next = next
 		return e
@@ -30,13 +54,14 @@ func Setup(c *caddy.Controller) error {
 }
 
 func etcdParse(c *caddy.Controller) (*ETCD, error) {
-	etc := ETCD{PathPrefix: "skydns"}
+	etc := ETCD{PathPrefix: "skydns", weighted: defaultWeightedAnswers}
 	var (
 		tlsConfig *tls.Config
 		err       error
 		endpoints = []string{defaultEndpoint}
 		username  string
 		password  string
+		rollover  bool
 	)
 	for c.Next() {
 		etc.Zones = c.RemainingArgs()
@@ -44,8 +69,10 @@ func etcdParse(c *caddy.Controller) (*ETCD, error) {
 			etc.Zones = make([]string, len(c.ServerBlockKeys))
 			copy(etc.Zones, c.ServerBlockKeys)
 		}
+		etc.revisions = make(map[string]*int64, len(etc.Zones))
 		for i, str := range etc.Zones {
 			etc.Zones[i] = plugin.Host(str).Normalize()
+			etc.revisions[etc.Zones[i]] = new(int64)
 		}
 
 		for c.NextBlock() {
@@ -98,12 +125,130 @@ func etcdParse(c *caddy.Controller) (*ETCD, error) {
 					return &ETCD{}, c.Errf("wildcardbound value can not be negative: %d", v)
 				}
 				etc.WildcardBound = int8(v)
+			case "weighted_answers":
+				// weighted_answers COUNT
+				if !c.NextArg() {
+					return &ETCD{}, c.ArgErr()
+				}
+				v, err := strconv.Atoi(c.Val())
+				if err != nil {
+					return &ETCD{}, err
+				}
+				if v <= 0 {
+					return &ETCD{}, c.Errf("weighted_answers value must be positive: %d", v)
+				}
+				etc.weighted = v
+			case "regions":
+				// regions FILE
+				if !c.NextArg() {
+					return &ETCD{}, c.ArgErr()
+				}
+				db, err := loadRegions(c.Val())
+				if err != nil {
+					return &ETCD{}, c.Err(err.Error())
+				}
+				etc.regions = db
+			case "flatten":
+				etc.flatten = true
+			case "soa":
+				// soa MNAME RNAME REFRESH RETRY EXPIRE MINIMUM
+				args := c.RemainingArgs()
+				if len(args) != 6 {
+					return &ETCD{}, c.Errf("soa requires 6 arguments, mname, rname, refresh, retry, expire and minimum")
+				}
+				soa, minimum, err := parseSOA(args)
+				if err != nil {
+					return &ETCD{}, c.Err(err.Error())
+				}
+				etc.SOA, etc.MinimumTTL = soa, minimum
+			case "transfer":
+				// transfer to ADDRESS...
+				if !c.NextArg() || c.Val() != "to" {
+					return &ETCD{}, c.ArgErr()
+				}
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return &ETCD{}, c.ArgErr()
+				}
+				nets, err := parseTransferTo(args)
+				if err != nil {
+					return &ETCD{}, c.Err(err.Error())
+				}
+				etc.transferTo = append(etc.transferTo, nets...)
+			case "notify":
+				// notify ADDRESS...
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return &ETCD{}, c.ArgErr()
+				}
+				to, err := parseNotifyTo(args)
+				if err != nil {
+					return &ETCD{}, c.Err(err.Error())
+				}
+				etc.notifyTo = append(etc.notifyTo, to...)
+			case "tsig":
+				// tsig NAME ALGORITHM SECRET
+				args := c.RemainingArgs()
+				if len(args) != 3 {
+					return &ETCD{}, c.Errf("tsig requires 3 arguments, name, algorithm and secret")
+				}
+				name, key, err := parseTsigKey(args[0], args[1], args[2])
+				if err != nil {
+					return &ETCD{}, c.Err(err.Error())
+				}
+				if etc.tsigKeys == nil {
+					etc.tsigKeys = make(map[string]*tsigKey)
+				}
+				etc.tsigKeys[name] = key
+			case "dnssec":
+				// dnssec [KEYFILE...]
+				etc.dnssec.enabled = true
+				etc.dnssec.keyFiles = append(etc.dnssec.keyFiles, c.RemainingArgs()...)
+			case "dnssec_rollover":
+				// dnssec_rollover ZSK_LIFETIME [KSK_LIFETIME]
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return &ETCD{}, c.ArgErr()
+				}
+				zsk, ksk, err := parseRollover(args)
+				if err != nil {
+					return &ETCD{}, c.Err(err.Error())
+				}
+				rollover = true
+				etc.dnssec.zskLifetime, etc.dnssec.kskLifetime = zsk, ksk
 			default:
 				if c.Val() != "}" {
 					return &ETCD{}, c.Errf("unknown property '%s'", c.Val())
 				}
 			}
 		}
+		if etc.flatten && etc.Upstream == nil {
+			return &ETCD{}, c.Errf("flatten requires upstream")
+		}
+		if rollover && (!etc.dnssec.enabled || len(etc.dnssec.keyFiles) > 0) {
+			return &ETCD{}, c.Errf("dnssec_rollover requires dnssec without key files")
+		}
+		if etc.dnssec.enabled {
+			if !rollover {
+				etc.dnssec.zskLifetime = defaultZSKLifetime
+			}
+			etc.dnssec.keyrings = make(map[string]*keyring, len(etc.Zones))
+			for _, zone := range etc.Zones {
+				etc.dnssec.keyrings[zone] = &keyring{zone: zone, cache: make(map[string]*dns.RRSIG)}
+			}
+		}
+		etc.caches = make(map[string]*recordCache, len(etc.Zones))
+		for _, zone := range etc.Zones {
+			etc.caches[zone] = newRecordCache(cachePrefix(zone, etc.PathPrefix))
+		}
+		etc.health = newRecordCache(healthPrefix(etc.PathPrefix))
+		if len(etc.notifyTo) > 0 {
+			etc.notifies = make(map[string]chan struct{}, len(etc.Zones))
+			for _, zone := range etc.Zones {
+				etc.notifies[zone] = make(chan struct{}, 1)
+			}
+		}
+
 		client, err := newEtcdClient(endpoints, tlsConfig, username, password)
 		if err != nil {
 			return &ETCD{}, err
@@ -132,4 +277,108 @@ func newEtcdClient(endpoints []string, cc *tls.Config, username, password string
 	return cli, nil
 }
 
+// Used to parse the fields of the SOA record, the times are in seconds and the rname is a domain name,
+// e.g. hostmaster.lb.rancher.cloud. for hostmaster@lb.rancher.cloud
+func parseSOA(args []string) (rplugin.SOAFields, uint32, error) {
+	soa := rplugin.SOAFields{
+		Mname: dns.Fqdn(args[0]),
+		Rname: dns.Fqdn(args[1]),
+	}
+	for _, name := range []string{soa.Mname, soa.Rname} {
+		if _, ok := dns.IsDomainName(name); !ok {
+			return soa, 0, fmt.Errorf("invalid soa name: %s", name)
+		}
+	}
+
+	times := make([]uint32, 0, 4)
+	for _, arg := range args[2:] {
+		v, err := strconv.ParseUint(arg, 10, 32)
+		if err != nil || v == 0 {
+			return soa, 0, fmt.Errorf("invalid soa time: %s", arg)
+		}
+		times = append(times, uint32(v))
+	}
+	soa.Refresh, soa.Retry, soa.Expire = times[0], times[1], times[2]
+
+	if soa.Retry >= soa.Refresh {
+		return soa, 0, fmt.Errorf("soa retry %d must be less than refresh %d", soa.Retry, soa.Refresh)
+	}
+	if soa.Expire <= soa.Refresh+soa.Retry {
+		return soa, 0, fmt.Errorf("soa expire %d must be greater than refresh and retry", soa.Expire)
+	}
+
+	return soa, times[3], nil
+}
+
+// Used to parse the addresses or networks which are allowed to transfer the zones, * means any address
+func parseTransferTo(args []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(args))
+	for _, arg := range args {
+		if arg == "*" {
+			_, v4, _ := net.ParseCIDR("0.0.0.0/0")
+			_, v6, _ := net.ParseCIDR("::/0")
+			nets = append(nets, v4, v6)
+			continue
+		}
+
+		if !strings.Contains(arg, "/") {
+			ip := net.ParseIP(arg)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid transfer address: %s", arg)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transfer network: %s", arg)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Used to parse a tsig key, the algorithm is one of hmac-sha1, hmac-sha256 and hmac-sha512
+func parseTsigKey(name, algorithm, secret string) (string, *tsigKey, error) {
+	alg := dns.Fqdn(strings.ToLower(algorithm))
+	switch alg {
+	case dns.HmacSHA1, dns.HmacSHA256, dns.HmacSHA512:
+	default:
+		return "", nil, fmt.Errorf("unsupported tsig algorithm: %s", algorithm)
+	}
+
+	if _, err := base64.StdEncoding.DecodeString(secret); err != nil {
+		return "", nil, fmt.Errorf("tsig secret of %s is not base64 encoded", name)
+	}
+
+	return dns.Fqdn(strings.ToLower(name)), &tsigKey{algorithm: alg, secret: secret}, nil
+}
+
+// Used to parse the lifetimes of the zone signing keys and the key signing keys, e.g. 720h,
+// the key signing keys are not rolled when their lifetime is not set or is 0
+func parseRollover(args []string) (time.Duration, time.Duration, error) {
+	lifetimes := make([]time.Duration, 2)
+	for i, arg := range args {
+		v, err := time.ParseDuration(arg)
+		if err != nil || v < 0 {
+			return 0, 0, fmt.Errorf("invalid dnssec key lifetime: %s", arg)
+		}
+		lifetimes[i] = v
+	}
+
+	if lifetimes[0] < 2*zskPrePublish {
+		return 0, 0, fmt.Errorf("zone signing key lifetime %s must be at least %s", lifetimes[0], 2*zskPrePublish)
+	}
+	if lifetimes[1] != 0 && lifetimes[1] < 2*kskPrePublish {
+		return 0, 0, fmt.Errorf("key signing key lifetime %s must be at least %s", lifetimes[1], 2*kskPrePublish)
+	}
+
+	return lifetimes[0], lifetimes[1], nil
+}
+
 const defaultEndpoint = "http://localhost:2379"
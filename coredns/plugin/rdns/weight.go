@@ -0,0 +1,99 @@
+package rdns
+
+import (
+	"math/rand"
+	"net"
+	"path"
+
+	"github.com/rancher/rdns-server/coredns/plugin/rdns/msg"
+)
+
+// defaultWeightedAnswers is the number of hosts which are answered of a weighted domain when nothing is set.
+const defaultWeightedAnswers = 1
+
+// Used to answer a subset of the hosts of the weighted domains, a domain is weighted when one of its hosts has a
+// weight. The hosts of the lowest priority which has a weight are picked at random in proportion to their weights,
+// a domain keeps all of its hosts when every host is drained. The other services are kept as they are
+func (e *ETCD) pickWeighted(sx []msg.Service) []msg.Service {
+	dropped := make(map[int]bool)
+	for _, group := range groupHosts(sx) {
+		picked := pickHosts(sx, group, e.weighted)
+		if picked == nil {
+			continue
+		}
+		for _, i := range group {
+			if !picked[i] {
+				dropped[i] = true
+			}
+		}
+	}
+
+	return dropServices(sx, dropped)
+}
+
+// Used to pick up to n hosts of a domain without replacement, returns nil when the domain is not weighted
+func pickHosts(sx []msg.Service, group []int, n int) map[int]bool {
+	best := -1
+	for _, i := range group {
+		if sx[i].Weight > 0 && (best < 0 || sx[i].Priority < best) {
+			best = sx[i].Priority
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+
+	candidates := make([]int, 0, len(group))
+	total := 0
+	for _, i := range group {
+		if sx[i].Weight > 0 && sx[i].Priority == best {
+			candidates = append(candidates, i)
+			total += sx[i].Weight
+		}
+	}
+
+	picked := make(map[int]bool, n)
+	for len(picked) < n && len(candidates) > 0 {
+		r := rand.Intn(total)
+		for j, i := range candidates {
+			if r < sx[i].Weight {
+				picked[i] = true
+				total -= sx[i].Weight
+				candidates = append(candidates[:j], candidates[j+1:]...)
+				break
+			}
+			r -= sx[i].Weight
+		}
+	}
+
+	return picked
+}
+
+// Used to group the indexes of the hosts of the services by their domains, the services which are not hosts are
+// in no group
+func groupHosts(sx []msg.Service) map[string][]int {
+	groups := make(map[string][]int)
+	for i, serv := range sx {
+		if net.ParseIP(serv.Host) == nil {
+			continue
+		}
+		parent := path.Dir(serv.Key)
+		groups[parent] = append(groups[parent], i)
+	}
+	return groups
+}
+
+// Used to drop the services of the indexes
+func dropServices(sx []msg.Service, dropped map[int]bool) []msg.Service {
+	if len(dropped) == 0 {
+		return sx
+	}
+
+	result := make([]msg.Service, 0, len(sx)-len(dropped))
+	for i, serv := range sx {
+		if !dropped[i] {
+			result = append(result, serv)
+		}
+	}
+	return result
+}
@@ -2,24 +2,404 @@ package rdns
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
-	"github.com/coredns/coredns/request"
+	"github.com/rancher/rdns-server/coredns/plugin"
+	"github.com/rancher/rdns-server/coredns/plugin/rdns/msg"
 
+	"github.com/coredns/coredns/request"
+	etcdcv3 "github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
 	"github.com/miekg/dns"
 )
 
-// Serial implements the Transferer interface.
+const (
+	xfrBatchSize = 100 // records in each message of a transfer
+	tsigFudge    = 300 // allowed clock skew of a signed transfer in seconds
+)
+
+var (
+	errTsigRequired = errors.New("transfer requires a tsig signature")
+
+	// the key of an A record is named by its address, e.g. /rdnsv3/cloud/rancher/lb/sample/1_1_1_1
+	addressKeyPattern = regexp.MustCompile(`^\d{1,3}_\d{1,3}_\d{1,3}_\d{1,3}$`)
+)
+
+// tsigKey is a key which is allowed to sign the transfers.
+type tsigKey struct {
+	algorithm string
+	secret    string
+}
+
+// tsigRequest is the verified tsig of a transfer request, the responses are signed with the same key.
+type tsigRequest struct {
+	name string
+	key  *tsigKey
+	mac  string
+}
+
+// Serial implements the Transferer interface. The serial is the lower 32 bits of the etcd revision of the last
+// change of the zone, so that it only moves when the records change and an IXFR can find the records of the serial
+// a secondary has.
 func (e *ETCD) Serial(state request.Request) uint32 {
-	return uint32(time.Now().Unix())
+	zone := plugin.Zones(e.Zones).Matches(state.Name())
+	if rev := e.zoneRevision(zone); rev > 0 {
+		return uint32(rev)
+	}
+
+	// the revision is not watched yet, the current one is not older than the last change
+	rev, err := e.currentRevision(context.Background())
+	if err != nil {
+		log.Warningf("Failed to get the etcd revision: %v", err)
+	}
+	return uint32(rev)
 }
 
 // MinTTL implements the Transferer interface.
 func (e *ETCD) MinTTL(state request.Request) uint32 {
-	return 30
+	if e.MinimumTTL > 0 {
+		return e.MinimumTTL
+	}
+	return minTTL
+}
+
+// SOAFields implements the Transferer interface.
+func (e *ETCD) SOAFields(state request.Request) plugin.SOAFields {
+	return e.SOA
 }
 
-// Transfer implements the Transferer interface.
+// Transfer implements the Transferer interface. AXFR sends every record of the zone, IXFR sends the records
+// which are changed since the revision of the serial the secondary has, or falls back to AXFR when that revision
+// is compacted. Transfers are only allowed for the networks of the transfer property, and need to be signed by
+// one of the tsig keys when there are any.
 func (e *ETCD) Transfer(ctx context.Context, state request.Request) (int, error) {
-	return dns.RcodeServerFailure, nil
+	zone := plugin.Zones(e.Zones).Matches(state.Name())
+	if zone == "" || zone != state.Name() {
+		return dns.RcodeNotAuth, nil
+	}
+
+	if !e.transferAllowed(state) {
+		log.Warningf("Refused %s of %s from %s", dns.TypeToString[state.QType()], zone, state.IP())
+		return dns.RcodeRefused, nil
+	}
+
+	t, err := e.verifyTsig(state.Req)
+	if err != nil {
+		log.Warningf("Refused %s of %s from %s: %v", dns.TypeToString[state.QType()], zone, state.IP(), err)
+		return dns.RcodeNotAuth, nil
+	}
+
+	if state.QType() == dns.TypeAXFR && state.Proto() != "tcp" {
+		return dns.RcodeRefused, nil
+	}
+
+	// the records are read at the revision of the serial, or at the current one when it is not watched yet.
+	// The revision is compacted when the zone has not changed for a while, the current records are the same then
+	serialRev := e.zoneRevision(zone)
+	records, rev, err := e.zoneRecords(ctx, zone, serialRev)
+	if err != nil && serialRev > 0 {
+		records, _, err = e.zoneRecords(ctx, zone, 0)
+		rev = serialRev
+	}
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+
+	soas, err := plugin.SOA(ctx, e, zone, state, plugin.Options{})
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	soa := soas[0].(*dns.SOA)
+	soa.Serial = uint32(rev)
+
+	var rrs []dns.RR
+	if state.QType() == dns.TypeIXFR {
+		rrs = e.incrementalRecords(ctx, state, zone, soa, rev, records)
+	}
+	if rrs == nil {
+		rrs = append(append([]dns.RR{soa}, records...), soa)
+	}
+
+	if err := writeTransfer(state, rrs, t); err != nil {
+		return dns.RcodeServerFailure, err
+	}
+
+	log.Infof("Sent %s of %s with serial %d to %s, %d records", dns.TypeToString[state.QType()], zone, soa.Serial, state.IP(), len(rrs))
+	return dns.RcodeSuccess, nil
+}
+
+// Used to get the records of an IXFR, returns nil when the transfer falls back to AXFR:
+//   the request is not over tcp, only the SOA is sent so that the secondary retries over tcp (RFC 1995 section 2)
+//   the secondary is up to date, only the SOA is sent
+//   otherwise the deleted and the added records are sent between the SOA of both serials
+func (e *ETCD) incrementalRecords(ctx context.Context, state request.Request, zone string, soa *dns.SOA, rev int64, records []dns.RR) []dns.RR {
+	// a transfer which does not fit in one message can not be sent over udp
+	if state.Proto() != "tcp" {
+		return []dns.RR{soa}
+	}
+
+	var serial uint32
+	found := false
+	for _, rr := range state.Req.Ns {
+		if s, ok := rr.(*dns.SOA); ok {
+			serial, found = s.Serial, true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	if serial == soa.Serial {
+		return []dns.RR{soa}
+	}
+
+	prevRev := revisionOf(serial, rev)
+	if prevRev <= 0 || prevRev >= rev {
+		return nil
+	}
+
+	prev, _, err := e.zoneRecords(ctx, zone, prevRev)
+	if err != nil {
+		log.Debugf("Fall back to AXFR of %s from revision %d: %v", zone, prevRev, err)
+		return nil
+	}
+
+	prevSOA := dns.Copy(soa).(*dns.SOA)
+	prevSOA.Serial = serial
+
+	deleted, added := diffRecords(prev, records)
+
+	rrs := make([]dns.RR, 0, len(deleted)+len(added)+4)
+	rrs = append(rrs, soa, prevSOA)
+	rrs = append(rrs, deleted...)
+	rrs = append(rrs, soa)
+	rrs = append(rrs, added...)
+	return append(rrs, soa)
+}
+
+// Used to read every record of a zone at a revision, or at the current revision when rev is 0
+func (e *ETCD) zoneRecords(ctx context.Context, zone string, rev int64) ([]dns.RR, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, etcdTimeout)
+	defer cancel()
+
+	opts := []etcdcv3.OpOption{etcdcv3.WithPrefix()}
+	if rev > 0 {
+		opts = append(opts, etcdcv3.WithRev(rev))
+	}
+
+	r, err := e.Client.Get(ctx, msg.Path(zone, e.PathPrefix)+"/", opts...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	records := make([]dns.RR, 0, len(r.Kvs))
+	for _, kv := range r.Kvs {
+		rrs, err := e.keyRecords(kv, zone)
+		if err != nil {
+			log.Warningf("Skip %s in the transfer of %s: %v", kv.Key, zone, err)
+			continue
+		}
+		records = append(records, rrs...)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].String() < records[j].String()
+	})
+
+	if rev == 0 {
+		rev = r.Header.Revision
+	}
+	return records, rev, nil
+}
+
+// Used to convert a key of a zone to its records, the same way the answers are built:
+//   the key of an A record which is named by its address belongs to the parent name
+//   a name with as many labels as the wildcardbound also answers for the names under it
+//   an address under ns.dns.<zone> is a name server of the zone
+//   a key without host and text only holds a domain which has no hosts
+func (e *ETCD) keyRecords(kv *mvccpb.KeyValue, zone string) ([]dns.RR, error) {
+	serv := new(msg.Service)
+	if err := json.Unmarshal(kv.Value, serv); err != nil {
+		return nil, err
+	}
+	serv.Key = string(kv.Key)
+	serv.TTL = e.TTL(kv, serv)
+
+	owner := msg.Domain(serv.Key)
+
+	if serv.Text != "" {
+		return []dns.RR{serv.NewTXT(owner)}, nil
+	}
+	if serv.Host == "" {
+		return nil, nil
+	}
+
+	what, ip := serv.HostType()
+	if what == dns.TypeCNAME {
+		return []dns.RR{serv.NewCNAME(owner, serv.Host)}, nil
+	}
+
+	segments := strings.Split(serv.Key, "/")
+	if addressKeyPattern.MatchString(segments[len(segments)-1]) {
+		owner = msg.Domain(strings.Join(segments[:len(segments)-1], "/"))
+	}
+
+	address := func(name string) dns.RR {
+		if what == dns.TypeA {
+			return serv.NewA(name, ip)
+		}
+		return serv.NewAAAA(name, ip)
+	}
+
+	rrs := []dns.RR{address(owner)}
+	if e.WildcardBound > 0 && dns.CountLabel(owner) == int(e.WildcardBound) {
+		rrs = append(rrs, address("*."+owner))
+	}
+
+	ns := "ns.dns." + zone
+	if owner != ns && dns.IsSubDomain(ns, owner) {
+		s := *serv
+		s.Host = owner
+		rrs = append(rrs, s.NewNS(zone))
+	}
+
+	return rrs, nil
+}
+
+// Used to check whether the source address of a transfer is in the networks of the transfer property
+func (e *ETCD) transferAllowed(state request.Request) bool {
+	ip := net.ParseIP(state.IP())
+	if ip == nil {
+		return false
+	}
+	for _, n := range e.transferTo {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Used to verify the tsig of a transfer request, returns nil when there are no tsig keys.
+// The dns server of coredns has no tsig secrets, so the request is packed again to be verified
+func (e *ETCD) verifyTsig(r *dns.Msg) (*tsigRequest, error) {
+	if len(e.tsigKeys) == 0 {
+		return nil, nil
+	}
+
+	t := r.IsTsig()
+	if t == nil {
+		return nil, errTsigRequired
+	}
+
+	name := strings.ToLower(t.Hdr.Name)
+	key, ok := e.tsigKeys[name]
+	if !ok {
+		return nil, dns.ErrSecret
+	}
+	if !strings.EqualFold(t.Algorithm, key.algorithm) {
+		return nil, dns.ErrKeyAlg
+	}
+
+	// the request may be packed with or without compression
+	for _, compress := range []bool{false, true} {
+		m := r.Copy()
+		m.Compress = compress
+
+		buf, err := m.Pack()
+		if err != nil {
+			return nil, err
+		}
+
+		err = dns.TsigVerify(buf, key.secret, "", false)
+		if err == nil {
+			return &tsigRequest{name: name, key: key, mac: t.MAC}, nil
+		}
+		if err == dns.ErrTime {
+			return nil, err
+		}
+	}
+
+	return nil, dns.ErrSig
+}
+
+// Used to write the records of a transfer in batches, each message is signed when the request is signed
+func writeTransfer(state request.Request, rrs []dns.RR, t *tsigRequest) error {
+	mac := ""
+	if t != nil {
+		mac = t.mac
+	}
+
+	for i := 0; i < len(rrs); i += xfrBatchSize {
+		end := i + xfrBatchSize
+		if end > len(rrs) {
+			end = len(rrs)
+		}
+
+		m := new(dns.Msg)
+		m.SetReply(state.Req)
+		m.Authoritative = true
+		m.Answer = rrs[i:end]
+
+		if t == nil {
+			if err := state.W.WriteMsg(m); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// the messages after the first one only sign the timers, as the previous mac is a part of the digest
+		m.SetTsig(t.name, t.key.algorithm, tsigFudge, time.Now().Unix())
+		buf, next, err := dns.TsigGenerate(m, t.key.secret, mac, i > 0)
+		if err != nil {
+			return err
+		}
+		if _, err := state.W.Write(buf); err != nil {
+			return err
+		}
+		mac = next
+	}
+
+	return nil
+}
+
+// Used to get the records which are deleted and added between two sorted lists of records
+func diffRecords(prev, curr []dns.RR) (deleted, added []dns.RR) {
+	index := func(rrs []dns.RR) map[string]bool {
+		m := make(map[string]bool, len(rrs))
+		for _, rr := range rrs {
+			m[rr.String()] = true
+		}
+		return m
+	}
+
+	p, c := index(prev), index(curr)
+	for _, rr := range prev {
+		if !c[rr.String()] {
+			deleted = append(deleted, rr)
+		}
+	}
+	for _, rr := range curr {
+		if !p[rr.String()] {
+			added = append(added, rr)
+		}
+	}
+	return deleted, added
+}
+
+// Used to get the etcd revision of a serial, which is the newest revision not after the current one
+// whose lower 32 bits are the serial
+func revisionOf(serial uint32, current int64) int64 {
+	rev := current&^0xffffffff | int64(serial)
+	if rev > current {
+		rev -= 1 << 32
+	}
+	return rev
 }
@@ -0,0 +1,106 @@
+package rdns
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+func TestRevisionOf(t *testing.T) {
+	tests := []struct {
+		name    string
+		serial  uint32
+		current int64
+		want    int64
+	}{
+		{"current revision", 100, 100, 100},
+		{"older revision", 90, 100, 90},
+		{"serial after the current revision", 110, 100, 110 - 1<<32},
+		{"wrapped serial", 0xfffffff0, 1<<32 + 5, 0xfffffff0},
+		{"revision after the wrap", 3, 1<<32 + 5, 1<<32 + 3},
+		{"high revision", 7, 3<<32 + 9, 3<<32 + 7},
+	}
+
+	for _, tt := range tests {
+		if got := revisionOf(tt.serial, tt.current); got != tt.want {
+			t.Errorf("%s: revisionOf(%d, %d) = %d, want %d", tt.name, tt.serial, tt.current, got, tt.want)
+		}
+	}
+}
+
+func TestDiffRecords(t *testing.T) {
+	rr := func(s string) dns.RR {
+		r, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	a1 := rr("a.lb.rancher.cloud. 60 IN A 1.1.1.1")
+	a2 := rr("a.lb.rancher.cloud. 60 IN A 2.2.2.2")
+	b1 := rr("b.lb.rancher.cloud. 60 IN A 1.1.1.1")
+	a1TTL := rr("a.lb.rancher.cloud. 120 IN A 1.1.1.1")
+
+	tests := []struct {
+		name    string
+		prev    []dns.RR
+		curr    []dns.RR
+		deleted []dns.RR
+		added   []dns.RR
+	}{
+		{"same", []dns.RR{a1, a2}, []dns.RR{a1, a2}, nil, nil},
+		{"added", []dns.RR{a1}, []dns.RR{a1, a2}, nil, []dns.RR{a2}},
+		{"deleted", []dns.RR{a1, a2, b1}, []dns.RR{a2}, []dns.RR{a1, b1}, nil},
+		{"replaced", []dns.RR{a1}, []dns.RR{b1}, []dns.RR{a1}, []dns.RR{b1}},
+		{"ttl changed", []dns.RR{a1}, []dns.RR{a1TTL}, []dns.RR{a1}, []dns.RR{a1TTL}},
+		{"from empty", nil, []dns.RR{a1}, nil, []dns.RR{a1}},
+		{"to empty", []dns.RR{a1}, nil, []dns.RR{a1}, nil},
+	}
+
+	for _, tt := range tests {
+		deleted, added := diffRecords(tt.prev, tt.curr)
+		if !sameRecords(deleted, tt.deleted) || !sameRecords(added, tt.added) {
+			t.Errorf("%s: diffRecords = %v, %v, want %v, %v", tt.name, deleted, added, tt.deleted, tt.added)
+		}
+	}
+}
+
+func sameRecords(a, b []dns.RR) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].String() != b[i].String() {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIncrementalRecordsOverUDP(t *testing.T) {
+	soa := test.SOA("example.org. 60 IN SOA ns.example.org. admin.example.org. 20 7200 1800 86400 30")
+	a1 := test.A("a.example.org. 60 IN A 1.1.1.1")
+
+	tests := []struct {
+		name string
+		ns   []dns.RR
+	}{
+		{"without soa", nil},
+		{"older serial", []dns.RR{test.SOA("example.org. 60 IN SOA ns.example.org. admin.example.org. 10 7200 1800 86400 30")}},
+	}
+
+	for _, tt := range tests {
+		m := new(dns.Msg)
+		m.SetIxfr("example.org.", 0, "", "")
+		m.Ns = tt.ns
+
+		state := request.Request{W: &test.ResponseWriter{}, Req: m}
+		rrs := (&ETCD{}).incrementalRecords(context.TODO(), state, "example.org.", soa, 20, []dns.RR{a1})
+		if !sameRecords(rrs, []dns.RR{soa}) {
+			t.Errorf("%s: incrementalRecords = %v, want only the soa", tt.name, rrs)
+		}
+	}
+}
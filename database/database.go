@@ -13,17 +13,24 @@ var currentDatabase Database
 type Database interface {
 	InsertFrozen(prefix string) error
 	QueryFrozen(prefix string) (string, error)
+	QueryFrozenPrefix(prefix string) (*model.FrozenPrefix, error)
+	ListFrozen(prefix string) ([]*model.FrozenPrefix, error)
+	InsertFrozenOn(prefix string, createdOn int64) error
+	UpdateFrozen(prefix string, createdOn int64) error
 	RenewFrozen(prefix string) error
 	DeleteFrozen(prefix string) error
 	DeleteExpiredFrozen(*time.Time) error
 	MigrateFrozen(prefix string, expiration int64) error
-	InsertToken(token, name string) (int64, error)
+	InsertToken(token, name string, lease time.Duration) (int64, error)
 	QueryTokenCount() (int64, error)
 	QueryToken(name string) (*model.Token, error)
-	QueryExpiredTokens(*time.Time) ([]*model.Token, error)
+	QueryExpiredTokens(t *time.Time, lease time.Duration, after int64, limit int) ([]*model.Token, error)
 	RenewToken(name string) (int64, int64, error)
+	SuspendToken(name string) error
+	SignToken(name string, signed bool) error
 	DeleteToken(prefix string) error
 	MigrateToken(token, name string, expiration int64) error
+	ImportToken(t *model.Token) (int64, error)
 	InsertA(*model.RecordA) (int64, error)
 	UpdateA(*model.RecordA) (int64, error)
 	QueryA(name string) (*model.RecordA, error)
@@ -42,6 +49,17 @@ type Database interface {
 	QueryTXT(name string) (*model.RecordTXT, error)
 	QueryExpiredTXTs(id int64) ([]*model.RecordTXT, error)
 	DeleteTXT(name string) error
+	ListAllTokens() ([]*model.Token, error)
+	ListAllA() ([]*model.RecordA, error)
+	ListAllSubA() ([]*model.SubRecordA, error)
+	ListAllTXT() ([]*model.RecordTXT, error)
+	ListAllCNAME() ([]*model.RecordCNAME, error)
+	InsertDomainOption(*model.RecordDomainOption) (int64, error)
+	UpdateDomainOption(*model.RecordDomainOption) (int64, error)
+	QueryDomainOption(name, kind string) (*model.RecordDomainOption, error)
+	DeleteDomainOption(name, kind string) error
+	DeleteDomainOptions(name string) error
+	ListAllDomainOptions(kind string) ([]*model.RecordDomainOption, error)
 	Close() error
 }
 
@@ -0,0 +1,7 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE token ADD COLUMN suspended_on BIGINT;
+
+-- +migrate Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+ALTER TABLE token DROP COLUMN suspended_on;
@@ -0,0 +1,18 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE IF NOT EXISTS domain_option (
+    id INT AUTO_INCREMENT,
+    fqdn VARCHAR(255) NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    content TEXT NOT NULL,
+    created_on BIGINT NOT NULL,
+    updated_on BIGINT,
+    tid INT NOT NULL,
+    CONSTRAINT fk_token_option FOREIGN KEY(tid) REFERENCES token(id) ON DELETE CASCADE,
+    UNIQUE KEY uk_fqdn_kind (fqdn, kind),
+    PRIMARY KEY (id)
+) ENGINE=INNODB DEFAULT CHARSET=utf8;
+
+-- +migrate Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+DROP TABLE IF EXISTS domain_option;
@@ -0,0 +1,10 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE token ADD COLUMN expires_on BIGINT;
+UPDATE token SET expires_on = created_on + lease_time WHERE lease_time IS NOT NULL;
+CREATE INDEX index_expires_on_token ON token (expires_on);
+
+-- +migrate Down
+-- SQL in section 'Down' is executed when this migration is rolled back
+DROP INDEX index_expires_on_token ON token;
+ALTER TABLE token DROP COLUMN expires_on;
@@ -2,6 +2,7 @@ package mysql
 
 import (
 	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/rancher/rdns-server/model"
@@ -63,6 +64,69 @@ func (d *Database) QueryFrozen(prefix string) (string, error) {
 	return result, nil
 }
 
+func (d *Database) QueryFrozenPrefix(prefix string) (*model.FrozenPrefix, error) {
+	st, err := d.Db.Prepare("SELECT id, prefix, created_on FROM frozen_prefix WHERE prefix = ?")
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+
+	f := &model.FrozenPrefix{}
+	if err := st.QueryRow(prefix).Scan(&f.ID, &f.Prefix, &f.CreatedOn); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// ListFrozen returns the frozen prefixes which start with the prefix, all of them when it is empty.
+func (d *Database) ListFrozen(prefix string) ([]*model.FrozenPrefix, error) {
+	st, err := d.Db.Prepare("SELECT id, prefix, created_on FROM frozen_prefix WHERE prefix LIKE ? ORDER BY prefix")
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+
+	rows, err := st.Query(escapeLike(prefix) + "%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*model.FrozenPrefix, 0)
+	for rows.Next() {
+		f := &model.FrozenPrefix{}
+		if err := rows.Scan(&f.ID, &f.Prefix, &f.CreatedOn); err != nil {
+			return nil, err
+		}
+		result = append(result, f)
+	}
+
+	return result, rows.Err()
+}
+
+func (d *Database) InsertFrozenOn(prefix string, createdOn int64) error {
+	st, err := d.Db.Prepare("INSERT INTO frozen_prefix (prefix, created_on) VALUES ( ?, ? )")
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	_, err = st.Exec(prefix, createdOn)
+	return err
+}
+
+func (d *Database) UpdateFrozen(prefix string, createdOn int64) error {
+	st, err := d.Db.Prepare("UPDATE frozen_prefix SET created_on = ? WHERE prefix = ?")
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	_, err = st.Exec(createdOn, prefix)
+	return err
+}
+
 func (d *Database) RenewFrozen(prefix string) error {
 	st, err := d.Db.Prepare("UPDATE frozen_prefix SET created_on = ? WHERE prefix = ?")
 	if err != nil {
@@ -107,14 +171,17 @@ func (d *Database) MigrateFrozen(prefix string, expiration int64) error {
 	return err
 }
 
-func (d *Database) InsertToken(token, name string) (int64, error) {
-	st, err := d.Db.Prepare("INSERT INTO token (token, fqdn, created_on) VALUES( ?, ?, ? )")
+// InsertToken inserts a token, a zero lease means the token uses the default lease time.
+func (d *Database) InsertToken(token, name string, lease time.Duration) (int64, error) {
+	st, err := d.Db.Prepare("INSERT INTO token (token, fqdn, created_on, lease_time, expires_on) VALUES( ?, ?, ?, ?, ? )")
 	if err != nil {
 		return 0, err
 	}
 	defer st.Close()
 
-	resp, err := st.Exec(token, name, time.Now().UnixNano())
+	t := time.Now().UnixNano()
+	l := sql.NullInt64{Int64: lease.Nanoseconds(), Valid: lease > 0}
+	resp, err := st.Exec(token, name, t, l, expiresOn(t, l))
 	if err != nil {
 		return 0, err
 	}
@@ -139,35 +206,39 @@ func (d *Database) QueryTokenCount() (int64, error) {
 
 func (d *Database) QueryToken(name string) (*model.Token, error) {
 	r := &model.Token{}
-	st, err := d.Db.Prepare("SELECT * FROM token WHERE fqdn = ?")
+	st, err := d.Db.Prepare("SELECT id, token, fqdn, created_on, suspended_on, lease_time, signed_only FROM token WHERE fqdn = ?")
 	if err != nil {
 		return r, err
 	}
 	defer st.Close()
 
-	if err := st.QueryRow(name).Scan(&r.ID, &r.Token, &r.Fqdn, &r.CreatedOn); err != nil {
+	if err := st.QueryRow(name).Scan(&r.ID, &r.Token, &r.Fqdn, &r.CreatedOn, &r.SuspendedOn, &r.LeaseTime, &r.SignedOnly); err != nil {
 		return r, err
 	}
 
 	return r, nil
 }
 
-func (d *Database) QueryExpiredTokens(t *time.Time) ([]*model.Token, error) {
+// QueryExpiredTokens returns at most limit tokens which are expired at t and whose id is greater than after,
+// the tokens without their own lease time expire after the default lease.
+// Both conditions compare an indexed column with a constant, so they can use the created_on and expires_on indexes.
+func (d *Database) QueryExpiredTokens(t *time.Time, lease time.Duration, after int64, limit int) ([]*model.Token, error) {
 	result := make([]*model.Token, 0)
-	st, err := d.Db.Prepare("SELECT * FROM token WHERE created_on <= ?")
+	st, err := d.Db.Prepare("SELECT id, token, fqdn, created_on, suspended_on, lease_time, signed_only FROM token WHERE ((lease_time IS NULL AND created_on <= ?) OR expires_on <= ?) AND id > ? ORDER BY id LIMIT ?")
 	if err != nil {
 		return result, err
 	}
 	defer st.Close()
 
-	rows, err := st.Query(t.UnixNano())
+	rows, err := st.Query(t.UnixNano()-lease.Nanoseconds(), t.UnixNano(), after, limit)
 	if err != nil {
 		return result, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		temp := &model.Token{}
-		if err := rows.Scan(&temp.ID, &temp.Token, &temp.Fqdn, &temp.CreatedOn); err != nil {
+		if err := rows.Scan(&temp.ID, &temp.Token, &temp.Fqdn, &temp.CreatedOn, &temp.SuspendedOn, &temp.LeaseTime, &temp.SignedOnly); err != nil {
 			return result, err
 		}
 		result = append(result, temp)
@@ -177,14 +248,14 @@ func (d *Database) QueryExpiredTokens(t *time.Time) ([]*model.Token, error) {
 }
 
 func (d *Database) RenewToken(name string) (int64, int64, error) {
-	st, err := d.Db.Prepare("UPDATE token SET created_on = ? WHERE fqdn = ?")
+	st, err := d.Db.Prepare("UPDATE token SET created_on = ?, expires_on = ? + lease_time, suspended_on = NULL WHERE fqdn = ?")
 	if err != nil {
 		return 0, 0, err
 	}
 	defer st.Close()
 
 	t := time.Now().UnixNano()
-	resp, err := st.Exec(t, name)
+	resp, err := st.Exec(t, t, name)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -197,6 +268,17 @@ func (d *Database) RenewToken(name string) (int64, int64, error) {
 	return id, t, nil
 }
 
+func (d *Database) SuspendToken(name string) error {
+	st, err := d.Db.Prepare("UPDATE token SET suspended_on = ? WHERE fqdn = ?")
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	_, err = st.Exec(time.Now().UnixNano(), name)
+	return err
+}
+
 func (d *Database) DeleteToken(token string) error {
 	st, err := d.Db.Prepare("DELETE FROM token WHERE token = ?")
 	if err != nil {
@@ -208,6 +290,18 @@ func (d *Database) DeleteToken(token string) error {
 	return err
 }
 
+// SignToken sets whether the domain of a token only accepts signed requests.
+func (d *Database) SignToken(name string, signed bool) error {
+	st, err := d.Db.Prepare("UPDATE token SET signed_only = ? WHERE fqdn = ?")
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	_, err = st.Exec(signed, name)
+	return err
+}
+
 func (d *Database) MigrateToken(token, name string, expiration int64) error {
 	st, err := d.Db.Prepare("INSERT INTO token (token, fqdn, created_on) VALUES( ?, ?, ? )")
 	if err != nil {
@@ -223,6 +317,40 @@ func (d *Database) MigrateToken(token, name string, expiration int64) error {
 	return nil
 }
 
+// ImportToken inserts a token or updates the token of the same fqdn, the token is not suspended after it is imported.
+func (d *Database) ImportToken(t *model.Token) (int64, error) {
+	r, err := d.QueryToken(t.Fqdn)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	if err == nil {
+		st, err := d.Db.Prepare("UPDATE token SET token = ?, created_on = ?, suspended_on = NULL, lease_time = ?, expires_on = ?, signed_only = ? WHERE id = ?")
+		if err != nil {
+			return 0, err
+		}
+		defer st.Close()
+
+		if _, err := st.Exec(t.Token, t.CreatedOn, t.LeaseTime, expiresOn(t.CreatedOn, t.LeaseTime), t.SignedOnly, r.ID); err != nil {
+			return 0, err
+		}
+		return r.ID, nil
+	}
+
+	st, err := d.Db.Prepare("INSERT INTO token (token, fqdn, created_on, lease_time, expires_on, signed_only) VALUES( ?, ?, ?, ?, ?, ? )")
+	if err != nil {
+		return 0, err
+	}
+	defer st.Close()
+
+	resp, err := st.Exec(t.Token, t.Fqdn, t.CreatedOn, t.LeaseTime, expiresOn(t.CreatedOn, t.LeaseTime), t.SignedOnly)
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.LastInsertId()
+}
+
 func (d *Database) InsertA(a *model.RecordA) (int64, error) {
 	st, err := d.Db.Prepare("INSERT INTO record_a (fqdn, type, content, created_on, tid) VALUES (?, ?, ?, ?, ?)")
 	if err != nil {
@@ -519,3 +647,242 @@ func (d *Database) QueryExpiredTXTs(id int64) ([]*model.RecordTXT, error) {
 func (d *Database) Close() error {
 	return d.Db.Close()
 }
+
+func (d *Database) ListAllTokens() ([]*model.Token, error) {
+	rs := make([]*model.Token, 0)
+
+	st, err := d.Db.Prepare("SELECT id, token, fqdn, created_on, suspended_on, lease_time, signed_only FROM token")
+	if err != nil {
+		return rs, err
+	}
+	defer st.Close()
+
+	rows, err := st.Query()
+	if err != nil {
+		return rs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := &model.Token{}
+		if err := rows.Scan(&r.ID, &r.Token, &r.Fqdn, &r.CreatedOn, &r.SuspendedOn, &r.LeaseTime, &r.SignedOnly); err != nil {
+			return rs, err
+		}
+		rs = append(rs, r)
+	}
+
+	return rs, rows.Err()
+}
+
+func (d *Database) ListAllA() ([]*model.RecordA, error) {
+	rs := make([]*model.RecordA, 0)
+
+	st, err := d.Db.Prepare("SELECT * FROM record_a")
+	if err != nil {
+		return rs, err
+	}
+	defer st.Close()
+
+	rows, err := st.Query()
+	if err != nil {
+		return rs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := &model.RecordA{}
+		if err := rows.Scan(&r.ID, &r.Fqdn, &r.Type, &r.Content, &r.CreatedOn, &r.UpdatedOn, &r.TID); err != nil {
+			return rs, err
+		}
+		rs = append(rs, r)
+	}
+
+	return rs, rows.Err()
+}
+
+func (d *Database) ListAllSubA() ([]*model.SubRecordA, error) {
+	rs := make([]*model.SubRecordA, 0)
+
+	st, err := d.Db.Prepare("SELECT * FROM sub_record_a")
+	if err != nil {
+		return rs, err
+	}
+	defer st.Close()
+
+	rows, err := st.Query()
+	if err != nil {
+		return rs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := &model.SubRecordA{}
+		if err := rows.Scan(&r.ID, &r.Fqdn, &r.Type, &r.Content, &r.CreatedOn, &r.UpdatedOn, &r.PID); err != nil {
+			return rs, err
+		}
+		rs = append(rs, r)
+	}
+
+	return rs, rows.Err()
+}
+
+func (d *Database) ListAllTXT() ([]*model.RecordTXT, error) {
+	rs := make([]*model.RecordTXT, 0)
+
+	st, err := d.Db.Prepare("SELECT * FROM record_txt")
+	if err != nil {
+		return rs, err
+	}
+	defer st.Close()
+
+	rows, err := st.Query()
+	if err != nil {
+		return rs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := &model.RecordTXT{}
+		if err := rows.Scan(&r.ID, &r.Fqdn, &r.Type, &r.Content, &r.CreatedOn, &r.UpdatedOn, &r.TID); err != nil {
+			return rs, err
+		}
+		rs = append(rs, r)
+	}
+
+	return rs, rows.Err()
+}
+
+func (d *Database) ListAllCNAME() ([]*model.RecordCNAME, error) {
+	rs := make([]*model.RecordCNAME, 0)
+
+	st, err := d.Db.Prepare("SELECT * FROM record_cname")
+	if err != nil {
+		return rs, err
+	}
+	defer st.Close()
+
+	rows, err := st.Query()
+	if err != nil {
+		return rs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := &model.RecordCNAME{}
+		if err := rows.Scan(&r.ID, &r.Fqdn, &r.Type, &r.Content, &r.CreatedOn, &r.UpdatedOn, &r.TID); err != nil {
+			return rs, err
+		}
+		rs = append(rs, r)
+	}
+
+	return rs, rows.Err()
+}
+
+func (d *Database) InsertDomainOption(o *model.RecordDomainOption) (int64, error) {
+	st, err := d.Db.Prepare("INSERT INTO domain_option (fqdn, kind, content, created_on, tid) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return 0, err
+	}
+	defer st.Close()
+
+	r, err := st.Exec(o.Fqdn, o.Kind, o.Content, o.CreatedOn, o.TID)
+	if err != nil {
+		return 0, err
+	}
+	return r.LastInsertId()
+}
+
+func (d *Database) UpdateDomainOption(o *model.RecordDomainOption) (int64, error) {
+	st, err := d.Db.Prepare("UPDATE domain_option SET content = ?, updated_on = ? WHERE fqdn = ? AND kind = ?")
+	if err != nil {
+		return 0, err
+	}
+	defer st.Close()
+
+	r, err := st.Exec(o.Content, time.Now().Unix(), o.Fqdn, o.Kind)
+	if err != nil {
+		return 0, err
+	}
+	return r.RowsAffected()
+}
+
+func (d *Database) QueryDomainOption(name, kind string) (*model.RecordDomainOption, error) {
+	r := &model.RecordDomainOption{}
+	st, err := d.Db.Prepare("SELECT * FROM domain_option WHERE fqdn = ? AND kind = ?")
+	if err != nil {
+		return r, err
+	}
+	defer st.Close()
+
+	rows, err := st.Query(name, kind)
+	if err != nil {
+		return r, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := rows.Scan(&r.ID, &r.Fqdn, &r.Kind, &r.Content, &r.CreatedOn, &r.UpdatedOn, &r.TID); err != nil {
+			return r, err
+		}
+	}
+
+	return r, rows.Err()
+}
+
+func (d *Database) DeleteDomainOption(name, kind string) error {
+	st, err := d.Db.Prepare("DELETE FROM domain_option WHERE fqdn = ? AND kind = ?")
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	_, err = st.Exec(name, kind)
+	return err
+}
+
+func (d *Database) DeleteDomainOptions(name string) error {
+	st, err := d.Db.Prepare("DELETE FROM domain_option WHERE fqdn = ?")
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	_, err = st.Exec(name)
+	return err
+}
+
+func (d *Database) ListAllDomainOptions(kind string) ([]*model.RecordDomainOption, error) {
+	rs := make([]*model.RecordDomainOption, 0)
+
+	st, err := d.Db.Prepare("SELECT * FROM domain_option WHERE kind = ?")
+	if err != nil {
+		return rs, err
+	}
+	defer st.Close()
+
+	rows, err := st.Query(kind)
+	if err != nil {
+		return rs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := &model.RecordDomainOption{}
+		if err := rows.Scan(&r.ID, &r.Fqdn, &r.Kind, &r.Content, &r.CreatedOn, &r.UpdatedOn, &r.TID); err != nil {
+			return rs, err
+		}
+		rs = append(rs, r)
+	}
+
+	return rs, rows.Err()
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
+
+// expiresOn returns when a token with its own lease time expires, the tokens without one expire after the default lease.
+func expiresOn(createdOn int64, lease sql.NullInt64) sql.NullInt64 {
+	return sql.NullInt64{Int64: createdOn + lease.Int64, Valid: lease.Valid}
+}
@@ -0,0 +1,9 @@
+package health
+
+const (
+	errInvalidEnv   = "invalid environment %s: %s"
+	errListHealth   = "failed to list the health checks"
+	errSetHealth    = "failed to set the health of %s"
+	errUnhealthyURL = "unhealthy status %d of %s"
+	errRefusedHost  = "refused to probe host %s"
+)
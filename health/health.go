@@ -0,0 +1,300 @@
+package health
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rancher/rdns-server/backend"
+	"github.com/rancher/rdns-server/leader"
+	"github.com/rancher/rdns-server/model"
+	"github.com/rancher/rdns-server/policy"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	flagInterval = "HEALTH_CHECK_INTERVAL"
+	flagWorkers  = "HEALTH_CHECK_WORKERS"
+	flagInternal = "HEALTH_CHECK_INTERNAL"
+
+	defaultWorkers = 20
+)
+
+type checker struct {
+	workers int
+	// internal is whether the loopback, private and link-local hosts are probed
+	internal bool
+	// next is the time of the next check of each domain, the domains are checked at their own intervals
+	next map[string]time.Time
+}
+
+// StartHealthDaemon checks the hosts of the domains with a health check on the leader,
+// it is disabled when the interval is 0. The interval is how often the due domains are looked up.
+func StartHealthDaemon(done chan struct{}) error {
+	interval, err := calculateInterval()
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		logrus.Info("health check daemon is disabled")
+		return nil
+	}
+
+	workers, err := calculateWorkers()
+	if err != nil {
+		return err
+	}
+
+	internal, err := calculateInternal()
+	if err != nil {
+		return err
+	}
+
+	c := &checker{
+		workers:  workers,
+		internal: internal,
+		next:     make(map[string]time.Time),
+	}
+
+	go wait.JitterUntil(func() {
+		if !leader.IsLeader() {
+			logrus.Debugf("skip health check process, not the leader")
+			return
+		}
+		if err := c.run(time.Now()); err != nil {
+			failuresCounter.Inc()
+			logrus.Error(err)
+		}
+	}, interval, .1, true, done)
+
+	return nil
+}
+
+func (c *checker) run(now time.Time) error {
+	states, err := backend.GetBackend().ListHealthStates()
+	if err != nil {
+		return errors.Wrap(err, errListHealth)
+	}
+
+	// pick the domains which are due, and forget the domains which have no health check any more
+	due := make([]*model.HealthState, 0)
+	listed := make(map[string]bool, len(states))
+	for _, s := range states {
+		listed[s.Fqdn] = true
+		if next, ok := c.next[s.Fqdn]; ok && now.Before(next) {
+			continue
+		}
+		c.next[s.Fqdn] = now.Add(s.Check.GetInterval())
+		due = append(due, s)
+	}
+	for fqdn := range c.next {
+		if !listed[fqdn] {
+			delete(c.next, fqdn)
+		}
+	}
+
+	results := c.probeAll(due)
+
+	for i, s := range due {
+		updated, changed := apply(s, results[i], now)
+		if !changed {
+			continue
+		}
+		if err := backend.GetBackend().SetHealthState(updated); err != nil {
+			failuresCounter.Inc()
+			logrus.Error(errors.Wrapf(err, errSetHealth, s.Fqdn))
+			continue
+		}
+		*s = *updated
+	}
+
+	observe(states)
+
+	logrus.Debugf("health check process finished, domains: %d, checked: %d", len(states), len(due))
+
+	return nil
+}
+
+// Used to probe the hosts of the domains concurrently, returns the errors of the probes by the index of the hosts
+func (c *checker) probeAll(states []*model.HealthState) [][]error {
+	results := make([][]error, len(states))
+	sem := make(chan struct{}, c.workers)
+
+	var wg sync.WaitGroup
+	for i, s := range states {
+		results[i] = make([]error, len(s.Hosts))
+		for j, h := range s.Hosts {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i, j int, fqdn, host string, check *model.HealthCheck) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				if err := c.allowProbe(host); err != nil {
+					checksCounter.WithLabelValues(check.Type, resultRefused).Inc()
+					results[i][j] = err
+					return
+				}
+				err := probe(fqdn, host, check)
+				result := resultSuccess
+				if err != nil {
+					result = resultFailure
+				}
+				checksCounter.WithLabelValues(check.Type, result).Inc()
+				results[i][j] = err
+			}(i, j, s.Fqdn, h.Host, &s.Check)
+		}
+	}
+	wg.Wait()
+
+	return results
+}
+
+// Used to apply the results of the probes to a copy of the state, returns whether the state is changed.
+// The counts stop at the thresholds so that the state is not changed by the probes of a stable host.
+func apply(s *model.HealthState, results []error, now time.Time) (*model.HealthState, bool) {
+	updated := &model.HealthState{
+		Fqdn:  s.Fqdn,
+		Check: s.Check,
+		Hosts: make([]model.HostHealth, len(s.Hosts)),
+	}
+	copy(updated.Hosts, s.Hosts)
+
+	changed := false
+	for i := range updated.Hosts {
+		h := &updated.Hosts[i]
+		old := *h
+
+		if err := results[i]; err != nil {
+			h.Successes = 0
+			h.Failures = min(h.Failures+1, s.Check.GetUnhealthyThreshold())
+			logrus.Debugf("health check of host %s of %s failed: %v", h.Host, s.Fqdn, err)
+			if h.Healthy && h.Failures >= s.Check.GetUnhealthyThreshold() {
+				h.Healthy = false
+				h.Changed = &now
+				transitionsCounter.WithLabelValues(stateUnhealthy).Inc()
+				logrus.Infof("host %s of %s becomes unhealthy: %v", h.Host, s.Fqdn, err)
+			}
+		} else {
+			h.Failures = 0
+			h.Successes = min(h.Successes+1, s.Check.GetHealthyThreshold())
+			if !h.Healthy && h.Successes >= s.Check.GetHealthyThreshold() {
+				h.Healthy = true
+				h.Changed = &now
+				transitionsCounter.WithLabelValues(stateHealthy).Inc()
+				logrus.Infof("host %s of %s becomes healthy", h.Host, s.Fqdn)
+			}
+		}
+
+		if *h != old {
+			changed = true
+		}
+	}
+
+	return updated, changed
+}
+
+// Used to refuse the hosts which the host policy denies, and the internal hosts unless they are allowed,
+// so that the health checks can not be used to reach the networks of the server
+func (c *checker) allowProbe(host string) error {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errors.Errorf(errRefusedHost, host)
+	}
+	if err := policy.GetPolicy().CheckHost(host); err != nil {
+		return errors.Wrapf(err, errRefusedHost, host)
+	}
+	if !c.internal && policy.IsInternal(ip) {
+		return errors.Errorf(errRefusedHost, host)
+	}
+	return nil
+}
+
+// Used to probe a host, the http check sends the domain as the host header and does not follow the redirects
+func probe(fqdn, host string, check *model.HealthCheck) error {
+	addr := net.JoinHostPort(host, strconv.Itoa(check.Port))
+
+	if check.Type != model.HealthCheckHTTP {
+		conn, err := net.DialTimeout("tcp", addr, check.GetTimeout())
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	client := &http.Client{
+		Timeout: check.GetTimeout(),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	url := fmt.Sprintf("http://%s%s", addr, check.Path)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Host = fqdn
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return errors.Errorf(errUnhealthyURL, resp.StatusCode, url)
+	}
+	return nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func calculateInterval() (time.Duration, error) {
+	v := os.Getenv(flagInterval)
+	if v == "" {
+		return 0, nil
+	}
+	i, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.Wrapf(err, errInvalidEnv, flagInterval, v)
+	}
+	return i, nil
+}
+
+func calculateWorkers() (int, error) {
+	v := os.Getenv(flagWorkers)
+	if v == "" {
+		return defaultWorkers, nil
+	}
+	w, err := strconv.Atoi(v)
+	if err != nil || w <= 0 {
+		return 0, errors.Errorf(errInvalidEnv, flagWorkers, v)
+	}
+	return w, nil
+}
+
+func calculateInternal() (bool, error) {
+	v := os.Getenv(flagInternal)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.Errorf(errInvalidEnv, flagInternal, v)
+	}
+	return b, nil
+}
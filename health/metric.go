@@ -0,0 +1,65 @@
+package health
+
+import (
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	resultSuccess  = "success"
+	resultFailure  = "failure"
+	resultRefused  = "refused"
+	stateHealthy   = "healthy"
+	stateUnhealthy = "unhealthy"
+)
+
+var (
+	checksCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rancher_dns_health_checks_total",
+		Help: "The number of the health checks of the hosts",
+	}, []string{"type", "result"})
+
+	transitionsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rancher_dns_health_transitions_total",
+		Help: "The number of the hosts which become healthy or unhealthy",
+	}, []string{"to"})
+
+	hostsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rancher_dns_health_hosts",
+		Help: "The number of the healthy and unhealthy hosts of the domains with a health check",
+	}, []string{"state"})
+
+	allUnhealthyGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "rancher_dns_health_all_unhealthy_domains",
+		Help: "The number of the domains whose hosts are all unhealthy, they are answered with all hosts",
+	})
+
+	failuresCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rancher_dns_health_failures_total",
+		Help: "The number of the health states which failed to be listed or saved",
+	})
+)
+
+func observe(states []*model.HealthState) {
+	var healthy, unhealthy, all int
+	for _, s := range states {
+		n := 0
+		for _, h := range s.Hosts {
+			if h.Healthy {
+				healthy++
+				continue
+			}
+			unhealthy++
+			n++
+		}
+		if n > 0 && n == len(s.Hosts) {
+			all++
+		}
+	}
+
+	hostsGauge.WithLabelValues(stateHealthy).Set(float64(healthy))
+	hostsGauge.WithLabelValues(stateUnhealthy).Set(float64(unhealthy))
+	allUnhealthyGauge.Set(float64(all))
+}
@@ -0,0 +1,9 @@
+package leader
+
+const (
+	errCampaign         = "failed to campaign for leader %s"
+	errCheckLock        = "failed to check lock %s"
+	errNewSession       = "failed to create etcd session"
+	errParseFlag        = "failed to parse flag: %s"
+	errShortElectionTTL = "leader election ttl %s is shorter than 1s"
+)
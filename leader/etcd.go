@@ -0,0 +1,90 @@
+package leader
+
+import (
+	"context"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// etcdElector campaigns with an etcd election, the leadership is kept by the lease of the session.
+// When the leader is gone its lease expires after the ttl and the next candidate is elected.
+type etcdElector struct {
+	c      *clientv3.Client
+	prefix string
+	ttl    time.Duration
+}
+
+func NewEtcdElector(c *clientv3.Client, prefix string, ttl time.Duration) Elector {
+	return &etcdElector{
+		c:      c,
+		prefix: prefix,
+		ttl:    ttl,
+	}
+}
+
+func (e *etcdElector) Run(done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		if err := e.campaign(done); err != nil {
+			logrus.Error(err)
+			select {
+			case <-done:
+				return
+			case <-time.After(e.ttl):
+			}
+		}
+	}
+}
+
+// campaign blocks until the leadership is lost or done is closed.
+func (e *etcdElector) campaign(done chan struct{}) error {
+	s, err := concurrency.NewSession(e.c, concurrency.WithTTL(int(e.ttl.Seconds())))
+	if err != nil {
+		return errors.Wrap(err, errNewSession)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-done:
+		case <-s.Done():
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+
+	el := concurrency.NewElection(s, e.prefix)
+	if err := el.Campaign(ctx, identity()); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return errors.Wrapf(err, errCampaign, e.prefix)
+	}
+
+	setLeader(true)
+	defer setLeader(false)
+
+	select {
+	case <-done:
+		rctx, rcancel := context.WithTimeout(context.Background(), e.ttl)
+		defer rcancel()
+		if err := el.Resign(rctx); err != nil {
+			logrus.Debugf("failed to resign leader %s: %v", e.prefix, err)
+		}
+	case <-s.Done():
+	}
+
+	return nil
+}
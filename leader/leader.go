@@ -0,0 +1,88 @@
+package leader
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	flagElectionTTL = "LEADER_ELECTION_TTL"
+
+	defaultElectionTTL = 5 * time.Second
+)
+
+var (
+	// elected is set when an election is started, replicas without an election always lead
+	elected int32
+	leading int32
+
+	leaderGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "rancher_dns_leader",
+		Help: "Whether this replica is the leader which runs the background daemons",
+	})
+)
+
+// Elector campaigns for the leadership of the background daemons until done is closed.
+type Elector interface {
+	Run(done chan struct{})
+}
+
+// StartElection runs the elector, IsLeader reports false until it is elected.
+func StartElection(e Elector, done chan struct{}) {
+	atomic.StoreInt32(&elected, 1)
+	leaderGauge.Set(0)
+	go e.Run(done)
+}
+
+// IsLeader returns whether this replica should run the background daemons.
+func IsLeader() bool {
+	if atomic.LoadInt32(&elected) == 0 {
+		return true
+	}
+	return atomic.LoadInt32(&leading) == 1
+}
+
+func setLeader(l bool) {
+	var v int32
+	if l {
+		v = 1
+	}
+	if atomic.SwapInt32(&leading, v) != v {
+		if l {
+			logrus.Infof("became the leader of background daemons")
+		} else {
+			logrus.Infof("lost the leader of background daemons")
+		}
+	}
+	leaderGauge.Set(float64(v))
+}
+
+// GetElectionTTL returns the duration after which the leadership of a lost replica is taken over.
+func GetElectionTTL() (time.Duration, error) {
+	v := os.Getenv(flagElectionTTL)
+	if v == "" {
+		return defaultElectionTTL, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.Wrapf(err, errParseFlag, "leader_election_ttl")
+	}
+	if d < time.Second {
+		return 0, errors.Errorf(errShortElectionTTL, d)
+	}
+	return d, nil
+}
+
+func identity() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return h
+}
@@ -0,0 +1,75 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// mysqlElector holds a named MySQL lock (GET_LOCK) on a dedicated connection.
+// The lock is released by MySQL when the connection is closed, so a follower
+// takes over within one check period after the leader is gone.
+type mysqlElector struct {
+	db     *sql.DB
+	name   string
+	period time.Duration
+	conn   *sql.Conn
+}
+
+func NewMySQLElector(db *sql.DB, name string, ttl time.Duration) Elector {
+	return &mysqlElector{
+		db:     db,
+		name:   name,
+		period: ttl / 2,
+	}
+}
+
+func (e *mysqlElector) Run(done chan struct{}) {
+	wait.Until(e.check, e.period, done)
+
+	if e.conn != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), e.period)
+		defer cancel()
+		if _, err := e.conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", e.name); err != nil {
+			logrus.Debugf("failed to release lock %s: %v", e.name, err)
+		}
+		e.conn.Close()
+	}
+	setLeader(false)
+}
+
+func (e *mysqlElector) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), e.period)
+	defer cancel()
+
+	if e.conn == nil {
+		conn, err := e.db.Conn(ctx)
+		if err != nil {
+			logrus.Error(errors.Wrapf(err, errCheckLock, e.name))
+			setLeader(false)
+			return
+		}
+		e.conn = conn
+	}
+
+	query := "SELECT GET_LOCK(?, 0)"
+	if IsLeader() {
+		query = "SELECT IS_USED_LOCK(?) = CONNECTION_ID()"
+	}
+
+	var result sql.NullInt64
+	if err := e.conn.QueryRowContext(ctx, query, e.name).Scan(&result); err != nil {
+		logrus.Error(errors.Wrapf(err, errCheckLock, e.name))
+		// the lock is gone with the connection, start over with a new one
+		e.conn.Close()
+		e.conn = nil
+		setLeader(false)
+		return
+	}
+
+	setLeader(result.Valid && result.Int64 == 1)
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/rancher/rdns-server/command/etcdv3"
+	"github.com/rancher/rdns-server/command/migrate"
 	"github.com/rancher/rdns-server/command/route53"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
@@ -45,21 +46,224 @@ func main() {
 			Usage:  "used to set the duration when the domain name can be used again.",
 			Value:  "2160h",
 		},
+		cli.StringFlag{
+			Name:   "plain_listen",
+			EnvVar: "PLAIN_LISTEN",
+			Usage:  "used to set a plain http listen port for ping and metrics (e.g. :9334).",
+		},
+		cli.StringFlag{
+			Name:   "tls_cert_file",
+			EnvVar: "TLS_CERT_FILE",
+			Usage:  "used to set the tls certificate file, enables https when set with tls_key_file.",
+		},
+		cli.StringFlag{
+			Name:   "tls_key_file",
+			EnvVar: "TLS_KEY_FILE",
+			Usage:  "used to set the tls private key file.",
+		},
+		cli.StringFlag{
+			Name:   "tls_client_ca_file",
+			EnvVar: "TLS_CLIENT_CA_FILE",
+			Usage:  "used to set the ca bundle which verifies client certificates, enables mutual tls.",
+		},
+		cli.StringFlag{
+			Name:   "tls_client_auth",
+			EnvVar: "TLS_CLIENT_AUTH",
+			Usage:  "used to set the client certificate policy when tls_client_ca_file is set: optional, require.",
+			Value:  "optional",
+		},
+		cli.StringFlag{
+			Name:   "tls_admin_names",
+			EnvVar: "TLS_ADMIN_NAMES",
+			Usage:  "used to set the client certificate common names which have admin rights, comma separated.",
+		},
+		cli.StringFlag{
+			Name:   "leader_election_ttl",
+			EnvVar: "LEADER_ELECTION_TTL",
+			Usage:  "used to set the duration after which another replica takes over the background daemons from a lost leader.",
+			Value:  "5s",
+		},
+		cli.StringFlag{
+			Name:   "min_lease_time",
+			EnvVar: "MIN_LEASE_TIME",
+			Usage:  "used to set the shortest lease time which a domain can request.",
+			Value:  "1h",
+		},
+		cli.StringFlag{
+			Name:   "max_lease_time",
+			EnvVar: "MAX_LEASE_TIME",
+			Usage:  "used to set the longest lease time which a domain can request.",
+			Value:  "2160h",
+		},
+		cli.StringFlag{
+			Name:   "grace_period",
+			EnvVar: "GRACE_PERIOD",
+			Usage:  "used to set the duration when an expired domain is suspended before it is purged.",
+			Value:  "0s",
+		},
+		cli.StringFlag{
+			Name:   "parking_address",
+			EnvVar: "PARKING_ADDRESS",
+			Usage:  "used to set the address which suspended domains are answered with, NXDOMAIN when empty.",
+		},
+		cli.StringFlag{
+			Name:   "purge_interval",
+			EnvVar: "PURGE_INTERVAL",
+			Usage:  "used to set the interval of the purge process.",
+			Value:  "10m",
+		},
+		cli.StringFlag{
+			Name:   "purge_batch_size",
+			EnvVar: "PURGE_BATCH_SIZE",
+			Usage:  "used to set the number of expired domains which are purged in one batch.",
+			Value:  "100",
+		},
+		cli.StringFlag{
+			Name:   "purge_dry_run",
+			EnvVar: "PURGE_DRY_RUN",
+			Usage:  "used to set whether the purge process only reports the expired domains without changing them.",
+			Value:  "false",
+		},
+		cli.StringFlag{
+			Name:   "health_check_interval",
+			EnvVar: "HEALTH_CHECK_INTERVAL",
+			Usage:  "used to set how often the domains are looked up for the due health checks, 0 disables the health checks.",
+			Value:  "10s",
+		},
+		cli.StringFlag{
+			Name:   "health_check_workers",
+			EnvVar: "HEALTH_CHECK_WORKERS",
+			Usage:  "used to set the number of the hosts which are health checked concurrently.",
+			Value:  "20",
+		},
+		cli.StringFlag{
+			Name:   "health_check_internal",
+			EnvVar: "HEALTH_CHECK_INTERNAL",
+			Usage:  "used to set whether the loopback, private and link-local hosts are health checked.",
+			Value:  "false",
+		},
+		cli.StringFlag{
+			Name:   "reconcile_interval",
+			EnvVar: "RECONCILE_INTERVAL",
+			Usage:  "used to set the interval of comparing route53 with the database, 0 disables it.",
+			Value:  "1h",
+		},
+		cli.StringFlag{
+			Name:   "reconcile_repair",
+			EnvVar: "RECONCILE_REPAIR",
+			Usage:  "used to set whether the differences between route53 and the database are repaired periodically.",
+			Value:  "false",
+		},
+		cli.StringFlag{
+			Name:   "check_interval",
+			EnvVar: "CHECK_INTERVAL",
+			Usage:  "used to set the interval of checking the etcd keys and leases, 0 disables it.",
+			Value:  "1h",
+		},
+		cli.StringFlag{
+			Name:   "check_fix",
+			EnvVar: "CHECK_FIX",
+			Usage:  "used to set whether the inconsistent etcd keys and leases are fixed periodically.",
+			Value:  "false",
+		},
+		cli.StringFlag{
+			Name:   "host_policy_file",
+			EnvVar: "HOST_POLICY_FILE",
+			Usage:  "used to set the host policy file which holds allow and deny rules of each record type.",
+		},
+		cli.StringFlag{
+			Name:   "host_policy_deny",
+			EnvVar: "HOST_POLICY_DENY",
+			Usage:  "used to set the cidrs or named sets (loopback, private, linklocal, multicast, reserved) which hosts can not use, comma separated, none to deny nothing.",
+			Value:  "loopback,linklocal,multicast,reserved",
+		},
+		cli.StringFlag{
+			Name:   "host_policy_allow",
+			EnvVar: "HOST_POLICY_ALLOW",
+			Usage:  "used to set the cidrs which hosts can always use, comma separated.",
+		},
+		cli.StringFlag{
+			Name:   "reserved_names_file",
+			EnvVar: "RESERVED_NAMES_FILE",
+			Usage:  "used to set the file of reserved and offensive name patterns which can not be used as domain names, one pattern per line.",
+		},
+		cli.StringFlag{
+			Name:   "reserved_names",
+			EnvVar: "RESERVED_NAMES",
+			Usage:  "used to set the reserved and offensive name patterns which can not be used as domain names, comma separated.",
+		},
+		cli.StringFlag{
+			Name:   "auth_chain",
+			EnvVar: "AUTH_CHAIN",
+			Usage:  "used to set the authenticators which are tried in order, comma separated: cert, hmac, token, jwt, apikey.",
+			Value:  "cert,hmac,token",
+		},
+		cli.StringFlag{
+			Name:   "auth_signature_skew",
+			EnvVar: "AUTH_SIGNATURE_SKEW",
+			Usage:  "used to set the allowed clock skew of signed requests.",
+			Value:  "5m",
+		},
+		cli.StringFlag{
+			Name:   "auth_api_keys_file",
+			EnvVar: "AUTH_API_KEYS_FILE",
+			Usage:  "used to set the static api keys file, each line is \"<name> <key> <admin|fqdn,...>\".",
+		},
+		cli.StringFlag{
+			Name:   "auth_jwt_issuer",
+			EnvVar: "AUTH_JWT_ISSUER",
+			Usage:  "used to set the oidc issuer url of jwt bearer tokens.",
+		},
+		cli.StringFlag{
+			Name:   "auth_jwt_audience",
+			EnvVar: "AUTH_JWT_AUDIENCE",
+			Usage:  "used to set the expected audience of jwt bearer tokens, required by the jwt authenticator.",
+		},
+		cli.StringFlag{
+			Name:   "auth_jwt_jwks_url",
+			EnvVar: "AUTH_JWT_JWKS_URL",
+			Usage:  "used to set the jwks url, discovered from auth_jwt_issuer when empty.",
+		},
+		cli.StringFlag{
+			Name:   "auth_jwt_secret",
+			EnvVar: "AUTH_JWT_SECRET",
+			Usage:  "used to set the shared secret of hmac signed jwt bearer tokens.",
+		},
+		cli.StringFlag{
+			Name:   "auth_jwt_fqdns_claim",
+			EnvVar: "AUTH_JWT_FQDNS_CLAIM",
+			Usage:  "used to set the jwt claim which lists the fqdns the caller may manage.",
+			Value:  "rdns_fqdns",
+		},
+		cli.StringFlag{
+			Name:   "auth_jwt_admin_claim",
+			EnvVar: "AUTH_JWT_ADMIN_CLAIM",
+			Usage:  "used to set the jwt claim which grants admin rights when it is true.",
+			Value:  "rdns_admin",
+		},
 	}
 	app.Commands = []cli.Command{
 		{
-			Name:    "route53",
-			Aliases: []string{"r53"},
-			Usage:   "use aws route53 backend",
-			Flags:   route53.Flags(),
-			Action:  route53.Action,
+			Name:        "route53",
+			Aliases:     []string{"r53"},
+			Usage:       "use aws route53 backend",
+			Flags:       route53.Flags(),
+			Action:      route53.Action,
+			Subcommands: route53.Subcommands(),
+		},
+		{
+			Name:        "etcdv3",
+			Aliases:     []string{"ev3"},
+			Usage:       "use etcd-v3 backend",
+			Flags:       etcdv3.Flags(),
+			Action:      etcdv3.Action,
+			Subcommands: etcdv3.Subcommands(),
 		},
 		{
-			Name:    "etcdv3",
-			Aliases: []string{"ev3"},
-			Usage:   "use etcd-v3 backend",
-			Flags:   etcdv3.Flags(),
-			Action:  etcdv3.Action,
+			Name:   "migrate",
+			Usage:  "migrate the domains, tokens and frozen prefixes between route53 and etcd-v3 backends",
+			Flags:  migrate.Flags(),
+			Action: migrate.Action,
 		},
 	}
 	if err := app.Run(os.Args); err != nil {
@@ -75,7 +279,7 @@ func beforeFunc(c *cli.Context) error {
 }
 
 func versionPrinter(c *cli.Context) {
-	if _, err := fmt.Fprintf(c.App.Writer, DNSVersion); err != nil {
+	if _, err := fmt.Fprint(c.App.Writer, DNSVersion); err != nil {
 		logrus.Error(err)
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/rancher/rdns-server/backend"
+	"github.com/rancher/rdns-server/leader"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -25,11 +26,13 @@ func StartMetricDaemon(done chan struct{}) {
 		case <-done:
 			return
 		default:
-			count, err := backend.GetBackend().GetTokenCount()
-			if err != nil {
-				logrus.Errorf("failed to count token numbers: %s", err.Error())
+			if leader.IsLeader() {
+				count, err := backend.GetBackend().GetTokenCount()
+				if err != nil {
+					logrus.Errorf("failed to count token numbers: %s", err.Error())
+				}
+				tokenGauge.Set(float64(count))
 			}
-			tokenGauge.Set(float64(count))
 			time.Sleep(queryDuration)
 		}
 	}
@@ -0,0 +1,15 @@
+package migrate
+
+const (
+	errExport         = "failed to export from %s"
+	errGetDomain      = "failed to get domain from %s"
+	errGetText        = "failed to get TXT record %s from %s"
+	errGetToken       = "failed to get token from %s"
+	errListFrozen     = "failed to list frozen prefix from %s"
+	errMismatchDomain = "%s differs, %s: %s, %s: %s"
+	errMismatchZone   = "zone %s of %s does not match zone %s of %s"
+	errNotFrozen      = "prefix is not frozen in %s"
+	errOpenStateFile  = "failed to open state file %s"
+	errSameBackend    = "can not migrate from %s to itself"
+	errWriteStateFile = "failed to write state file %s"
+)
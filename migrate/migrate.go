@@ -0,0 +1,300 @@
+package migrate
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancher/rdns-server/backend"
+	"github.com/rancher/rdns-server/backup"
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// progressInterval is the number of entries between two progress logs.
+	progressInterval = 100
+	// verifyTolerance is the allowed difference of the expirations, etcd leases are granted in seconds.
+	verifyTolerance = time.Minute
+)
+
+// Options are the options of a migration.
+type Options struct {
+	// StateFile keeps the entries which are migrated, they are skipped when the migration is resumed.
+	StateFile string
+	// VerifyOnly only compares the backends without importing anything.
+	VerifyOnly bool
+}
+
+// Run reads every domain and frozen prefix of one backend and imports it into another, keeping the slugs,
+// tokens and expirations. Every entry is verified afterwards by comparing both backends, the report tells
+// whether the target is ready for the cutover. An entry which fails is reported and the migration goes on,
+// running it again retries the failed entries only when a state file is used.
+func Run(from, to backend.Backend, opts *Options) (*model.MigrationReport, error) {
+	if from.GetName() == to.GetName() {
+		return nil, errors.Errorf(errSameBackend, from.GetName())
+	}
+	if !strings.EqualFold(from.GetZone(), to.GetZone()) {
+		return nil, errors.Errorf(errMismatchZone, from.GetZone(), from.GetName(), to.GetZone(), to.GetName())
+	}
+
+	r := &model.MigrationReport{
+		From:       from.GetName(),
+		To:         to.GetName(),
+		Zone:       from.GetZone(),
+		VerifyOnly: opts.VerifyOnly,
+		Started:    time.Now(),
+		Failures:   make([]model.MigrationFailure, 0),
+	}
+
+	s, err := openState(opts.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	defer s.close()
+
+	entries := make([]*model.ExportEntry, 0)
+	err = from.Export(func(e *model.ExportEntry) error {
+		entries = append(entries, e)
+		if e.Kind == model.ExportKindDomain {
+			r.Domains++
+		} else {
+			r.Frozen++
+		}
+		if len(entries)%progressInterval == 0 {
+			logrus.Infof("migrate progress, entries: %d, migrated: %d, skipped: %d, failures: %d",
+				len(entries), r.Migrated, r.Skipped, len(r.Failures))
+		}
+
+		if opts.VerifyOnly {
+			return nil
+		}
+		if s.isDone(e) {
+			r.Skipped++
+			return nil
+		}
+
+		if err := backup.ValidateEntry(e, to.GetZone()); err != nil {
+			r.AddFailure(e.Name(), model.MigrationStepImport, err)
+			return nil
+		}
+		if err := to.Import(e); err != nil {
+			r.AddFailure(e.Name(), model.MigrationStepImport, err)
+			return nil
+		}
+		r.Migrated++
+
+		return s.add(e)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, errExport, from.GetName())
+	}
+
+	for _, e := range entries {
+		var err error
+		if e.Kind == model.ExportKindDomain {
+			err = verifyDomain(from, to, e)
+		} else {
+			err = verifyFrozen(to, e)
+		}
+		if err != nil {
+			r.AddFailure(e.Name(), model.MigrationStepVerify, err)
+			continue
+		}
+		r.Verified++
+	}
+
+	r.Ready = len(r.Failures) == 0
+	r.Finished = time.Now()
+	r.Duration = r.Finished.Sub(r.Started).String()
+
+	logrus.Infof("migrate from %s to %s finished in %s, domains: %d, frozen prefixes: %d, migrated: %d, skipped: %d, verified: %d, ready: %t",
+		r.From, r.To, r.Duration, r.Domains, r.Frozen, r.Migrated, r.Skipped, r.Verified, r.Ready)
+	for _, f := range r.Failures {
+		logrus.Warnf("failed to %s %s: %s", f.Step, f.Name, f.Error)
+	}
+
+	return r, nil
+}
+
+// A domain is verified when its records, state, token and expiration are the same in both backends
+func verifyDomain(from, to backend.Backend, e *model.ExportEntry) error {
+	opts := &model.DomainOptions{Fqdn: e.Fqdn}
+	get := func(b backend.Backend) (model.Domain, error) {
+		if e.CNAME != "" {
+			return b.GetCNAME(opts)
+		}
+		return b.Get(opts)
+	}
+
+	src, err := get(from)
+	if err != nil {
+		return errors.Wrapf(err, errGetDomain, from.GetName())
+	}
+	dst, err := get(to)
+	if err != nil {
+		return errors.Wrapf(err, errGetDomain, to.GetName())
+	}
+
+	if err := compare("hosts", from, to, sortedHosts(src.Hosts), sortedHosts(dst.Hosts)); err != nil {
+		return err
+	}
+	if err := compare("subdomain", from, to, sortedSubDomain(src.SubDomain), sortedSubDomain(dst.SubDomain)); err != nil {
+		return err
+	}
+	if err := compare("cname", from, to, src.CNAME, dst.CNAME); err != nil {
+		return err
+	}
+	if err := compare("state", from, to, stateOf(src), stateOf(dst)); err != nil {
+		return err
+	}
+	if src.Expiration != nil && dst.Expiration != nil {
+		if d := src.Expiration.Sub(*dst.Expiration); d > verifyTolerance || d < -verifyTolerance {
+			return compare("expiration", from, to, src.Expiration.Format(time.RFC3339), dst.Expiration.Format(time.RFC3339))
+		}
+	}
+
+	srcToken, err := from.GetToken(e.Fqdn)
+	if err != nil {
+		return errors.Wrapf(err, errGetToken, from.GetName())
+	}
+	dstToken, err := to.GetToken(e.Fqdn)
+	if err != nil {
+		return errors.Wrapf(err, errGetToken, to.GetName())
+	}
+	if srcToken != dstToken {
+		return errors.Errorf(errMismatchDomain, "token", from.GetName(), "***", to.GetName(), "***")
+	}
+
+	for name := range e.Texts {
+		topts := &model.DomainOptions{Fqdn: name}
+		st, err := from.GetText(topts)
+		if err != nil {
+			return errors.Wrapf(err, errGetText, name, from.GetName())
+		}
+		dt, err := to.GetText(topts)
+		if err != nil {
+			return errors.Wrapf(err, errGetText, name, to.GetName())
+		}
+		if err := compare(name, from, to, st.Text, dt.Text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// An expired frozen prefix is not imported, it is not verified either
+func verifyFrozen(to backend.Backend, e *model.ExportEntry) error {
+	if e.Expiration != nil && e.Expiration.Before(time.Now()) {
+		return nil
+	}
+
+	fs, err := to.ListFrozen(e.Prefix)
+	if err != nil {
+		return errors.Wrapf(err, errListFrozen, to.GetName())
+	}
+	for _, f := range fs {
+		if f.Prefix == e.Prefix {
+			return nil
+		}
+	}
+
+	return errors.Errorf(errNotFrozen, to.GetName())
+}
+
+func compare(field string, from, to backend.Backend, src, dst string) error {
+	if src != dst {
+		return errors.Errorf(errMismatchDomain, field, from.GetName(), src, to.GetName(), dst)
+	}
+	return nil
+}
+
+func sortedHosts(hosts []string) string {
+	hs := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if h != "" {
+			hs = append(hs, h)
+		}
+	}
+	sort.Strings(hs)
+	return strings.Join(hs, ",")
+}
+
+func sortedSubDomain(subs map[string][]string) string {
+	ss := make([]string, 0, len(subs))
+	for k, v := range subs {
+		ss = append(ss, fmt.Sprintf("%s=%s", k, sortedHosts(v)))
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, ";")
+}
+
+func stateOf(d model.Domain) string {
+	if d.State == "" {
+		return model.StateActive
+	}
+	return d.State
+}
+
+// state is the state file of a migration, each line is an entry which is migrated
+type state struct {
+	name string
+	f    *os.File
+	done map[string]bool
+}
+
+func openState(name string) (*state, error) {
+	s := &state{name: name, done: make(map[string]bool)}
+	if name == "" {
+		return s, nil
+	}
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, errOpenStateFile, name)
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			s.done[line] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, errOpenStateFile, name)
+	}
+
+	s.f = f
+	return s, nil
+}
+
+func (s *state) isDone(e *model.ExportEntry) bool {
+	return s.done[stateKey(e)]
+}
+
+func (s *state) add(e *model.ExportEntry) error {
+	if s.f == nil {
+		return nil
+	}
+	if _, err := fmt.Fprintln(s.f, stateKey(e)); err != nil {
+		return errors.Wrapf(err, errWriteStateFile, s.name)
+	}
+	return nil
+}
+
+func (s *state) close() {
+	if s.f != nil {
+		s.f.Close()
+	}
+}
+
+func stateKey(e *model.ExportEntry) string {
+	return e.Kind + " " + e.Name()
+}
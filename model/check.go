@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+const (
+	// IssueNoToken is a record or suspended record whose token does not exist.
+	IssueNoToken = "no_token"
+	// IssueLeaseMismatch is a record whose lease is not the lease of its token.
+	IssueLeaseMismatch = "lease_mismatch"
+	// IssueOrphanLease is a lease of rdns which has no keys attached but its marker.
+	IssueOrphanLease = "orphan_lease"
+	// IssueUnknownLease is a lease which has no keys attached, it is not known to be a lease of rdns.
+	IssueUnknownLease = "unknown_lease"
+	// IssueStaleFrozen is a frozen key which never expires.
+	IssueStaleFrozen = "stale_frozen"
+)
+
+// CheckReport is the report of one consistency check of the etcd keys and leases.
+type CheckReport struct {
+	Fix      bool      `json:"fix"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Duration string    `json:"duration"`
+	Keys     int       `json:"keys"`
+	Leases   int       `json:"leases"`
+	Issues   []Issue   `json:"issues"`
+}
+
+// Issue is an inconsistent key or lease.
+type Issue struct {
+	Kind          string `json:"kind"`
+	Key           string `json:"key,omitempty"`
+	Lease         int64  `json:"lease,omitempty"`
+	ExpectedLease int64  `json:"expected_lease,omitempty"`
+	Fixed         bool   `json:"fixed"`
+	Error         string `json:"error,omitempty"`
+}
+
+// AddIssue records an issue, err is the error of the fix if any.
+func (r *CheckReport) AddIssue(i Issue, err error) {
+	if err != nil {
+		i.Error = err.Error()
+	}
+	r.Issues = append(r.Issues, i)
+}
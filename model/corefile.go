@@ -0,0 +1,125 @@
+package model
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Validate checks the options of the generated Corefile, so that a wrong option fails at startup rather than
+// when coredns loads the Corefile.
+func (f *CoreFile) Validate() error {
+	for _, u := range f.Upstreams {
+		if err := validateUpstream(u); err != nil {
+			return err
+		}
+	}
+	if f.CNAMEFlatten && len(f.Upstreams) <= 0 {
+		return fmt.Errorf("cname flattening requires upstream resolvers")
+	}
+
+	if f.WeightedAnswers <= 0 {
+		return fmt.Errorf("weighted answers must be positive: %d", f.WeightedAnswers)
+	}
+	if f.Cache.Success < 0 || f.Cache.Denial < 0 {
+		return fmt.Errorf("cache sizes can not be negative: %d,%d", f.Cache.Success, f.Cache.Denial)
+	}
+	if (f.Cache.Success == 0) != (f.Cache.Denial == 0) {
+		return fmt.Errorf("cache sizes must both be set: %d,%d", f.Cache.Success, f.Cache.Denial)
+	}
+
+	if err := f.validateZones(); err != nil {
+		return err
+	}
+
+	if err := f.validateListeners(); err != nil {
+		return err
+	}
+
+	if f.RegionsFile != "" {
+		if _, err := os.Stat(f.RegionsFile); err != nil {
+			return fmt.Errorf("invalid regions file: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Used to check the extra zones, a zone is served once and its file must exist
+func (f *CoreFile) validateZones() error {
+	seen := make(map[string]bool, len(f.ExtraZones))
+	for _, z := range f.ExtraZones {
+		if _, ok := dns.IsDomainName(z.Zone); !ok || z.Zone == "" {
+			return fmt.Errorf("invalid extra zone: %s", z.Zone)
+		}
+		name := strings.ToLower(dns.Fqdn(z.Zone))
+		if seen[name] {
+			return fmt.Errorf("duplicate extra zone: %s", z.Zone)
+		}
+		seen[name] = true
+
+		if _, err := os.Stat(z.File); err != nil {
+			return fmt.Errorf("invalid file of extra zone %s: %v", z.Zone, err)
+		}
+	}
+	return nil
+}
+
+// Used to check the ports and addresses of the listeners, they must not collide and the DNS over TLS and HTTPS
+// listeners need a certificate
+func (f *CoreFile) validateListeners() error {
+	ports := map[int]string{f.Port: "dns"}
+	for name, port := range map[string]int{"dns over tls": f.TLSPort, "dns over https": f.HTTPSPort} {
+		if port == 0 {
+			continue
+		}
+		if port < 0 || port > 65535 {
+			return fmt.Errorf("invalid %s port: %d", name, port)
+		}
+		if other, ok := ports[port]; ok {
+			return fmt.Errorf("%s port %d is used by the %s listener", name, port, other)
+		}
+		ports[port] = name
+	}
+
+	if f.TLSPort != 0 || f.HTTPSPort != 0 {
+		if f.TLSCertFile == "" || f.TLSKeyFile == "" {
+			return fmt.Errorf("dns over tls and https listeners require a certificate and a key")
+		}
+		if _, err := tls.LoadX509KeyPair(f.TLSCertFile, f.TLSKeyFile); err != nil {
+			return fmt.Errorf("invalid certificate of dns over tls and https listeners: %v", err)
+		}
+	}
+
+	addresses := make(map[string]string, 2)
+	for name, addr := range map[string]string{"prometheus": f.PrometheusAddress, "health": f.HealthAddress} {
+		if addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid %s address: %v", name, err)
+		}
+		if other, ok := addresses[addr]; ok {
+			return fmt.Errorf("%s address %s is used by the %s listener", name, addr, other)
+		}
+		addresses[addr] = name
+	}
+
+	return nil
+}
+
+// Used to check an upstream resolver, an ip address with an optional port
+func validateUpstream(u string) error {
+	host := u
+	if h, _, err := net.SplitHostPort(u); err == nil {
+		host = h
+	}
+	if net.ParseIP(host) == nil {
+		return fmt.Errorf("invalid upstream resolver: %s", u)
+	}
+	return nil
+}
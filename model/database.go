@@ -3,10 +3,13 @@ package model
 import "database/sql"
 
 type Token struct {
-	ID        int64  `db:"id"`
-	Token     string `db:"token"`
-	Fqdn      string `db:"fqdn"`
-	CreatedOn int64  `db:"created_on"`
+	ID          int64         `db:"id"`
+	Token       string        `db:"token"`
+	Fqdn        string        `db:"fqdn"`
+	CreatedOn   int64         `db:"created_on"`
+	SuspendedOn sql.NullInt64 `db:"suspended_on"`
+	LeaseTime   sql.NullInt64 `db:"lease_time"`
+	SignedOnly  bool          `db:"signed_only"`
 }
 
 type FrozenPrefix struct {
@@ -54,3 +57,22 @@ type RecordCNAME struct {
 	UpdatedOn sql.NullInt64 `db:"updated_on"`
 	TID       int64         `db:"tid"`
 }
+
+// The kinds of the domain options, the content of a health_check is the JSON of the HealthState of the domain,
+// the content of a host_weight or a host_region is the JSON of the weights or the regions keyed by host.
+const (
+	OptionHealthCheck = "health_check"
+	OptionHostWeight  = "host_weight"
+	OptionHostRegion  = "host_region"
+)
+
+// RecordDomainOption is an option of a domain which is kept as JSON, a domain has one option of each kind.
+type RecordDomainOption struct {
+	ID        int64         `db:"id"`
+	Fqdn      string        `db:"fqdn"`
+	Kind      string        `db:"kind"`
+	Content   string        `db:"content"`
+	CreatedOn int64         `db:"created_on"`
+	UpdatedOn sql.NullInt64 `db:"updated_on"`
+	TID       int64         `db:"tid"`
+}
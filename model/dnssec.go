@@ -0,0 +1,101 @@
+package model
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	DNSSECKeyFlagZSK = 256
+	DNSSECKeyFlagKSK = 257
+
+	DNSSECKeyPublished = "published"
+	DNSSECKeyActive    = "active"
+	DNSSECKeyRetired   = "retired"
+
+	// DNSSECKeyTTL is the ttl of the DNSKEY records.
+	DNSSECKeyTTL = 3600
+)
+
+// DNSSECKeySet is the keys which sign a zone, it is kept in etcd by the rdns plugin.
+type DNSSECKeySet struct {
+	Zone string      `json:"zone"`
+	Keys []DNSSECKey `json:"keys"`
+}
+
+// DNSSECKey is a key which signs a zone. It is published in the DNSKEY records from Publish until Remove,
+// and signs from Activate until Retire, an empty Retire or Remove means never.
+type DNSSECKey struct {
+	KeyTag     uint16     `json:"key_tag"`
+	Flags      uint16     `json:"flags"`
+	Algorithm  uint8      `json:"algorithm"`
+	PublicKey  string     `json:"public_key"`
+	PrivateKey string     `json:"private_key,omitempty"`
+	Publish    time.Time  `json:"publish"`
+	Activate   time.Time  `json:"activate"`
+	Retire     *time.Time `json:"retire,omitempty"`
+	Remove     *time.Time `json:"remove,omitempty"`
+}
+
+// DS is the DS record of a key signing key, which is added to the parent zone.
+type DS struct {
+	Zone       string     `json:"zone"`
+	KeyTag     uint16     `json:"key_tag"`
+	Algorithm  uint8      `json:"algorithm"`
+	DigestType uint8      `json:"digest_type"`
+	Digest     string     `json:"digest"`
+	Record     string     `json:"record"`
+	State      string     `json:"state"`
+	Activate   time.Time  `json:"activate"`
+	Retire     *time.Time `json:"retire,omitempty"`
+}
+
+// IsKSK returns whether the key is a key signing key.
+func (k *DNSSECKey) IsKSK() bool {
+	return k.Flags == DNSSECKeyFlagKSK
+}
+
+// IsPublished returns whether the key is in the DNSKEY records at the time.
+func (k *DNSSECKey) IsPublished(now time.Time) bool {
+	return !now.Before(k.Publish) && (k.Remove == nil || now.Before(*k.Remove))
+}
+
+// State returns whether the key is published only, signing or retired at the time.
+func (k *DNSSECKey) State(now time.Time) string {
+	switch {
+	case now.Before(k.Activate):
+		return DNSSECKeyPublished
+	case k.Retire != nil && !now.Before(*k.Retire):
+		return DNSSECKeyRetired
+	default:
+		return DNSSECKeyActive
+	}
+}
+
+// DNSKEY returns the DNSKEY record of the key.
+func (k *DNSSECKey) DNSKEY(zone string) *dns.DNSKEY {
+	return &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: dns.Fqdn(zone), Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: DNSSECKeyTTL},
+		Flags:     k.Flags,
+		Protocol:  3,
+		Algorithm: k.Algorithm,
+		PublicKey: k.PublicKey,
+	}
+}
+
+// DS returns the SHA-256 DS record of the key.
+func (k *DNSSECKey) DS(zone string, now time.Time) DS {
+	ds := k.DNSKEY(zone).ToDS(dns.SHA256)
+	return DS{
+		Zone:       dns.Fqdn(zone),
+		KeyTag:     ds.KeyTag,
+		Algorithm:  ds.Algorithm,
+		DigestType: ds.DigestType,
+		Digest:     ds.Digest,
+		Record:     ds.String(),
+		State:      k.State(now),
+		Activate:   k.Activate,
+		Retire:     k.Retire,
+	}
+}
@@ -7,6 +7,14 @@ import (
 	"time"
 )
 
+const (
+	// StateActive is the state of a domain which is answered with its records.
+	StateActive = "active"
+	// StateSuspended is the state of a domain which is expired but still in its grace period,
+	// it is answered with the parking address or NXDOMAIN until it is renewed or purged.
+	StateSuspended = "suspended"
+)
+
 type Domain struct {
 	Fqdn       string              `json:"fqdn,omitempty"`
 	Hosts      []string            `json:"hosts,omitempty"`
@@ -14,6 +22,14 @@ type Domain struct {
 	Text       string              `json:"text,omitempty"`
 	CNAME      string              `json:"cname,omitempty"`
 	Expiration *time.Time          `json:"expiration,omitempty"`
+	State      string              `json:"state,omitempty"`
+	Purge      *time.Time          `json:"purge,omitempty"`
+
+	HealthCheck *HealthCheck          `json:"health_check,omitempty"`
+	Health      []HostHealth          `json:"health,omitempty"`
+	Weights     map[string]HostWeight `json:"weights,omitempty"`
+	Regions     map[string]string     `json:"regions,omitempty"`
+	SignedOnly  bool                  `json:"signed_only,omitempty"`
 }
 
 func (d *Domain) String() string {
@@ -36,6 +52,12 @@ type DomainOptions struct {
 	Text      string              `json:"text"`
 	CNAME     string              `json:"cname"`
 	Normal    bool                `json:"normal"`
+	LeaseTime string              `json:"lease_time"`
+
+	HealthCheck *HealthCheck          `json:"health_check"`
+	Weights     map[string]HostWeight `json:"weights"`
+	Regions     map[string]string     `json:"regions"`
+	SignedOnly  *bool                 `json:"signed_only"`
 }
 
 func (d *DomainOptions) String() string {
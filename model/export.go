@@ -0,0 +1,82 @@
+package model
+
+import "time"
+
+const (
+	// ExportVersion is the version of the export format, files of a newer version can not be imported.
+	ExportVersion = 1
+
+	ExportKindHeader = "header"
+	ExportKindDomain = "domain"
+	ExportKindFrozen = "frozen"
+)
+
+// ExportEntry is one line of an export file, the first line is the header which is followed by
+// the domains and frozen prefixes of the backend.
+type ExportEntry struct {
+	Kind string `json:"kind"`
+
+	// header
+	Version  int        `json:"version,omitempty"`
+	Backend  string     `json:"backend,omitempty"`
+	Zone     string     `json:"zone,omitempty"`
+	Exported *time.Time `json:"exported,omitempty"`
+
+	// domain, the texts are the TXT records of the domain keyed by their fqdn
+	Fqdn      string              `json:"fqdn,omitempty"`
+	Hosts     []string            `json:"hosts,omitempty"`
+	SubDomain map[string][]string `json:"subdomain,omitempty"`
+	CNAME     string              `json:"cname,omitempty"`
+	Texts     map[string]string   `json:"texts,omitempty"`
+	Token     string              `json:"token,omitempty"`
+	LeaseTime string              `json:"lease_time,omitempty"`
+	State     string              `json:"state,omitempty"`
+
+	HealthCheck *HealthCheck          `json:"health_check,omitempty"`
+	Weights     map[string]HostWeight `json:"weights,omitempty"`
+	Regions     map[string]string     `json:"regions,omitempty"`
+	SignedOnly  bool                  `json:"signed_only,omitempty"`
+
+	// frozen prefix
+	Prefix string `json:"prefix,omitempty"`
+
+	Expiration *time.Time `json:"expiration,omitempty"`
+}
+
+// Name returns the fqdn of a domain or the prefix of a frozen prefix.
+func (e *ExportEntry) Name() string {
+	if e.Kind == ExportKindFrozen {
+		return e.Prefix
+	}
+	return e.Fqdn
+}
+
+// ImportReport is the report of an import.
+type ImportReport struct {
+	DryRun   bool            `json:"dry_run"`
+	Version  int             `json:"version"`
+	Backend  string          `json:"backend"`
+	Started  time.Time       `json:"started"`
+	Finished time.Time       `json:"finished"`
+	Duration string          `json:"duration"`
+	Lines    int             `json:"lines"`
+	Domains  int             `json:"domains"`
+	Frozen   int             `json:"frozen"`
+	Failures []ImportFailure `json:"failures,omitempty"`
+}
+
+// ImportFailure is a line which failed to be validated or imported.
+type ImportFailure struct {
+	Line  int    `json:"line"`
+	Name  string `json:"name,omitempty"`
+	Error string `json:"error"`
+}
+
+// AddFailure records a failed line.
+func (r *ImportReport) AddFailure(line int, name string, err error) {
+	r.Failures = append(r.Failures, ImportFailure{
+		Line:  line,
+		Name:  name,
+		Error: err.Error(),
+	})
+}
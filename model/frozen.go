@@ -0,0 +1,47 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Frozen is a prefix (slug name) which can not be used by a new domain until it expires.
+type Frozen struct {
+	Prefix     string     `json:"prefix"`
+	Expiration *time.Time `json:"expiration"`
+}
+
+// FrozenOptions is used to add or extend a frozen prefix,
+// the duration is the frozen time of a new prefix or the time which is added to an existing one.
+type FrozenOptions struct {
+	Prefix   string `json:"prefix"`
+	Duration string `json:"duration"`
+}
+
+func (f *FrozenOptions) String() string {
+	return fmt.Sprintf("[prefix: %s, duration: %s]", f.Prefix, f.Duration)
+}
+
+// GetDuration returns the parsed duration, or def when the duration is empty.
+func (f *FrozenOptions) GetDuration(def time.Duration) (time.Duration, error) {
+	if f.Duration == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(f.Duration)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive: %s", f.Duration)
+	}
+	return d, nil
+}
+
+func ParseFrozenOptions(r *http.Request) (*FrozenOptions, error) {
+	var opts FrozenOptions
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&opts)
+	return &opts, err
+}
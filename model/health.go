@@ -0,0 +1,186 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	HealthCheckTCP  = "tcp"
+	HealthCheckHTTP = "http"
+
+	defaultHealthInterval     = 30 * time.Second
+	defaultHealthTimeout      = 5 * time.Second
+	defaultHealthyThreshold   = 2
+	defaultUnhealthyThreshold = 3
+	minHealthInterval         = 5 * time.Second
+	maxHealthThreshold        = 10
+)
+
+// HealthCheck is the health check of the hosts of a domain, the empty fields take the defaults.
+type HealthCheck struct {
+	Type               string `json:"type"`
+	Port               int    `json:"port"`
+	Path               string `json:"path,omitempty"`
+	Interval           string `json:"interval,omitempty"`
+	Timeout            string `json:"timeout,omitempty"`
+	HealthyThreshold   int    `json:"healthy_threshold,omitempty"`
+	UnhealthyThreshold int    `json:"unhealthy_threshold,omitempty"`
+}
+
+// HostHealth is the health of a host of a domain, a host becomes healthy or unhealthy after the consecutive
+// successes or failures reach the threshold. The counts stop at the thresholds.
+type HostHealth struct {
+	Host      string     `json:"host"`
+	Healthy   bool       `json:"healthy"`
+	Successes int        `json:"successes"`
+	Failures  int        `json:"failures"`
+	Changed   *time.Time `json:"changed,omitempty"`
+}
+
+// HealthState is the health check of a domain with the health of its hosts.
+type HealthState struct {
+	Fqdn  string       `json:"fqdn"`
+	Check HealthCheck  `json:"check"`
+	Hosts []HostHealth `json:"hosts"`
+}
+
+// Validate checks the fields of the health check.
+func (c *HealthCheck) Validate() error {
+	switch c.Type {
+	case HealthCheckTCP:
+		if c.Path != "" {
+			return fmt.Errorf("health check path is only used by http: %s", c.Path)
+		}
+	case HealthCheckHTTP:
+		if c.Path != "" && !strings.HasPrefix(c.Path, "/") {
+			return fmt.Errorf("health check path must start with /: %s", c.Path)
+		}
+	default:
+		return fmt.Errorf("health check type must be tcp or http: %s", c.Type)
+	}
+
+	if c.Port <= 0 || c.Port > 65535 {
+		return fmt.Errorf("health check port must be between 1 and 65535: %d", c.Port)
+	}
+
+	for _, v := range []string{c.Interval, c.Timeout} {
+		if v == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			return fmt.Errorf("health check interval and timeout must be positive durations: %s", v)
+		}
+	}
+	if c.GetInterval() < minHealthInterval {
+		return fmt.Errorf("health check interval must not be shorter than %s", minHealthInterval)
+	}
+	if c.GetTimeout() >= c.GetInterval() {
+		return fmt.Errorf("health check timeout must be shorter than the interval")
+	}
+
+	for _, v := range []int{c.HealthyThreshold, c.UnhealthyThreshold} {
+		if v < 0 || v > maxHealthThreshold {
+			return fmt.Errorf("health check thresholds must be between 1 and %d: %d", maxHealthThreshold, v)
+		}
+	}
+
+	return nil
+}
+
+// GetInterval returns the interval of the checks, 30s by default.
+func (c *HealthCheck) GetInterval() time.Duration {
+	return durationOr(c.Interval, defaultHealthInterval)
+}
+
+// GetTimeout returns the timeout of a check, 5s by default.
+func (c *HealthCheck) GetTimeout() time.Duration {
+	return durationOr(c.Timeout, defaultHealthTimeout)
+}
+
+// GetHealthyThreshold returns the consecutive successes which make a host healthy, 2 by default.
+func (c *HealthCheck) GetHealthyThreshold() int {
+	if c.HealthyThreshold > 0 {
+		return c.HealthyThreshold
+	}
+	return defaultHealthyThreshold
+}
+
+// GetUnhealthyThreshold returns the consecutive failures which make a host unhealthy, 3 by default.
+func (c *HealthCheck) GetUnhealthyThreshold() int {
+	if c.UnhealthyThreshold > 0 {
+		return c.UnhealthyThreshold
+	}
+	return defaultUnhealthyThreshold
+}
+
+// NewHealthState returns the health state of the hosts, the hosts which are in the old state keep their health
+// and the others start healthy.
+func NewHealthState(fqdn string, check *HealthCheck, hosts []string, old *HealthState) *HealthState {
+	s := &HealthState{
+		Fqdn:  fqdn,
+		Check: *check,
+		Hosts: make([]HostHealth, 0, len(hosts)),
+	}
+
+	known := make(map[string]HostHealth)
+	if old != nil {
+		for _, h := range old.Hosts {
+			known[h.Host] = h
+		}
+	}
+
+	for _, host := range hosts {
+		if h, ok := known[host]; ok {
+			s.Hosts = append(s.Hosts, h)
+			continue
+		}
+		s.Hosts = append(s.Hosts, HostHealth{Host: host, Healthy: true})
+	}
+
+	return s
+}
+
+// HostNames returns the hosts of the state.
+func (s *HealthState) HostNames() []string {
+	hosts := make([]string, 0, len(s.Hosts))
+	for _, h := range s.Hosts {
+		hosts = append(hosts, h.Host)
+	}
+	return hosts
+}
+
+// Dropped returns the unhealthy hosts which are dropped from the answers, none when every host is unhealthy,
+// so that a domain is never answered without any host.
+func (s *HealthState) Dropped() map[string]bool {
+	dropped := make(map[string]bool)
+	for _, h := range s.Hosts {
+		if !h.Healthy {
+			dropped[h.Host] = true
+		}
+	}
+	if len(dropped) == len(s.Hosts) {
+		return map[string]bool{}
+	}
+	return dropped
+}
+
+// Served returns the hosts which are answered.
+func (s *HealthState) Served() []string {
+	dropped := s.Dropped()
+	hosts := make([]string, 0, len(s.Hosts))
+	for _, h := range s.Hosts {
+		if !dropped[h.Host] {
+			hosts = append(hosts, h.Host)
+		}
+	}
+	return hosts
+}
+
+func durationOr(v string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(v); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
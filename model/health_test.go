@@ -0,0 +1,51 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDropped(t *testing.T) {
+	tests := []struct {
+		name   string
+		hosts  []HostHealth
+		want   map[string]bool
+		served []string
+	}{
+		{"no hosts", nil, map[string]bool{}, []string{}},
+		{
+			"every host is healthy",
+			[]HostHealth{{Host: "1.1.1.1", Healthy: true}, {Host: "2.2.2.2", Healthy: true}},
+			map[string]bool{},
+			[]string{"1.1.1.1", "2.2.2.2"},
+		},
+		{
+			"unhealthy host",
+			[]HostHealth{{Host: "1.1.1.1", Healthy: true}, {Host: "2.2.2.2", Failures: 3}},
+			map[string]bool{"2.2.2.2": true},
+			[]string{"1.1.1.1"},
+		},
+		{
+			"failing host which is still healthy",
+			[]HostHealth{{Host: "1.1.1.1", Healthy: true, Failures: 1}, {Host: "2.2.2.2", Healthy: true}},
+			map[string]bool{},
+			[]string{"1.1.1.1", "2.2.2.2"},
+		},
+		{
+			"every host is unhealthy",
+			[]HostHealth{{Host: "1.1.1.1"}, {Host: "2.2.2.2"}},
+			map[string]bool{},
+			[]string{"1.1.1.1", "2.2.2.2"},
+		},
+	}
+
+	for _, tt := range tests {
+		s := &HealthState{Hosts: tt.hosts}
+		if got := s.Dropped(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Dropped = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := s.Served(); !reflect.DeepEqual(got, tt.served) {
+			t.Errorf("%s: Served = %v, want %v", tt.name, got, tt.served)
+		}
+	}
+}
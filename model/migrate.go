@@ -3,6 +3,8 @@ package model
 import (
 	"encoding/json"
 	"net/http"
+	"path"
+	"strings"
 	"time"
 )
 
@@ -13,6 +15,10 @@ type MigrateRecord struct {
 	Text       string              `json:"text"`
 	Token      string              `json:"token"`
 	Expiration *time.Time          `json:"expiration"`
+
+	Weights    map[string]HostWeight `json:"weights,omitempty"`
+	Regions    map[string]string     `json:"regions,omitempty"`
+	SignedOnly bool                  `json:"signed_only,omitempty"`
 }
 
 type MigrateFrozen struct {
@@ -26,6 +32,21 @@ type MigrateToken struct {
 	Expiration *time.Time `json:"expiration"`
 }
 
+// Fqdn returns the fqdn of the token, the path is the fqdn or an etcd key which ends with the fqdn.
+// e.g. /token/sample_lb_rancher_cloud => sample.lb.rancher.cloud
+func (t *MigrateToken) Fqdn() string {
+	return strings.Replace(path.Base(t.Path), "_", ".", -1)
+}
+
+// MigrateResult is the result of one line of a bulk migration.
+type MigrateResult struct {
+	Line   int    `json:"line"`
+	Name   string `json:"name,omitempty"`
+	Status int    `json:"status"`
+	DryRun bool   `json:"dry_run"`
+	Error  string `json:"error,omitempty"`
+}
+
 func ParseMigrateRecord(r *http.Request) (*MigrateRecord, error) {
 	var opts MigrateRecord
 	decoder := json.NewDecoder(r.Body)
@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+const (
+	MigrationStepImport = "import"
+	MigrationStepVerify = "verify"
+)
+
+// MigrationReport is the report of a migration from one backend to another,
+// the target is ready for the cutover when every entry is migrated and verified.
+type MigrationReport struct {
+	From       string             `json:"from"`
+	To         string             `json:"to"`
+	Zone       string             `json:"zone"`
+	VerifyOnly bool               `json:"verify_only"`
+	Started    time.Time          `json:"started"`
+	Finished   time.Time          `json:"finished"`
+	Duration   string             `json:"duration"`
+	Domains    int                `json:"domains"`
+	Frozen     int                `json:"frozen"`
+	Migrated   int                `json:"migrated"`
+	Skipped    int                `json:"skipped"`
+	Verified   int                `json:"verified"`
+	Ready      bool               `json:"ready"`
+	Failures   []MigrationFailure `json:"failures,omitempty"`
+}
+
+// MigrationFailure is a domain or frozen prefix which failed to be migrated or verified.
+type MigrationFailure struct {
+	Name  string `json:"name"`
+	Step  string `json:"step"`
+	Error string `json:"error"`
+}
+
+// AddFailure records a failed domain or frozen prefix.
+func (r *MigrationReport) AddFailure(name, step string, err error) {
+	r.Failures = append(r.Failures, MigrationFailure{
+		Name:  name,
+		Step:  step,
+		Error: err.Error(),
+	})
+}
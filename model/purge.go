@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+const (
+	PurgeActionPurge   = "purge"
+	PurgeActionSuspend = "suspend"
+)
+
+// PurgeReport is the report of one run of the purger.
+type PurgeReport struct {
+	ID        int64          `json:"id"`
+	DryRun    bool           `json:"dry_run"`
+	Started   time.Time      `json:"started"`
+	Finished  time.Time      `json:"finished"`
+	Duration  string         `json:"duration"`
+	Expired   int            `json:"expired"`
+	Purged    []string       `json:"purged"`
+	Suspended []string       `json:"suspended"`
+	Records   int            `json:"records"`
+	Failures  []PurgeFailure `json:"failures,omitempty"`
+}
+
+// PurgeFailure is a domain which failed to be purged or suspended.
+type PurgeFailure struct {
+	Fqdn   string `json:"fqdn"`
+	Action string `json:"action"`
+	Error  string `json:"error"`
+}
+
+// AddFailure records a failed domain.
+func (r *PurgeReport) AddFailure(fqdn, action string, err error) {
+	r.Failures = append(r.Failures, PurgeFailure{
+		Fqdn:   fqdn,
+		Action: action,
+		Error:  err.Error(),
+	})
+}
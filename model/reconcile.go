@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+const (
+	// DriftRoute53Only is a record set which exists in route53 but not in the database.
+	DriftRoute53Only = "route53_only"
+	// DriftDatabaseOnly is a record which exists in the database but not in route53.
+	DriftDatabaseOnly = "database_only"
+	// DriftMismatch is a record whose values differ between route53 and the database.
+	DriftMismatch = "mismatch"
+	// DriftNoToken is a record whose token does not exist.
+	DriftNoToken = "no_token"
+	// DriftNoRecords is a token which has no records.
+	DriftNoRecords = "no_records"
+)
+
+// ReconcileReport is the report of one comparison of the hosted zone with the database.
+type ReconcileReport struct {
+	Repair          bool      `json:"repair"`
+	Started         time.Time `json:"started"`
+	Finished        time.Time `json:"finished"`
+	Duration        string    `json:"duration"`
+	Route53Records  int       `json:"route53_records"`
+	DatabaseRecords int       `json:"database_records"`
+	Tokens          int       `json:"tokens"`
+	Drifts          []Drift   `json:"drifts"`
+}
+
+// Drift is a difference between the hosted zone and the database.
+type Drift struct {
+	Kind     string `json:"kind"`
+	Type     string `json:"type"`
+	Fqdn     string `json:"fqdn"`
+	Route53  string `json:"route53,omitempty"`
+	Database string `json:"database,omitempty"`
+	Repaired bool   `json:"repaired"`
+	Error    string `json:"error,omitempty"`
+}
+
+// AddDrift records a drift, err is the error of the repair if any.
+func (r *ReconcileReport) AddDrift(d Drift, err error) {
+	if err != nil {
+		d.Error = err.Error()
+	}
+	r.Drifts = append(r.Drifts, d)
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var regionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,62}$`)
+
+// ValidateRegions checks the regions of the hosts of a domain. A region is a name of the regions file of the
+// rdns plugin with etcdv3, and an aws region of the latency records with route53.
+func ValidateRegions(hosts []string, regions map[string]string) error {
+	known := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		known[h] = true
+	}
+
+	for h, r := range regions {
+		if !known[h] {
+			return fmt.Errorf("regional host is not a host of the domain: %s", h)
+		}
+		if !regionPattern.MatchString(r) {
+			return fmt.Errorf("invalid region of host %s: %s", h, r)
+		}
+	}
+
+	return nil
+}
+
+// HostRegions returns the regions of the hosts of a regional domain, nil when the domain is not regional.
+func HostRegions(hosts []string, regions map[string]string) map[string]string {
+	result := make(map[string]string, len(regions))
+	for _, h := range hosts {
+		if r, ok := regions[h]; ok {
+			result[h] = r
+		}
+	}
+
+	if len(result) <= 0 {
+		return nil
+	}
+	return result
+}
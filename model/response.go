@@ -5,4 +5,12 @@ type Response struct {
 	Message string `json:"msg"`
 	Data    Domain `json:"data,omitempty"`
 	Token   string `json:"token"`
+	Secret  string `json:"secret,omitempty"`
+}
+
+// DataResponse is the response of the apis which return other data than a domain.
+type DataResponse struct {
+	Status  int         `json:"status"`
+	Message string      `json:"msg"`
+	Data    interface{} `json:"data,omitempty"`
 }
@@ -1,31 +1,129 @@
 package model
 
 var CoreFileTmpl = `
-. {
-    {{- if and .CoreDNSDBFile .CoreDNSDBZone}}
-    file {{.CoreDNSDBFile}} {{.CoreDNSDBZone}} {
+{{- define "plugins"}}
+    {{- range .ExtraZones}}
+    file {{.File}} {{.Zone}} {
         reload 0
     }
     {{- end}}
     rdns {{.Domain}} {
         path {{.EtcdPrefixPath}}
         endpoint {{.EtcdEndpoints}}
-        upstream 8.8.8.8:53 8.8.4.4:53
+        {{- if .Upstreams}}
+        upstream {{join .Upstreams " "}}
+        {{- end}}
         wildcardbound {{.WildCardBound}}
+        weighted_answers {{.WeightedAnswers}}
+        {{- if .RegionsFile}}
+        regions {{.RegionsFile}}
+        {{- end}}
+        {{- if .CNAMEFlatten}}
+        flatten
+        {{- end}}
+        {{- if .TransferTo}}
+        transfer to {{.TransferTo}}
+        {{- end}}
+        {{- if .NotifyTo}}
+        notify {{.NotifyTo}}
+        {{- end}}
+        {{- if .TsigKey}}
+        tsig {{.TsigKey}}
+        {{- end}}
+        {{- if .DNSSEC}}
+        dnssec
+        {{- if .DNSSECRollover}}
+        dnssec_rollover {{.DNSSECRollover}}
+        {{- end}}
+        {{- end}}
     }
+    {{- if and (not .RegionsFile) .Cache.Enabled}}
     cache {{.TTL}} {{.Domain}}
+    {{- if .Cache.Success}} {
+        success {{.Cache.Success}}
+        denial {{.Cache.Denial}}
+    }
+    {{- end}}
+    {{- end}}
+    {{- if .LoadBalance}}
     loadbalance
-    forward . 8.8.8.8:53 8.8.4.4:53
+    {{- end}}
+    {{- if .Upstreams}}
+    forward . {{join .Upstreams " "}}
+    {{- end}}
+    {{- if .PrometheusAddress}}
+    prometheus {{.PrometheusAddress}}
+    {{- end}}
+    {{- if .QueryLog}}
     log stdout
+    {{- end}}
     errors
-}`
+{{- end}}
+. {
+    {{- if .HealthAddress}}
+    health {{.HealthAddress}}
+    {{- end}}
+    {{- template "plugins" .}}
+}
+{{- if .TLSPort}}
+tls://.:{{.TLSPort}} {
+    tls {{.TLSCertFile}} {{.TLSKeyFile}}
+    {{- template "plugins" .Listener}}
+}
+{{- end}}
+{{- if .HTTPSPort}}
+https://.:{{.HTTPSPort}} {
+    tls {{.TLSCertFile}} {{.TLSKeyFile}}
+    {{- template "plugins" .Listener}}
+}
+{{- end}}`
 
 type CoreFile struct {
-	CoreDNSDBFile  string
-	CoreDNSDBZone  string
-	Domain         string
-	EtcdPrefixPath string
-	EtcdEndpoints  string
-	TTL            string
-	WildCardBound  string
+	Domain          string
+	EtcdPrefixPath  string
+	EtcdEndpoints   string
+	TTL             string
+	WildCardBound   string
+	TransferTo      string
+	NotifyTo        string
+	TsigKey         string
+	DNSSEC          bool
+	DNSSECRollover  string
+	WeightedAnswers int
+	RegionsFile     string
+	CNAMEFlatten    bool
+
+	Upstreams         []string       // Resolvers of the names out of the zones, names are not forwarded when empty
+	Cache             CoreFileCache  // Capacities of the cache of the zone
+	LoadBalance       bool           // Shuffle the order of the answers
+	QueryLog          bool           // Log every query to stdout
+	ExtraZones        []CoreFileZone // Zones which are served from zone files next to the zone of etcd
+	PrometheusAddress string         // Address of the metrics listener, none when empty
+	HealthAddress     string         // Address of the health listener, none when empty
+	Port              int            // Port of the dns listener
+	TLSPort           int            // Port of the DNS over TLS listener, none when 0
+	HTTPSPort         int            // Port of the DNS over HTTPS listener, none when 0
+	TLSCertFile       string         // Certificate of the DNS over TLS and HTTPS listeners
+	TLSKeyFile        string         // Private key of the DNS over TLS and HTTPS listeners
+}
+
+// CoreFileCache is the capacities of the cache of the successful and the denial answers, the cache plugin takes
+// its defaults when they are 0.
+type CoreFileCache struct {
+	Enabled bool
+	Success int
+	Denial  int
+}
+
+// CoreFileZone is a zone which is served from a zone file by the file plugin.
+type CoreFileZone struct {
+	Zone string
+	File string
+}
+
+// Listener returns the options of the DNS over TLS and HTTPS listeners, the zone is transferred and notified by
+// the dns listener only.
+func (f CoreFile) Listener() CoreFile {
+	f.TransferTo, f.NotifyTo, f.TsigKey = "", "", ""
+	return f
 }
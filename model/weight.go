@@ -0,0 +1,97 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	// DefaultHostWeight is the weight of a host which is not in the weights of a weighted domain.
+	DefaultHostWeight = 1
+	// DefaultHostPriority is the priority of a host whose priority is not set, the same as the rdns plugin.
+	DefaultHostPriority = 10
+
+	maxHostWeight   = 255
+	maxHostPriority = 255
+)
+
+// HostWeight is the weight and priority of a host of a domain. The hosts of the lowest priority are answered,
+// each in proportion to its weight, and a host of weight 0 is drained: it is only answered when every host of
+// the domain is drained as well.
+type HostWeight struct {
+	Weight   int `json:"weight"`
+	Priority int `json:"priority,omitempty"`
+}
+
+// ValidateWeights checks the weights of the hosts of a domain.
+func ValidateWeights(hosts []string, weights map[string]HostWeight) error {
+	known := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		known[h] = true
+	}
+
+	for h, w := range weights {
+		if !known[h] {
+			return fmt.Errorf("weighted host is not a host of the domain: %s", h)
+		}
+		if w.Weight < 0 || w.Weight > maxHostWeight {
+			return fmt.Errorf("host weight must be between 0 and %d: %d", maxHostWeight, w.Weight)
+		}
+		if w.Priority < 0 || w.Priority > maxHostPriority {
+			return fmt.Errorf("host priority must be between 0 and %d: %d", maxHostPriority, w.Priority)
+		}
+	}
+
+	return nil
+}
+
+// HostWeights returns the weights of every host of a weighted domain with the defaults filled in,
+// nil when the domain is not weighted.
+func HostWeights(hosts []string, weights map[string]HostWeight) map[string]HostWeight {
+	if len(weights) <= 0 {
+		return nil
+	}
+
+	result := make(map[string]HostWeight, len(hosts))
+	for _, h := range hosts {
+		w, ok := weights[h]
+		if !ok {
+			w.Weight = DefaultHostWeight
+		}
+		if w.Priority <= 0 {
+			w.Priority = DefaultHostPriority
+		}
+		result[h] = w
+	}
+
+	return result
+}
+
+// PreferredHosts returns the hosts of the lowest priority which has a host that is not drained, sorted.
+// All hosts are preferred when the domain is not weighted or every host is drained.
+func PreferredHosts(hosts []string, weights map[string]HostWeight) []string {
+	if len(weights) <= 0 || len(hosts) <= 0 {
+		return hosts
+	}
+
+	best := -1
+	for _, h := range hosts {
+		w := weights[h]
+		if w.Weight > 0 && (best < 0 || w.Priority < best) {
+			best = w.Priority
+		}
+	}
+	if best < 0 {
+		return hosts
+	}
+
+	result := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if weights[h].Priority == best {
+			result = append(result, h)
+		}
+	}
+	sort.Strings(result)
+
+	return result
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPreferredHosts(t *testing.T) {
+	hosts := []string{"3.3.3.3", "1.1.1.1", "2.2.2.2"}
+
+	tests := []struct {
+		name    string
+		hosts   []string
+		weights map[string]HostWeight
+		want    []string
+	}{
+		{"not weighted", hosts, nil, hosts},
+		{"no hosts", nil, map[string]HostWeight{"1.1.1.1": {Weight: 1}}, nil},
+		{
+			"same priority",
+			hosts,
+			HostWeights(hosts, map[string]HostWeight{"1.1.1.1": {Weight: 3}}),
+			[]string{"1.1.1.1", "2.2.2.2", "3.3.3.3"},
+		},
+		{
+			"lowest priority",
+			hosts,
+			HostWeights(hosts, map[string]HostWeight{"1.1.1.1": {Weight: 1, Priority: 20}, "2.2.2.2": {Weight: 1, Priority: 5}}),
+			[]string{"2.2.2.2"},
+		},
+		{
+			"drained priority is skipped",
+			hosts,
+			HostWeights(hosts, map[string]HostWeight{"2.2.2.2": {Weight: 0, Priority: 5}, "3.3.3.3": {Weight: 0, Priority: 5}}),
+			[]string{"1.1.1.1"},
+		},
+		{
+			"drained hosts of the preferred priority are kept",
+			hosts,
+			HostWeights(hosts, map[string]HostWeight{"2.2.2.2": {Weight: 0}, "3.3.3.3": {Weight: 1, Priority: 20}}),
+			[]string{"1.1.1.1", "2.2.2.2"},
+		},
+		{
+			"every host is drained",
+			hosts,
+			HostWeights(hosts, map[string]HostWeight{"1.1.1.1": {}, "2.2.2.2": {}, "3.3.3.3": {Priority: 1}}),
+			hosts,
+		},
+		{
+			"hosts without weights",
+			hosts,
+			map[string]HostWeight{"1.1.1.1": {Weight: 1, Priority: 10}},
+			[]string{"1.1.1.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := PreferredHosts(tt.hosts, tt.weights); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: PreferredHosts = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package policy
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	errLoadPolicy        = "failed to load host policy file: %s"
+	errParseCIDR         = "failed to parse cidr: %s"
+	errParseRule         = "failed to parse %s rule"
+	errSubDomain         = "sub domain %s"
+	errUnknownAction     = "unknown default action: %s"
+	errUnknownRecordType = "unknown record type: %s"
+
+	reasonDenied = "denied by host policy"
+	reasonEmpty  = "empty host"
+)
+
+// ViolationError is returned when a host does not pass the policy.
+type ViolationError struct {
+	Host   string
+	Type   string
+	Reason string
+}
+
+func (e *ViolationError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("host %q is not allowed: %s", e.Host, e.Reason)
+	}
+	return fmt.Sprintf("%s host %q is not allowed: %s", e.Type, e.Host, e.Reason)
+}
+
+// IsViolation returns whether err is caused by a policy violation.
+func IsViolation(err error) bool {
+	_, ok := errors.Cause(err).(*ViolationError)
+	return ok
+}
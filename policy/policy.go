@@ -0,0 +1,315 @@
+package policy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	flagPolicyFile  = "HOST_POLICY_FILE"
+	flagPolicyDeny  = "HOST_POLICY_DENY"
+	flagPolicyAllow = "HOST_POLICY_ALLOW"
+
+	TypeDefault = "default"
+	TypeA       = "A"
+	TypeAAAA    = "AAAA"
+	TypeCNAME   = "CNAME"
+
+	actionAllow = "allow"
+	actionDeny  = "deny"
+
+	// DefaultDeny is the deny list of the default rule when HOST_POLICY_DENY is not set.
+	DefaultDeny = "loopback,linklocal,multicast,reserved"
+	// denyNone turns the default deny list off.
+	denyNone = "none"
+)
+
+// Named address sets which can be used in allow and deny lists instead of CIDRs.
+var namedSets = map[string][]string{
+	"loopback":  {"127.0.0.0/8", "::1/128"},
+	"private":   {"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"},
+	"linklocal": {"169.254.0.0/16", "fe80::/10"},
+	"multicast": {"224.0.0.0/4", "ff00::/8"},
+	"reserved": {
+		"0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "192.0.2.0/24", "198.18.0.0/15",
+		"198.51.100.0/24", "203.0.113.0/24", "240.0.0.0/4", "::/128", "2001:db8::/32",
+	},
+}
+
+// Named sets of the addresses of the local host and networks, which the health checks do not probe by default.
+var internalSets = []string{"loopback", "private", "linklocal"}
+
+var currentPolicy = &Policy{rules: map[string]*rule{}}
+
+// Policy decides which host addresses and CNAME targets may be written to the backends.
+type Policy struct {
+	rules map[string]*rule
+}
+
+// RuleSpec is the configuration of the rule of one record type.
+//   allow: CIDRs or named sets (or name suffixes for CNAME) which are always accepted
+//   deny: CIDRs or named sets (or name suffixes for CNAME) which are rejected
+//   default: allow or deny, the action when nothing matched (default: allow)
+type RuleSpec struct {
+	Allow   []string `json:"allow"`
+	Deny    []string `json:"deny"`
+	Default string   `json:"default"`
+}
+
+type rule struct {
+	allow         []*net.IPNet
+	deny          []*net.IPNet
+	allowSfx      []string
+	denySfx       []string
+	denyByDefault bool
+}
+
+// NewPolicy loads the policy from HOST_POLICY_FILE, HOST_POLICY_DENY and HOST_POLICY_ALLOW.
+// The file maps record types (default, A, AAAA, CNAME) to rules, the flags set the default rule.
+// The default rule denies DefaultDeny unless HOST_POLICY_DENY is set, "none" denies nothing.
+func NewPolicy() (*Policy, error) {
+	specs := make(map[string]*RuleSpec)
+
+	if p := os.Getenv(flagPolicyFile); p != "" {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, errLoadPolicy, p)
+		}
+		if err := json.Unmarshal(b, &specs); err != nil {
+			return nil, errors.Wrapf(err, errLoadPolicy, p)
+		}
+	}
+
+	deny, ok := os.LookupEnv(flagPolicyDeny)
+	if !ok {
+		deny = DefaultDeny
+	}
+	if strings.TrimSpace(deny) == denyNone {
+		deny = ""
+	}
+
+	if deny != "" || os.Getenv(flagPolicyAllow) != "" {
+		d, ok := specs[TypeDefault]
+		if !ok {
+			d = &RuleSpec{}
+			specs[TypeDefault] = d
+		}
+		d.Deny = append(d.Deny, splitList(deny)...)
+		d.Allow = append(d.Allow, splitList(os.Getenv(flagPolicyAllow))...)
+	}
+
+	p := &Policy{rules: make(map[string]*rule)}
+	for t, spec := range specs {
+		switch t {
+		case TypeDefault, TypeA, TypeAAAA, TypeCNAME:
+		default:
+			return nil, errors.Errorf(errUnknownRecordType, t)
+		}
+		r, err := newRule(spec, t == TypeCNAME)
+		if err != nil {
+			return nil, errors.Wrapf(err, errParseRule, t)
+		}
+		p.rules[t] = r
+	}
+
+	return p, nil
+}
+
+func SetPolicy(p *Policy) {
+	currentPolicy = p
+}
+
+func GetPolicy() *Policy {
+	return currentPolicy
+}
+
+// Check validates hosts, sub domain hosts and the CNAME target of the domain options.
+func (p *Policy) Check(opts *model.DomainOptions) error {
+	for _, h := range opts.Hosts {
+		if err := p.CheckHost(h); err != nil {
+			return err
+		}
+	}
+
+	for prefix, hosts := range opts.SubDomain {
+		for _, h := range hosts {
+			if err := p.CheckHost(h); err != nil {
+				return errors.Wrapf(err, errSubDomain, prefix)
+			}
+		}
+	}
+
+	if opts.CNAME != "" {
+		if err := p.CheckHost(opts.CNAME); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckHost validates one host, an address is checked by the A or AAAA rule, a name by the CNAME rule.
+func (p *Policy) CheckHost(host string) error {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		name := strings.ToLower(strings.TrimRight(host, "."))
+		if name == "" {
+			return &ViolationError{Host: host, Reason: reasonEmpty}
+		}
+		if r := p.ruleOf(TypeCNAME); r != nil && !r.allowName(name) {
+			return &ViolationError{Host: host, Type: TypeCNAME, Reason: reasonDenied}
+		}
+		return nil
+	}
+
+	t := TypeA
+	if ip.To4() == nil {
+		t = TypeAAAA
+	}
+	if r := p.ruleOf(t); r != nil && !r.allowIP(ip) {
+		return &ViolationError{Host: host, Type: t, Reason: reasonDenied}
+	}
+
+	return nil
+}
+
+// IsInternal returns whether an address is unspecified, loopback, private or link-local.
+func IsInternal(ip net.IP) bool {
+	if ip.IsUnspecified() {
+		return true
+	}
+	nets, _, _ := parseList(internalSets, false)
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleOf returns the rule of a record type, or the default rule.
+func (p *Policy) ruleOf(t string) *rule {
+	if r, ok := p.rules[t]; ok {
+		return r
+	}
+	return p.rules[TypeDefault]
+}
+
+func newRule(spec *RuleSpec, names bool) (*rule, error) {
+	r := &rule{}
+
+	switch spec.Default {
+	case "", actionAllow:
+	case actionDeny:
+		r.denyByDefault = true
+	default:
+		return nil, errors.Errorf(errUnknownAction, spec.Default)
+	}
+
+	var err error
+	if r.allow, r.allowSfx, err = parseList(spec.Allow, names); err != nil {
+		return nil, err
+	}
+	if r.deny, r.denySfx, err = parseList(spec.Deny, names); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *rule) allowIP(ip net.IP) bool {
+	for _, n := range r.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	for _, n := range r.deny {
+		if n.Contains(ip) {
+			logrus.Debugf("host %s is denied by %s", ip, n)
+			return false
+		}
+	}
+	return !r.denyByDefault
+}
+
+func (r *rule) allowName(name string) bool {
+	for _, s := range r.allowSfx {
+		if matchSuffix(name, s) {
+			return true
+		}
+	}
+	for _, s := range r.denySfx {
+		if matchSuffix(name, s) {
+			logrus.Debugf("name %s is denied by %s", name, s)
+			return false
+		}
+	}
+	return !r.denyByDefault
+}
+
+// parseList parses CIDRs, single addresses and named sets, anything else is a name suffix when names are allowed.
+func parseList(items []string, names bool) ([]*net.IPNet, []string, error) {
+	nets := make([]*net.IPNet, 0)
+	suffixes := make([]string, 0)
+
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if set, ok := namedSets[item]; ok {
+			for _, c := range set {
+				_, n, _ := net.ParseCIDR(c)
+				nets = append(nets, n)
+			}
+			continue
+		}
+
+		if _, n, err := net.ParseCIDR(item); err == nil {
+			nets = append(nets, n)
+			continue
+		}
+
+		if ip := net.ParseIP(item); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		if !names {
+			return nil, nil, errors.Errorf(errParseCIDR, item)
+		}
+		suffixes = append(suffixes, strings.ToLower(strings.TrimPrefix(strings.TrimRight(item, "."), "*")))
+	}
+
+	return nets, suffixes, nil
+}
+
+// matchSuffix matches a name with a suffix pattern.
+// e.g. .internal matches foo.internal, localhost matches localhost only
+func matchSuffix(name, suffix string) bool {
+	if strings.HasPrefix(suffix, ".") {
+		return strings.HasSuffix(name, suffix)
+	}
+	return name == suffix
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
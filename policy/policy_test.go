@@ -0,0 +1,210 @@
+package policy
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/rdns-server/model"
+)
+
+func TestCheckHostByFlags(t *testing.T) {
+	t.Setenv(flagPolicyDeny, "private,loopback,203.0.113.7")
+	t.Setenv(flagPolicyAllow, "10.1.0.0/16")
+
+	p, err := NewPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host    string
+		allowed bool
+	}{
+		{"1.1.1.1", true},
+		{"10.0.0.1", false},
+		{"10.1.2.3", true},
+		{"192.168.1.1", false},
+		{"127.0.0.1", false},
+		{"203.0.113.7", false},
+		{"203.0.113.8", true},
+		{"fc00::1", false},
+		{"2001:4860::1", true},
+		{"target.example.com", true},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		err := p.CheckHost(tt.host)
+		if (err == nil) != tt.allowed {
+			t.Errorf("CheckHost(%q) = %v, allowed %v", tt.host, err, tt.allowed)
+		}
+		if err != nil && !IsViolation(err) {
+			t.Errorf("CheckHost(%q) = %v, not a violation", tt.host, err)
+		}
+	}
+}
+
+func TestDefaultDeny(t *testing.T) {
+	t.Setenv(flagPolicyDeny, "")
+	if err := os.Unsetenv(flagPolicyDeny); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(flagPolicyDeny, denyNone)
+	none, err := NewPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host    string
+		allowed bool
+	}{
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"169.254.169.254", false},
+		{"224.0.0.1", false},
+		{"192.0.2.1", false},
+		{"10.0.0.1", true},
+		{"1.1.1.1", true},
+		{"localhost", true},
+	}
+
+	for _, tt := range tests {
+		if err := p.CheckHost(tt.host); (err == nil) != tt.allowed {
+			t.Errorf("CheckHost(%q) = %v, allowed %v", tt.host, err, tt.allowed)
+		}
+		if err := none.CheckHost(tt.host); err != nil {
+			t.Errorf("CheckHost(%q) with %s = %v", tt.host, denyNone, err)
+		}
+	}
+}
+
+func TestCheckHostByType(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.json")
+	data := `{
+		"default": {"deny": ["reserved"]},
+		"A": {"allow": ["192.0.2.0/24"], "deny": ["multicast"]},
+		"AAAA": {"default": "deny", "allow": ["2001:4860::/32"]},
+		"CNAME": {"allow": ["ok.internal"], "deny": [".internal", "localhost"]}
+	}`
+	if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(flagPolicyFile, file)
+
+	p, err := NewPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		host    string
+		allowed bool
+	}{
+		{"A rule replaces the default rule", "100.64.0.1", true},
+		{"A allow before deny", "192.0.2.1", true},
+		{"A deny", "224.0.0.1", false},
+		{"AAAA deny by default", "2001:db9::1", false},
+		{"AAAA allow", "2001:4860::8888", true},
+		{"CNAME allow before deny", "ok.internal", true},
+		{"CNAME suffix", "db.internal", false},
+		{"CNAME suffix does not match the name", "internal", true},
+		{"CNAME exact name", "localhost.", false},
+		{"CNAME exact name is not a suffix", "my-localhost", true},
+		{"CNAME case", "DB.Internal", false},
+	}
+
+	for _, tt := range tests {
+		if err := p.CheckHost(tt.host); (err == nil) != tt.allowed {
+			t.Errorf("%s: CheckHost(%q) = %v, allowed %v", tt.name, tt.host, err, tt.allowed)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Setenv(flagPolicyDeny, "private")
+
+	p, err := NewPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    *model.DomainOptions
+		allowed bool
+	}{
+		{"hosts", &model.DomainOptions{Hosts: []string{"1.1.1.1", "8.8.8.8"}}, true},
+		{"denied host", &model.DomainOptions{Hosts: []string{"1.1.1.1", "10.0.0.1"}}, false},
+		{"denied sub domain host", &model.DomainOptions{SubDomain: map[string][]string{"sub": {"192.168.0.1"}}}, false},
+		{"denied cname", &model.DomainOptions{CNAME: "172.16.0.1"}, false},
+		{"cname", &model.DomainOptions{CNAME: "target.example.com"}, true},
+	}
+
+	for _, tt := range tests {
+		if err := p.Check(tt.opts); (err == nil) != tt.allowed {
+			t.Errorf("%s: Check = %v, allowed %v", tt.name, err, tt.allowed)
+		}
+	}
+}
+
+func TestNewPolicyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"unknown record type", `{"MX": {"deny": ["private"]}}`},
+		{"unknown action", `{"A": {"default": "drop"}}`},
+		{"name in an address rule", `{"A": {"deny": ["example.com"]}}`},
+		{"invalid json", `{`},
+	}
+
+	for _, tt := range tests {
+		file := filepath.Join(t.TempDir(), "policy.json")
+		if err := ioutil.WriteFile(file, []byte(tt.data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv(flagPolicyFile, file)
+
+		if _, err := NewPolicy(); err == nil {
+			t.Errorf("%s: NewPolicy succeeded", tt.name)
+		}
+	}
+}
+
+func TestIsInternal(t *testing.T) {
+	tests := []struct {
+		ip       string
+		internal bool
+	}{
+		{"0.0.0.0", true},
+		{"::", true},
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.2.3.4", true},
+		{"172.31.255.255", true},
+		{"172.32.0.1", false},
+		{"192.168.10.1", true},
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		{"fd12::1", true},
+		{"1.1.1.1", false},
+		{"2001:4860::8888", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsInternal(net.ParseIP(tt.ip)); got != tt.internal {
+			t.Errorf("IsInternal(%s) = %v, want %v", tt.ip, got, tt.internal)
+		}
+	}
+}
@@ -1,5 +1,6 @@
 package purge
 
 const (
-	errEmptyEnv = "failed to get environment: %s"
+	errEmptyEnv   = "failed to get environment: %s"
+	errInvalidEnv = "invalid environment %s: %s"
 )
@@ -0,0 +1,56 @@
+package purge
+
+import (
+	"strconv"
+
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	runsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rancher_dns_purge_runs_total",
+		Help: "The number of the purge runs",
+	}, []string{"dry_run"})
+
+	domainsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rancher_dns_purge_domains_total",
+		Help: "The number of the domains which are purged or suspended",
+	}, []string{"dry_run", "action"})
+
+	recordsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rancher_dns_purge_records_total",
+		Help: "The number of the route53 record sets which are deleted by the purger",
+	}, []string{"dry_run"})
+
+	failuresCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rancher_dns_purge_failures_total",
+		Help: "The number of the domains which failed to be purged or suspended",
+	}, []string{"dry_run", "action"})
+
+	durationGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rancher_dns_purge_last_duration_seconds",
+		Help: "The duration of the last purge run",
+	}, []string{"dry_run"})
+
+	lastRunGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rancher_dns_purge_last_run_timestamp_seconds",
+		Help: "The time when the last purge run finished",
+	}, []string{"dry_run"})
+)
+
+func observe(r *model.PurgeReport) {
+	dryRun := strconv.FormatBool(r.DryRun)
+
+	runsCounter.WithLabelValues(dryRun).Inc()
+	domainsCounter.WithLabelValues(dryRun, model.PurgeActionPurge).Add(float64(len(r.Purged)))
+	domainsCounter.WithLabelValues(dryRun, model.PurgeActionSuspend).Add(float64(len(r.Suspended)))
+	recordsCounter.WithLabelValues(dryRun).Add(float64(r.Records))
+	for _, f := range r.Failures {
+		failuresCounter.WithLabelValues(dryRun, f.Action).Inc()
+	}
+	durationGauge.WithLabelValues(dryRun).Set(r.Finished.Sub(r.Started).Seconds())
+	lastRunGauge.WithLabelValues(dryRun).Set(float64(r.Finished.Unix()))
+}
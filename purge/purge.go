@@ -3,10 +3,13 @@ package purge
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/rancher/rdns-server/backend"
 	"github.com/rancher/rdns-server/database"
+	"github.com/rancher/rdns-server/leader"
 	"github.com/rancher/rdns-server/model"
 
 	"github.com/sirupsen/logrus"
@@ -14,73 +17,258 @@ import (
 )
 
 const (
-	flagFrozen            = "FROZEN"
-	flagLeaseTime         = "DATABASE_LEASE_TIME"
-	intervalSeconds int64 = 600
+	flagFrozen      = "FROZEN"
+	flagLeaseTime   = "DATABASE_LEASE_TIME"
+	flagGracePeriod = "GRACE_PERIOD"
+	flagInterval    = "PURGE_INTERVAL"
+	flagBatchSize   = "PURGE_BATCH_SIZE"
+	flagDryRun      = "PURGE_DRY_RUN"
+
+	defaultInterval  = 600 * time.Second
+	defaultBatchSize = 100
+	maxReports       = 20
 )
 
+var current = &purger{}
+
 type purger struct {
+	// mu makes sure that only one run is in progress
+	mu        sync.Mutex
+	batchSize int
+	dryRun    bool
+
+	reportMu sync.RWMutex
+	reports  []*model.PurgeReport
+	lastID   int64
+}
+
+// suspender is implemented by backends whose records expire by themselves (e.g. etcd leases),
+// they only need to suspend the domains which are in the grace period.
+type suspender interface {
+	SuspendExpired(dryRun bool, r *model.PurgeReport) error
+}
+
+// recordPurger is implemented by backends which delete the records of many domains in batches.
+type recordPurger interface {
+	PurgeRecords(tokens []*model.Token, dryRun bool, r *model.PurgeReport) []*model.Token
 }
 
 func StartPurgerDaemon(done chan struct{}) {
-	p := &purger{}
-	go wait.JitterUntil(p.purge, time.Duration(intervalSeconds)*time.Second, .1, true, done)
+	current.batchSize = calculateBatchSize()
+	current.dryRun = os.Getenv(flagDryRun) == "true"
+
+	go wait.JitterUntil(func() {
+		if !leader.IsLeader() {
+			logrus.Debugf("skip purge process, not the leader")
+			return
+		}
+		current.run(current.dryRun)
+	}, calculateInterval(), .1, true, done)
+}
+
+// RunOnce runs the purger immediately and returns its report.
+func RunOnce(dryRun bool) *model.PurgeReport {
+	if current.batchSize <= 0 {
+		current.batchSize = calculateBatchSize()
+	}
+	return current.run(dryRun)
+}
+
+// GetReports returns the reports of the latest runs, the newest first.
+func GetReports() []*model.PurgeReport {
+	current.reportMu.RLock()
+	defer current.reportMu.RUnlock()
+
+	reports := make([]*model.PurgeReport, 0, len(current.reports))
+	for i := len(current.reports) - 1; i >= 0; i-- {
+		reports = append(reports, current.reports[i])
+	}
+	return reports
+}
+
+func (p *purger) run(dryRun bool) *model.PurgeReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	logrus.Debugf("running purge process, dry run: %t", dryRun)
+
+	r := &model.PurgeReport{
+		DryRun:    dryRun,
+		Started:   time.Now(),
+		Purged:    make([]string, 0),
+		Suspended: make([]string, 0),
+	}
+
+	if s, ok := backend.GetBackend().(suspender); ok {
+		if err := s.SuspendExpired(dryRun, r); err != nil {
+			logrus.Error(err)
+			r.AddFailure("", model.PurgeActionSuspend, err)
+		}
+	} else {
+		p.purge(dryRun, r)
+	}
+
+	r.Finished = time.Now()
+	r.Duration = r.Finished.Sub(r.Started).String()
+	p.addReport(r)
+
+	logrus.Infof("purge process finished in %s, dry run: %t, expired: %d, purged: %d, suspended: %d, records: %d, failures: %d",
+		r.Duration, dryRun, r.Expired, len(r.Purged), len(r.Suspended), r.Records, len(r.Failures))
+	for _, f := range r.Failures {
+		logrus.Errorf("failed to %s %s: %s", f.Action, f.Fqdn, f.Error)
+	}
+
+	return r
 }
 
-func (p *purger) purge() {
-	logrus.Debugf("running purge process")
+func (p *purger) purge(dryRun bool, r *model.PurgeReport) {
+	grace := calculateGracePeriod()
 
 	// check frozen records, delete the frozen record which is expired
-	if err := database.GetDatabase().DeleteExpiredFrozen(calculateFrozenTime()); err != nil {
-		logrus.Error(err)
+	if !dryRun {
+		if err := database.GetDatabase().DeleteExpiredFrozen(calculateFrozenTime()); err != nil {
+			logrus.Error(err)
+		}
 	}
 
-	// check token records, delete the token record which is expired
+	// check token records, delete the token record which is expired for more than the grace period
 	// this ensures that associated records are also deleted
-	tokens, err := database.GetDatabase().QueryExpiredTokens(calculateTTLTime())
-	if err != nil {
-		logrus.Error(err)
+	lease := calculateLeaseTime()
+	purgeBefore := calculateExpiredTime(grace)
+	var after int64
+	for {
+		tokens, err := database.GetDatabase().QueryExpiredTokens(purgeBefore, lease, after, p.batchSize)
+		if err != nil {
+			logrus.Error(err)
+			break
+		}
+		if len(tokens) <= 0 {
+			break
+		}
+		after = tokens[len(tokens)-1].ID
+		r.Expired += len(tokens)
+
+		p.purgeTokens(tokens, dryRun, r)
+
+		if len(tokens) < p.batchSize {
+			break
+		}
 	}
 
-	for _, token := range tokens {
-		// delete route53 A records & sub A records & wildcard records
-		opts := &model.DomainOptions{
-			Fqdn: token.Fqdn,
+	if grace <= 0 {
+		return
+	}
+
+	// check token records, suspend the domain which is expired but still in the grace period
+	expired := calculateExpiredTime(0)
+	after = 0
+	for {
+		tokens, err := database.GetDatabase().QueryExpiredTokens(expired, lease, after, p.batchSize)
+		if err != nil {
+			logrus.Error(err)
+			break
+		}
+		if len(tokens) <= 0 {
+			break
 		}
-		a, err := backend.GetBackend().Get(opts)
-		if err == nil && a.Fqdn != "" {
-			if err := backend.GetBackend().Delete(opts); err != nil {
-				logrus.Error(err)
+		after = tokens[len(tokens)-1].ID
+
+		for _, token := range tokens {
+			// the tokens past the grace period were handled above, in dry run or when their purge failed they are still here
+			if token.SuspendedOn.Valid || expiresBefore(token, lease, purgeBefore) {
 				continue
 			}
+			r.Expired++
+			if !dryRun {
+				if err := backend.GetBackend().Suspend(&model.DomainOptions{Fqdn: token.Fqdn}); err != nil {
+					r.AddFailure(token.Fqdn, model.PurgeActionSuspend, err)
+					continue
+				}
+			}
+			r.Suspended = append(r.Suspended, token.Fqdn)
 		}
 
-		// delete route53 CNAME records
-		cname, err := backend.GetBackend().GetCNAME(opts)
-		if err == nil && cname.Fqdn != "" {
-			if err := backend.GetBackend().DeleteCNAME(opts); err != nil {
-				logrus.Error(err)
+		if len(tokens) < p.batchSize {
+			break
+		}
+	}
+}
+
+// purgeTokens deletes the records of the tokens and then the tokens with their referenced database records.
+func (p *purger) purgeTokens(tokens []*model.Token, dryRun bool, r *model.PurgeReport) {
+	purged := tokens
+	if rp, ok := backend.GetBackend().(recordPurger); ok {
+		purged = rp.PurgeRecords(tokens, dryRun, r)
+	} else if !dryRun {
+		purged = make([]*model.Token, 0)
+		for _, token := range tokens {
+			if err := purgeDomain(token); err != nil {
+				r.AddFailure(token.Fqdn, model.PurgeActionPurge, err)
 				continue
 			}
+			purged = append(purged, token)
 		}
+	}
 
-		// delete route53 TXT records
-		ts, err := database.GetDatabase().QueryExpiredTXTs(token.ID)
-		for _, t := range ts {
-			tOpts := &model.DomainOptions{
-				Fqdn: t.Fqdn,
-			}
-			if err := backend.GetBackend().DeleteText(tOpts); err != nil {
-				logrus.Error(err)
+	for _, token := range purged {
+		if !dryRun {
+			if err := database.GetDatabase().DeleteToken(token.Token); err != nil {
+				r.AddFailure(token.Fqdn, model.PurgeActionPurge, err)
 				continue
 			}
 		}
+		r.Purged = append(r.Purged, token.Fqdn)
+	}
+}
 
-		// delete token records & referenced records
-		if err := database.GetDatabase().DeleteToken(token.Token); err != nil {
-			logrus.Error(err)
+// purgeDomain deletes the records of a domain one by one.
+func purgeDomain(token *model.Token) error {
+	// delete A records & sub A records & wildcard records
+	opts := &model.DomainOptions{
+		Fqdn: token.Fqdn,
+	}
+	a, err := backend.GetBackend().Get(opts)
+	if err == nil && a.Fqdn != "" {
+		if err := backend.GetBackend().Delete(opts); err != nil {
+			return err
+		}
+	}
+
+	// delete CNAME records
+	cname, err := backend.GetBackend().GetCNAME(opts)
+	if err == nil && cname.Fqdn != "" {
+		if err := backend.GetBackend().DeleteCNAME(opts); err != nil {
+			return err
+		}
+	}
+
+	// delete TXT records
+	ts, _ := database.GetDatabase().QueryExpiredTXTs(token.ID)
+	for _, t := range ts {
+		tOpts := &model.DomainOptions{
+			Fqdn: t.Fqdn,
+		}
+		if err := backend.GetBackend().DeleteText(tOpts); err != nil {
+			return err
 		}
 	}
+
+	return nil
+}
+
+func (p *purger) addReport(r *model.PurgeReport) {
+	p.reportMu.Lock()
+	defer p.reportMu.Unlock()
+
+	p.lastID++
+	r.ID = p.lastID
+
+	p.reports = append(p.reports, r)
+	if len(p.reports) > maxReports {
+		p.reports = p.reports[len(p.reports)-maxReports:]
+	}
+
+	observe(r)
 }
 
 func calculateFrozenTime() *time.Time {
@@ -93,12 +281,62 @@ func calculateFrozenTime() *time.Time {
 	return &e
 }
 
-func calculateTTLTime() *time.Time {
+// calculateExpiredTime returns the time at which the tokens must be expired for more than the grace period.
+func calculateExpiredTime(grace time.Duration) *time.Time {
+	e := time.Now().Add(-grace)
+	return &e
+}
+
+// expiresBefore returns whether a token is expired at t, a token without its own lease time uses the default lease.
+func expiresBefore(token *model.Token, lease time.Duration, t *time.Time) bool {
+	l := lease.Nanoseconds()
+	if token.LeaseTime.Valid {
+		l = token.LeaseTime.Int64
+	}
+	return token.CreatedOn+l <= t.UnixNano()
+}
+
+// calculateLeaseTime returns the default lease time of the tokens which have no lease time of their own.
+func calculateLeaseTime() time.Duration {
 	t, err := time.ParseDuration(os.Getenv(flagLeaseTime))
 	if err != nil {
 		logrus.Fatalf(errEmptyEnv, flagLeaseTime)
 	}
-	duration, _ := time.ParseDuration(fmt.Sprintf("%dns", int(t.Nanoseconds())))
-	e := time.Now().Add(-duration)
-	return &e
+	return t
+}
+
+func calculateGracePeriod() time.Duration {
+	v := os.Getenv(flagGracePeriod)
+	if v == "" {
+		return 0
+	}
+	g, err := time.ParseDuration(v)
+	if err != nil {
+		logrus.Fatalf(errEmptyEnv, flagGracePeriod)
+	}
+	return g
+}
+
+func calculateInterval() time.Duration {
+	v := os.Getenv(flagInterval)
+	if v == "" {
+		return defaultInterval
+	}
+	i, err := time.ParseDuration(v)
+	if err != nil || i <= 0 {
+		logrus.Fatalf(errInvalidEnv, flagInterval, v)
+	}
+	return i
+}
+
+func calculateBatchSize() int {
+	v := os.Getenv(flagBatchSize)
+	if v == "" {
+		return defaultBatchSize
+	}
+	b, err := strconv.Atoi(v)
+	if err != nil || b <= 0 {
+		logrus.Fatalf(errInvalidEnv, flagBatchSize, v)
+	}
+	return b
 }
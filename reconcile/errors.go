@@ -0,0 +1,7 @@
+package reconcile
+
+const (
+	errInvalidEnv   = "invalid environment %s: %s"
+	errNotSupported = "backend %s does not support reconcile"
+	errReconcile    = "failed to reconcile"
+)
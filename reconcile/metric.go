@@ -0,0 +1,62 @@
+package reconcile
+
+import (
+	"strconv"
+
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var driftKinds = []string{
+	model.DriftRoute53Only,
+	model.DriftDatabaseOnly,
+	model.DriftMismatch,
+	model.DriftNoToken,
+	model.DriftNoRecords,
+}
+
+var (
+	runsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rancher_dns_reconcile_runs_total",
+		Help: "The number of the reconcile runs",
+	}, []string{"repair"})
+
+	failuresCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rancher_dns_reconcile_failures_total",
+		Help: "The number of the reconcile runs which failed to compare the records",
+	})
+
+	driftsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rancher_dns_reconcile_drifts",
+		Help: "The number of the drifts which are found by the last reconcile run",
+	}, []string{"kind"})
+
+	repairedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rancher_dns_reconcile_repaired_total",
+		Help: "The number of the drifts which are repaired",
+	}, []string{"kind"})
+
+	lastRunGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "rancher_dns_reconcile_last_run_timestamp_seconds",
+		Help: "The time when the last reconcile run finished",
+	})
+)
+
+func observe(r *model.ReconcileReport) {
+	runsCounter.WithLabelValues(strconv.FormatBool(r.Repair)).Inc()
+
+	counts := make(map[string]int, len(driftKinds))
+	for _, d := range r.Drifts {
+		counts[d.Kind]++
+		if d.Repaired {
+			repairedCounter.WithLabelValues(d.Kind).Inc()
+		}
+	}
+	for _, k := range driftKinds {
+		driftsGauge.WithLabelValues(k).Set(float64(counts[k]))
+	}
+
+	lastRunGauge.Set(float64(r.Finished.Unix()))
+}
@@ -0,0 +1,88 @@
+package reconcile
+
+import (
+	"os"
+	"time"
+
+	"github.com/rancher/rdns-server/backend"
+	"github.com/rancher/rdns-server/leader"
+	"github.com/rancher/rdns-server/model"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	flagInterval = "RECONCILE_INTERVAL"
+	flagRepair   = "RECONCILE_REPAIR"
+)
+
+// reconciler is implemented by backends which keep their records in two stores, e.g. route53 and the database.
+type reconciler interface {
+	Reconcile(repair bool) (*model.ReconcileReport, error)
+}
+
+// StartReconcileDaemon compares the stores of the backend periodically on the leader,
+// it is disabled when the interval is 0.
+func StartReconcileDaemon(done chan struct{}) error {
+	interval, err := calculateInterval()
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		logrus.Info("reconcile daemon is disabled")
+		return nil
+	}
+
+	repair := os.Getenv(flagRepair) == "true"
+
+	go wait.JitterUntil(func() {
+		if !leader.IsLeader() {
+			logrus.Debugf("skip reconcile process, not the leader")
+			return
+		}
+		if _, err := RunOnce(repair); err != nil {
+			logrus.Error(err)
+		}
+	}, interval, .1, true, done)
+
+	return nil
+}
+
+// RunOnce compares the stores of the backend and returns the report, the drifts are repaired when repair is true.
+func RunOnce(repair bool) (*model.ReconcileReport, error) {
+	r, ok := backend.GetBackend().(reconciler)
+	if !ok {
+		return nil, errors.Errorf(errNotSupported, backend.GetBackend().GetName())
+	}
+
+	report, err := r.Reconcile(repair)
+	if err != nil {
+		failuresCounter.Inc()
+		return nil, errors.Wrap(err, errReconcile)
+	}
+
+	observe(report)
+
+	logrus.Infof("reconcile process finished in %s, repair: %t, route53 records: %d, database records: %d, drifts: %d",
+		report.Duration, repair, report.Route53Records, report.DatabaseRecords, len(report.Drifts))
+	for _, d := range report.Drifts {
+		logrus.Warnf("drift %s of %s record %s, route53: %q, database: %q, repaired: %t %s",
+			d.Kind, d.Type, d.Fqdn, d.Route53, d.Database, d.Repaired, d.Error)
+	}
+
+	return report, nil
+}
+
+func calculateInterval() (time.Duration, error) {
+	v := os.Getenv(flagInterval)
+	if v == "" {
+		return 0, nil
+	}
+	i, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.Wrapf(err, errInvalidEnv, flagInterval, v)
+	}
+	return i, nil
+}
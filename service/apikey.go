@@ -0,0 +1,92 @@
+package service
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	envAuthAPIKeysFile = "AUTH_API_KEYS_FILE"
+
+	scopeAdmin = "admin"
+)
+
+type apiKey struct {
+	name     string
+	key      []byte
+	identity *Identity
+}
+
+// apiKeyAuthenticator checks static api keys which are loaded from AUTH_API_KEYS_FILE.
+// Each line of the file is "<name> <key> <scope>", scope is admin or comma separated fqdns.
+// e.g. ci-robot 5yP1s3cr3t qrn7oq.lb.rancher.cloud,x1b2c3.lb.rancher.cloud
+type apiKeyAuthenticator struct {
+	keys []apiKey
+}
+
+func newAPIKeyAuthenticator() (*apiKeyAuthenticator, error) {
+	p := os.Getenv(envAuthAPIKeysFile)
+	if p == "" {
+		return nil, errors.Errorf(errEmptyAuthConfig, authAPIKey, strings.ToLower(envAuthAPIKeysFile))
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, errLoadAPIKeys, p)
+	}
+	defer f.Close()
+
+	a := &apiKeyAuthenticator{}
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, errors.Errorf(errParseAPIKey, p, n)
+		}
+
+		id := &Identity{Name: fields[0]}
+		if fields[2] == scopeAdmin {
+			id.Admin = true
+		} else {
+			id.Fqdns = strings.Split(fields[2], ",")
+		}
+
+		a.keys = append(a.keys, apiKey{
+			name:     fields[0],
+			key:      []byte(fields[1]),
+			identity: id,
+		})
+	}
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrapf(err, errLoadAPIKeys, p)
+	}
+
+	return a, nil
+}
+
+func (a *apiKeyAuthenticator) Name() string {
+	return authAPIKey
+}
+
+func (a *apiKeyAuthenticator) Authenticate(r *http.Request, fqdn string) (*Identity, error) {
+	token := []byte(bearerToken(r))
+	if len(token) == 0 {
+		return nil, nil
+	}
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare(k.key, token) == 1 {
+			return k.identity, nil
+		}
+	}
+	return nil, errors.New(errMismatchAPIKey)
+}
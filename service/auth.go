@@ -0,0 +1,161 @@
+package service
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/rancher/rdns-server/backend"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	envAuthChain = "AUTH_CHAIN"
+
+	authCert   = "cert"
+	authToken  = "token"
+	authJWT    = "jwt"
+	authAPIKey = "apikey"
+	authHMAC   = "hmac"
+
+	defaultAuthChain = "cert,hmac,token"
+)
+
+var authenticators []Authenticator
+
+// signedAuthenticators are the authenticators whose credentials can not be replayed,
+// they are the only ones tried for a domain which only accepts signed requests.
+var signedAuthenticators = map[string]bool{authCert: true, authHMAC: true}
+
+// Identity is the authenticated caller of a request.
+type Identity struct {
+	Name  string
+	Admin bool
+	Fqdns []string
+}
+
+// Allowed returns whether the identity may manage the fqdn.
+func (i *Identity) Allowed(fqdn string) bool {
+	if i.Admin {
+		return true
+	}
+	fqdn = rootFqdn(fqdn)
+	for _, f := range i.Fqdns {
+		if strings.EqualFold(strings.TrimRight(f, "."), fqdn) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator authenticates the caller of a request.
+// It returns a nil identity when the request carries no credential it understands.
+type Authenticator interface {
+	Name() string
+	Authenticate(r *http.Request, fqdn string) (*Identity, error)
+}
+
+// SetAuthenticators builds the authenticator chain from a comma separated list,
+// e.g. cert,hmac,token,jwt,apikey. The authenticators are tried in order.
+func SetAuthenticators(chain string) error {
+	if chain == "" {
+		chain = defaultAuthChain
+	}
+
+	as := make([]Authenticator, 0)
+	for _, n := range strings.Split(chain, ",") {
+		var (
+			a   Authenticator
+			err error
+		)
+		switch strings.TrimSpace(n) {
+		case authCert:
+			a = &certAuthenticator{}
+		case authToken:
+			a = &tokenAuthenticator{}
+		case authHMAC:
+			a, err = newHMACAuthenticator()
+		case authJWT:
+			a, err = newJWTAuthenticator()
+		case authAPIKey:
+			a, err = newAPIKeyAuthenticator()
+		default:
+			err = errors.Errorf(errUnknownAuthenticator, n)
+		}
+		if err != nil {
+			return err
+		}
+		as = append(as, a)
+	}
+
+	authenticators = as
+	return nil
+}
+
+// authenticate runs the authenticator chain and returns the first identity which may manage the fqdn.
+// An error is returned when the chain can not be built or the backend can not be read.
+func authenticate(r *http.Request, fqdn string) (*Identity, error) {
+	if authenticators == nil {
+		if err := SetAuthenticators(os.Getenv(envAuthChain)); err != nil {
+			return nil, err
+		}
+	}
+
+	signedOnly := false
+	if fqdn != "" {
+		signed, err := backend.GetBackend().RequiresSignature(rootFqdn(fqdn))
+		if err != nil {
+			return nil, err
+		}
+		signedOnly = signed
+	}
+
+	for _, a := range authenticators {
+		if signedOnly && !signedAuthenticators[a.Name()] {
+			continue
+		}
+		id, err := a.Authenticate(r, fqdn)
+		if err != nil {
+			logrus.Debugf("authenticator %s rejected the request: %v", a.Name(), err)
+			continue
+		}
+		if id != nil && id.Allowed(fqdn) {
+			logrus.Debugf("authenticator %s matched %s with fqdn %s", a.Name(), id.Name, fqdn)
+			return id, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// tokenAuthenticator checks the per-domain token which is returned when the domain is created.
+type tokenAuthenticator struct{}
+
+func (a *tokenAuthenticator) Name() string {
+	return authToken
+}
+
+func (a *tokenAuthenticator) Authenticate(r *http.Request, fqdn string) (*Identity, error) {
+	token := bearerToken(r)
+	if token == "" || fqdn == "" {
+		return nil, nil
+	}
+	if !compareToken(fqdn, token) {
+		return nil, errors.Errorf(errMismatchToken, fqdn)
+	}
+	root := rootFqdn(fqdn)
+	return &Identity{Name: root, Fqdns: []string{root}}, nil
+}
+
+// certAuthenticator checks the verified client certificate of a mutual tls connection.
+type certAuthenticator struct{}
+
+func (a *certAuthenticator) Name() string {
+	return authCert
+}
+
+func (a *certAuthenticator) Authenticate(r *http.Request, fqdn string) (*Identity, error) {
+	return certIdentity(r), nil
+}
@@ -0,0 +1,37 @@
+package service
+
+const (
+	errDecodeMigrateLine      = "failed to decode migrate line"
+	errEmptyAuthConfig        = "authenticator %s requires %s"
+	errEmptyMigrateField      = "expected %s field: %s"
+	errEmptyTLSKeyPair        = "both tls_cert_file and tls_key_file are required"
+	errExpiredJWT             = "jwt is expired or not valid yet"
+	errExpiredMigrate         = "%s is expired at %s"
+	errFetchJWKS              = "failed to fetch jwks from %s"
+	errInvalidJWTSignature    = "invalid jwt signature"
+	errInvalidMigrateText     = "TXT record %s is not a name under a domain"
+	errInvalidMigrateToken    = "invalid token format of %s"
+	errInvalidSignatureHeader = "invalid signature header: %s"
+	errLoadAPIKeys            = "failed to load api keys file: %s"
+	errLoadClientCA           = "failed to load client ca file: %s"
+	errLoadKeyPair            = "failed to load tls key pair: %s, %s"
+	errMismatchAPIKey         = "api key does not match"
+	errMismatchJWTClaim       = "jwt claim %s does not match"
+	errMismatchSignature      = "signature does not match with fqdn %s"
+	errNotLeader              = "not the leader, only a dry run is allowed"
+	errNotMigrateFqdn         = "%s is not a domain of the zone %s"
+	errMismatchToken          = "token does not match with fqdn %s"
+	errParseAPIKey            = "failed to parse api keys file %s at line %d"
+	errParseDryRun            = "invalid dry_run: %s"
+	errParseFlag              = "failed to parse flag: %s"
+	errParseJWT               = "failed to parse jwt"
+	errReadMigrateLine        = "failed to read migrate line %d"
+	errReplayedNonce          = "nonce %s has been used"
+	errSetAuthenticators      = "failed to set authenticators"
+	errSetTLSConfig           = "failed to set tls config"
+	errSignatureSkew          = "signature timestamp %s is out of the allowed clock skew"
+	errUnknownAuthenticator   = "unknown authenticator: %s"
+	errUnknownClientAuth      = "unknown tls client auth policy: %s"
+	errUnknownJWTKey          = "unknown jwt key: %s"
+	errUnsupportedJWTAlg      = "unsupported jwt algorithm: %s"
+)
@@ -2,13 +2,20 @@ package service
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/rancher/rdns-server/backend"
+	"github.com/rancher/rdns-server/backup"
+	"github.com/rancher/rdns-server/leader"
 	"github.com/rancher/rdns-server/model"
+	"github.com/rancher/rdns-server/policy"
+	"github.com/rancher/rdns-server/purge"
 
 	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -47,11 +54,17 @@ func returnSuccessWithToken(w http.ResponseWriter, d model.Domain, msg string) {
 		returnHTTPError(w, http.StatusInternalServerError, err)
 		return
 	}
+	secret, err := generateSigningSecret(d.Fqdn)
+	if err != nil {
+		returnHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
 	o := model.Response{
 		Status:  http.StatusOK,
 		Message: msg,
 		Data:    d,
 		Token:   token,
+		Secret:  secret,
 	}
 	res, err := json.Marshal(o)
 	if err != nil {
@@ -73,6 +86,44 @@ func returnSuccessNoData(w http.ResponseWriter) {
 	w.Write(res)
 }
 
+func returnSuccessWithData(w http.ResponseWriter, data interface{}, msg string) {
+	o := model.DataResponse{
+		Status:  http.StatusOK,
+		Message: msg,
+		Data:    data,
+	}
+	res, err := json.Marshal(o)
+	if err != nil {
+		returnHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+}
+
+// statusOfSetError returns the http status of an error which is returned when creating a domain or a frozen prefix.
+func statusOfSetError(err error) int {
+	switch {
+	case backend.IsNameTaken(err):
+		return http.StatusConflict
+	case backend.IsInvalidName(err), backend.IsInvalidLease(err):
+		return http.StatusBadRequest
+	case backend.IsNotFrozen(err):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// statusOfUpdateError returns the http status of an error which is returned when updating a domain.
+func statusOfUpdateError(err error) int {
+	if backend.IsSuspended(err) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
 func apiHandler(f http.Handler) http.Handler {
 	return context.ClearHandler(f)
 }
@@ -90,10 +141,37 @@ func createDomain(w http.ResponseWriter, r *http.Request) {
 		opts.Normal = true
 	}
 
+	if err := policy.GetPolicy().Check(opts); err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := backend.ValidateLeaseTime(opts.LeaseTime); err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if opts.HealthCheck != nil {
+		if err := opts.HealthCheck.Validate(); err != nil {
+			returnHTTPError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if err := model.ValidateWeights(opts.Hosts, opts.Weights); err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := model.ValidateRegions(opts.Hosts, opts.Regions); err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	b := backend.GetBackend()
 	d, err := b.Set(opts)
 	if err != nil {
-		returnHTTPError(w, http.StatusInternalServerError, err)
+		returnHTTPError(w, statusOfSetError(err), err)
 		return
 	}
 	returnSuccessWithToken(w, d, "")
@@ -149,10 +227,32 @@ func updateDomain(w http.ResponseWriter, r *http.Request) {
 	}
 	opts.Fqdn = fqdn
 
+	if err := policy.GetPolicy().Check(opts); err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if opts.HealthCheck != nil {
+		if err := opts.HealthCheck.Validate(); err != nil {
+			returnHTTPError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if err := model.ValidateWeights(opts.Hosts, opts.Weights); err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := model.ValidateRegions(opts.Hosts, opts.Regions); err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	b := backend.GetBackend()
 	d, err := b.Update(opts)
 	if err != nil {
-		returnHTTPError(w, http.StatusInternalServerError, err)
+		returnHTTPError(w, statusOfUpdateError(err), err)
 		return
 	}
 
@@ -192,10 +292,20 @@ func createDomainCNAME(w http.ResponseWriter, r *http.Request) {
 		opts.Normal = true
 	}
 
+	if err := policy.GetPolicy().Check(opts); err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := backend.ValidateLeaseTime(opts.LeaseTime); err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	b := backend.GetBackend()
 	d, err := b.SetCNAME(opts)
 	if err != nil {
-		returnHTTPError(w, http.StatusInternalServerError, err)
+		returnHTTPError(w, statusOfSetError(err), err)
 		return
 	}
 	returnSuccessWithToken(w, d, "")
@@ -235,10 +345,15 @@ func updateDomainCNAME(w http.ResponseWriter, r *http.Request) {
 	}
 	opts.Fqdn = fqdn
 
+	if err := policy.GetPolicy().Check(opts); err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	b := backend.GetBackend()
 	d, err := b.UpdateCNAME(opts)
 	if err != nil {
-		returnHTTPError(w, http.StatusInternalServerError, err)
+		returnHTTPError(w, statusOfUpdateError(err), err)
 		return
 	}
 
@@ -338,53 +453,134 @@ func ping(w http.ResponseWriter, r *http.Request) {
 	returnSuccessNoData(w)
 }
 
-func migrateRecord(w http.ResponseWriter, r *http.Request) {
-	opts, err := model.ParseMigrateRecord(r)
+func getPurgeReports(w http.ResponseWriter, r *http.Request) {
+	returnSuccessWithData(w, purge.GetReports(), "")
+}
+
+func runPurge(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := parseDryRun(r)
 	if err != nil {
-		returnHTTPError(w, http.StatusInternalServerError, err)
+		returnHTTPError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	b := backend.GetBackend()
-	err = b.MigrateRecord(opts)
+	// only the leader is allowed to change the records, followers can still report what would be purged
+	if !dryRun && !leader.IsLeader() {
+		returnHTTPError(w, http.StatusConflict, errors.New(errNotLeader))
+		return
+	}
+
+	returnSuccessWithData(w, purge.RunOnce(dryRun), "")
+}
+
+func listFrozen(w http.ResponseWriter, r *http.Request) {
+	fs, err := backend.GetBackend().ListFrozen(r.URL.Query().Get("prefix"))
 	if err != nil {
 		returnHTTPError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	returnSuccessNoData(w)
+	returnSuccessWithData(w, fs, "")
 }
 
-func migrateFrozen(w http.ResponseWriter, r *http.Request) {
-	opts, err := model.ParseMigrateFrozen(r)
+func addFrozen(w http.ResponseWriter, r *http.Request) {
+	opts, err := model.ParseFrozenOptions(r)
 	if err != nil {
-		returnHTTPError(w, http.StatusInternalServerError, err)
+		returnHTTPError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	b := backend.GetBackend()
-	err = b.MigrateFrozen(opts)
+	if _, err := opts.GetDuration(0); err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	f, err := backend.GetBackend().AddFrozen(opts)
 	if err != nil {
-		returnHTTPError(w, http.StatusInternalServerError, err)
+		returnHTTPError(w, statusOfSetError(err), err)
+		return
+	}
+
+	returnSuccessWithData(w, f, "")
+}
+
+func extendFrozen(w http.ResponseWriter, r *http.Request) {
+	// the body is optional, the frozen duration is added when it is empty
+	opts, err := model.ParseFrozenOptions(r)
+	if err != nil && err != io.EOF {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	opts.Prefix = mux.Vars(r)["prefix"]
+
+	if _, err := opts.GetDuration(0); err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	f, err := backend.GetBackend().ExtendFrozen(opts)
+	if err != nil {
+		returnHTTPError(w, statusOfSetError(err), err)
+		return
+	}
+
+	returnSuccessWithData(w, f, "")
+}
+
+func releaseFrozen(w http.ResponseWriter, r *http.Request) {
+	if err := backend.GetBackend().ReleaseFrozen(mux.Vars(r)["prefix"]); err != nil {
+		returnHTTPError(w, statusOfSetError(err), err)
 		return
 	}
 
 	returnSuccessNoData(w)
 }
 
-func migrateToken(w http.ResponseWriter, r *http.Request) {
-	opts, err := model.ParseMigrateToken(r)
+func listDS(w http.ResponseWriter, r *http.Request) {
+	ds, err := backend.GetBackend().ListDS()
 	if err != nil {
 		returnHTTPError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	b := backend.GetBackend()
-	err = b.MigrateToken(opts)
+	returnSuccessWithData(w, ds, "")
+}
+
+func exportState(w http.ResponseWriter, r *http.Request) {
+	// the export is streamed, an error after the first line can only be logged
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if err := backup.Export(w); err != nil {
+		logrus.Errorf("failed to stream export: %v", err)
+	}
+}
+
+func importState(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := parseDryRun(r)
 	if err != nil {
-		returnHTTPError(w, http.StatusInternalServerError, err)
+		returnHTTPError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	returnSuccessNoData(w)
+	report, err := backup.Import(r.Body, dryRun)
+	if err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	returnSuccessWithData(w, report, "")
+}
+
+// Used to parse the optional dry_run query parameter, it is false when it is empty
+func parseDryRun(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("dry_run")
+	if v == "" {
+		return false, nil
+	}
+
+	dryRun, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.Errorf(errParseDryRun, v)
+	}
+
+	return dryRun, nil
 }
@@ -0,0 +1,404 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	envAuthJWTIssuer     = "AUTH_JWT_ISSUER"
+	envAuthJWTAudience   = "AUTH_JWT_AUDIENCE"
+	envAuthJWTJWKSURL    = "AUTH_JWT_JWKS_URL"
+	envAuthJWTSecret     = "AUTH_JWT_SECRET"
+	envAuthJWTFqdnsClaim = "AUTH_JWT_FQDNS_CLAIM"
+	envAuthJWTAdminClaim = "AUTH_JWT_ADMIN_CLAIM"
+
+	defaultFqdnsClaim = "rdns_fqdns"
+	defaultAdminClaim = "rdns_admin"
+
+	jwksRefreshInterval = time.Minute
+	jwtLeeway           = 30 * time.Second
+)
+
+// jwtAuthenticator checks OIDC/JWT bearer tokens.
+// Tokens are verified with the issuer's JWKS (discovered from AUTH_JWT_ISSUER when AUTH_JWT_JWKS_URL is empty)
+// or with the shared AUTH_JWT_SECRET for HMAC signed tokens.
+// The fqdns claim lists the domains the caller may manage, the admin claim grants admin rights.
+type jwtAuthenticator struct {
+	issuer     string
+	audience   string
+	jwksURL    string
+	secret     []byte
+	fqdnsClaim string
+	adminClaim string
+
+	client  *http.Client
+	mu      sync.RWMutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func newJWTAuthenticator() (*jwtAuthenticator, error) {
+	a := &jwtAuthenticator{
+		issuer:     strings.TrimRight(os.Getenv(envAuthJWTIssuer), "/"),
+		audience:   os.Getenv(envAuthJWTAudience),
+		jwksURL:    os.Getenv(envAuthJWTJWKSURL),
+		secret:     []byte(os.Getenv(envAuthJWTSecret)),
+		fqdnsClaim: os.Getenv(envAuthJWTFqdnsClaim),
+		adminClaim: os.Getenv(envAuthJWTAdminClaim),
+		client:     &http.Client{Timeout: 10 * time.Second},
+		keys:       make(map[string]crypto.PublicKey),
+	}
+	if a.fqdnsClaim == "" {
+		a.fqdnsClaim = defaultFqdnsClaim
+	}
+	if a.adminClaim == "" {
+		a.adminClaim = defaultAdminClaim
+	}
+	if a.issuer == "" && a.jwksURL == "" && len(a.secret) == 0 {
+		return nil, errors.Errorf(errEmptyAuthConfig, authJWT, "auth_jwt_issuer, auth_jwt_jwks_url or auth_jwt_secret")
+	}
+	// tokens of the same issuer may be minted for the other services, only the ones for rdns are accepted
+	if a.audience == "" {
+		return nil, errors.Errorf(errEmptyAuthConfig, authJWT, "auth_jwt_audience")
+	}
+
+	if a.issuer != "" || a.jwksURL != "" {
+		// an unreachable issuer should not stop the server, keys are fetched again on demand
+		if err := a.refreshKeys(); err != nil {
+			logrus.Errorf("failed to fetch jwks: %v", err)
+		}
+	}
+
+	return a, nil
+}
+
+func (a *jwtAuthenticator) Name() string {
+	return authJWT
+}
+
+func (a *jwtAuthenticator) Authenticate(r *http.Request, fqdn string) (*Identity, error) {
+	token := bearerToken(r)
+	if strings.Count(token, ".") != 2 {
+		return nil, nil
+	}
+
+	claims, err := a.verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	id := &Identity{}
+	if sub, ok := claims["sub"].(string); ok {
+		id.Name = sub
+	}
+
+	switch v := claims[a.adminClaim].(type) {
+	case bool:
+		id.Admin = v
+	case string:
+		id.Admin = v == "true"
+	}
+
+	switch v := claims[a.fqdnsClaim].(type) {
+	case string:
+		id.Fqdns = strings.Split(v, ",")
+	case []interface{}:
+		for _, f := range v {
+			if s, ok := f.(string); ok {
+				id.Fqdns = append(id.Fqdns, s)
+			}
+		}
+	}
+
+	return id, nil
+}
+
+// verify checks the signature and the registered claims of a token and returns its claims.
+func (a *jwtAuthenticator) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.Wrap(err, errParseJWT)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(err, errParseJWT)
+	}
+
+	if err := a.verifySignature(header, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.Wrap(err, errParseJWT)
+	}
+
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return nil, errors.New(errExpiredJWT)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New(errExpiredJWT)
+	}
+	if a.issuer != "" {
+		if iss, _ := claims["iss"].(string); strings.TrimRight(iss, "/") != a.issuer {
+			return nil, errors.Errorf(errMismatchJWTClaim, "iss")
+		}
+	}
+	if !containsAudience(claims["aud"], a.audience) {
+		return nil, errors.Errorf(errMismatchJWTClaim, "aud")
+	}
+
+	return claims, nil
+}
+
+func (a *jwtAuthenticator) verifySignature(header jwtHeader, signed string, sig []byte) error {
+	if len(header.Alg) != 5 {
+		return errors.Errorf(errUnsupportedJWTAlg, header.Alg)
+	}
+
+	var h crypto.Hash
+	switch header.Alg[2:] {
+	case "256":
+		h = crypto.SHA256
+	case "384":
+		h = crypto.SHA384
+	case "512":
+		h = crypto.SHA512
+	default:
+		return errors.Errorf(errUnsupportedJWTAlg, header.Alg)
+	}
+	digest := hashOf(h, []byte(signed))
+
+	switch header.Alg[:2] {
+	case "HS":
+		if len(a.secret) == 0 {
+			return errors.Errorf(errUnsupportedJWTAlg, header.Alg)
+		}
+		m := hmac.New(h.New, a.secret)
+		m.Write([]byte(signed))
+		if !hmac.Equal(m.Sum(nil), sig) {
+			return errors.New(errInvalidJWTSignature)
+		}
+		return nil
+	case "RS":
+		k, ok := a.getKey(header.Kid).(*rsa.PublicKey)
+		if !ok {
+			return errors.Errorf(errUnknownJWTKey, header.Kid)
+		}
+		if err := rsa.VerifyPKCS1v15(k, h, digest, sig); err != nil {
+			return errors.Wrap(err, errInvalidJWTSignature)
+		}
+		return nil
+	case "ES":
+		k, ok := a.getKey(header.Kid).(*ecdsa.PublicKey)
+		if !ok {
+			return errors.Errorf(errUnknownJWTKey, header.Kid)
+		}
+		size := len(sig) / 2
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New(errInvalidJWTSignature)
+		}
+		return nil
+	default:
+		return errors.Errorf(errUnsupportedJWTAlg, header.Alg)
+	}
+}
+
+// getKey returns the public key of kid, the keys are fetched again if kid is unknown.
+func (a *jwtAuthenticator) getKey(kid string) crypto.PublicKey {
+	a.mu.RLock()
+	k, ok := a.keys[kid]
+	stale := time.Since(a.fetched) > jwksRefreshInterval
+	a.mu.RUnlock()
+
+	if ok || !stale || (a.issuer == "" && a.jwksURL == "") {
+		return k
+	}
+
+	if err := a.refreshKeys(); err != nil {
+		logrus.Errorf("failed to fetch jwks: %v", err)
+		return nil
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.keys[kid]
+}
+
+func (a *jwtAuthenticator) refreshKeys() error {
+	a.mu.Lock()
+	a.fetched = time.Now()
+	a.mu.Unlock()
+
+	u := a.jwksURL
+	if u == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := a.getJSON(a.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+			return err
+		}
+		u = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := a.getJSON(u, &set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			logrus.Debugf("skip jwk %s: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys = keys
+
+	return nil
+}
+
+func (a *jwtAuthenticator) getJSON(url string, v interface{}) error {
+	resp, err := a.client.Get(url)
+	if err != nil {
+		return errors.Wrapf(err, errFetchJWKS, url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf(errFetchJWKS, url)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf(errUnsupportedJWTAlg, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, errors.Errorf(errUnsupportedJWTAlg, k.Kty)
+	}
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func containsAudience(aud interface{}, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hashOf(h crypto.Hash, b []byte) []byte {
+	switch h {
+	case crypto.SHA384:
+		s := sha512.Sum384(b)
+		return s[:]
+	case crypto.SHA512:
+		s := sha512.Sum512(b)
+		return s[:]
+	default:
+		s := sha256.Sum256(b)
+		return s[:]
+	}
+}
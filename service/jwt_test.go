@@ -0,0 +1,181 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+const testAudience = "rdns"
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// signToken returns a token of the header and claims which is signed by sign.
+func signToken(t *testing.T, header jwtHeader, claims map[string]interface{}, sign func(signed []byte) []byte) string {
+	signed := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func hmacSigner(secret []byte) func([]byte) []byte {
+	return func(signed []byte) []byte {
+		m := hmac.New(sha256.New, secret)
+		m.Write(signed)
+		return m.Sum(nil)
+	}
+}
+
+func TestVerifyAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPub, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaSigner := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	ecSigner := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig
+	}
+	noSigner := func([]byte) []byte { return nil }
+
+	claims := map[string]interface{}{"aud": testAudience, "exp": time.Now().Add(time.Hour).Unix()}
+
+	tests := []struct {
+		name   string
+		secret []byte
+		header jwtHeader
+		sign   func([]byte) []byte
+		valid  bool
+	}{
+		{"HS256", []byte("secret"), jwtHeader{Alg: "HS256"}, hmacSigner([]byte("secret")), true},
+		{"HS256 with another secret", []byte("secret"), jwtHeader{Alg: "HS256"}, hmacSigner([]byte("other")), false},
+		{"HS256 without a secret", nil, jwtHeader{Alg: "HS256"}, hmacSigner(nil), false},
+		{"HS256 signed with the rsa public key", nil, jwtHeader{Alg: "HS256", Kid: "rsa"}, hmacSigner(rsaPub), false},
+		{"RS256", nil, jwtHeader{Alg: "RS256", Kid: "rsa"}, rsaSigner, true},
+		{"RS256 with the ec key", nil, jwtHeader{Alg: "RS256", Kid: "ec"}, rsaSigner, false},
+		{"RS256 with an unknown key", nil, jwtHeader{Alg: "RS256", Kid: "missing"}, rsaSigner, false},
+		{"RS256 signed with the secret", []byte("secret"), jwtHeader{Alg: "RS256", Kid: "rsa"}, hmacSigner([]byte("secret")), false},
+		{"ES256", nil, jwtHeader{Alg: "ES256", Kid: "ec"}, ecSigner, true},
+		{"ES256 with the rsa key", nil, jwtHeader{Alg: "ES256", Kid: "rsa"}, ecSigner, false},
+		{"none", []byte("secret"), jwtHeader{Alg: "none"}, noSigner, false},
+		{"NONE256", []byte("secret"), jwtHeader{Alg: "NO256"}, noSigner, false},
+		{"PS256", nil, jwtHeader{Alg: "PS256", Kid: "rsa"}, rsaSigner, false},
+		{"HS1", []byte("secret"), jwtHeader{Alg: "HS1"}, hmacSigner([]byte("secret")), false},
+	}
+
+	for _, tt := range tests {
+		a := &jwtAuthenticator{
+			audience: testAudience,
+			secret:   tt.secret,
+			keys: map[string]crypto.PublicKey{
+				"rsa": &rsaKey.PublicKey,
+				"ec":  &ecKey.PublicKey,
+			},
+			fetched: time.Now(),
+		}
+		token := signToken(t, tt.header, claims, tt.sign)
+		if _, err := a.verify(token); (err == nil) != tt.valid {
+			t.Errorf("%s: verify = %v, valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestVerifyClaims(t *testing.T) {
+	now := time.Now()
+	secret := []byte("secret")
+
+	tests := []struct {
+		name   string
+		issuer string
+		claims map[string]interface{}
+		valid  bool
+	}{
+		{"valid", "", map[string]interface{}{"aud": testAudience, "exp": now.Add(time.Hour).Unix()}, true},
+		{"no exp", "", map[string]interface{}{"aud": testAudience}, false},
+		{"string exp", "", map[string]interface{}{"aud": testAudience, "exp": "2999-01-01"}, false},
+		{"expired", "", map[string]interface{}{"aud": testAudience, "exp": now.Add(-time.Minute).Unix()}, false},
+		{"expired within the leeway", "", map[string]interface{}{"aud": testAudience, "exp": now.Add(-10 * time.Second).Unix()}, true},
+		{"not valid yet", "", map[string]interface{}{"aud": testAudience, "exp": now.Add(time.Hour).Unix(), "nbf": now.Add(time.Minute).Unix()}, false},
+		{"not valid yet within the leeway", "", map[string]interface{}{"aud": testAudience, "exp": now.Add(time.Hour).Unix(), "nbf": now.Add(10 * time.Second).Unix()}, true},
+		{"no aud", "", map[string]interface{}{"exp": now.Add(time.Hour).Unix()}, false},
+		{"other aud", "", map[string]interface{}{"aud": "other", "exp": now.Add(time.Hour).Unix()}, false},
+		{"aud list", "", map[string]interface{}{"aud": []string{"other", testAudience}, "exp": now.Add(time.Hour).Unix()}, true},
+		{"aud list without rdns", "", map[string]interface{}{"aud": []string{"other"}, "exp": now.Add(time.Hour).Unix()}, false},
+		{"iss", "https://issuer", map[string]interface{}{"aud": testAudience, "iss": "https://issuer/", "exp": now.Add(time.Hour).Unix()}, true},
+		{"other iss", "https://issuer", map[string]interface{}{"aud": testAudience, "iss": "https://other", "exp": now.Add(time.Hour).Unix()}, false},
+		{"no iss", "https://issuer", map[string]interface{}{"aud": testAudience, "exp": now.Add(time.Hour).Unix()}, false},
+	}
+
+	for _, tt := range tests {
+		a := &jwtAuthenticator{issuer: tt.issuer, audience: testAudience, secret: secret}
+		token := signToken(t, jwtHeader{Alg: "HS256"}, tt.claims, hmacSigner(secret))
+		if _, err := a.verify(token); (err == nil) != tt.valid {
+			t.Errorf("%s: verify = %v, valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	a := &jwtAuthenticator{audience: testAudience, secret: []byte("secret")}
+
+	for _, token := range []string{"..", "a.b.c", "e30.e30.!!", "e30.!!.AA"} {
+		if _, err := a.verify(token); err == nil {
+			t.Errorf("verify(%q) succeeded", token)
+		}
+	}
+}
+
+func TestNewJWTAuthenticatorAudience(t *testing.T) {
+	t.Setenv(envAuthJWTSecret, "secret")
+
+	tests := []struct {
+		audience string
+		valid    bool
+	}{
+		{"", false},
+		{testAudience, true},
+	}
+
+	for _, tt := range tests {
+		t.Setenv(envAuthJWTAudience, tt.audience)
+		if _, err := newJWTAuthenticator(); (err == nil) != tt.valid {
+			t.Errorf("newJWTAuthenticator with audience %q = %v, valid %v", tt.audience, err, tt.valid)
+		}
+	}
+}
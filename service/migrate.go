@@ -0,0 +1,309 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rancher/rdns-server/backend"
+	"github.com/rancher/rdns-server/backup"
+	"github.com/rancher/rdns-server/model"
+	"github.com/rancher/rdns-server/policy"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// migratePathPrefix is the path prefix of the apis which load the data of an older version, they are only allowed for admin identities.
+	migratePathPrefix = "/v1/migrate"
+	// maxMigrateLineSize is the max size of a line of a bulk migration.
+	maxMigrateLineSize = 1024 * 1024
+)
+
+// migrateTokenPattern is the format of the tokens which are generated for the domains.
+var migrateTokenPattern = regexp.MustCompile(`^[A-Za-z0-9]{32}$`)
+
+func migrateRecord(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	opts, err := model.ParseMigrateRecord(r)
+	if err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if status, err := applyMigrateRecord(opts, dryRun); err != nil {
+		returnHTTPError(w, status, err)
+		return
+	}
+
+	returnSuccessNoData(w)
+}
+
+func migrateFrozen(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	opts, err := model.ParseMigrateFrozen(r)
+	if err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if status, err := applyMigrateFrozen(opts, dryRun); err != nil {
+		returnHTTPError(w, status, err)
+		return
+	}
+
+	returnSuccessNoData(w)
+}
+
+func migrateToken(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	opts, err := model.ParseMigrateToken(r)
+	if err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if status, err := applyMigrateToken(opts, dryRun); err != nil {
+		returnHTTPError(w, status, err)
+		return
+	}
+
+	returnSuccessNoData(w)
+}
+
+func migrateRecordBulk(w http.ResponseWriter, r *http.Request) {
+	migrateBulk(w, r, func(line []byte, dryRun bool) (string, int, error) {
+		opts := &model.MigrateRecord{}
+		if err := json.Unmarshal(line, opts); err != nil {
+			return "", http.StatusBadRequest, errors.Wrap(err, errDecodeMigrateLine)
+		}
+		status, err := applyMigrateRecord(opts, dryRun)
+		return opts.Fqdn, status, err
+	})
+}
+
+func migrateFrozenBulk(w http.ResponseWriter, r *http.Request) {
+	migrateBulk(w, r, func(line []byte, dryRun bool) (string, int, error) {
+		opts := &model.MigrateFrozen{}
+		if err := json.Unmarshal(line, opts); err != nil {
+			return "", http.StatusBadRequest, errors.Wrap(err, errDecodeMigrateLine)
+		}
+		status, err := applyMigrateFrozen(opts, dryRun)
+		return opts.Path, status, err
+	})
+}
+
+func migrateTokenBulk(w http.ResponseWriter, r *http.Request) {
+	migrateBulk(w, r, func(line []byte, dryRun bool) (string, int, error) {
+		opts := &model.MigrateToken{}
+		if err := json.Unmarshal(line, opts); err != nil {
+			return "", http.StatusBadRequest, errors.Wrap(err, errDecodeMigrateLine)
+		}
+		status, err := applyMigrateToken(opts, dryRun)
+		return opts.Fqdn(), status, err
+	})
+}
+
+// Used to apply each line of a NDJSON body and stream a result line for it, a line which fails does not stop the others.
+// The results are streamed, an error after the first result can only be logged
+func migrateBulk(w http.ResponseWriter, r *http.Request, apply func(line []byte, dryRun bool) (string, int, error)) {
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		returnHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	write := func(result *model.MigrateResult) bool {
+		if err := encoder.Encode(result); err != nil {
+			logrus.Errorf("failed to stream migrate result: %v", err)
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxMigrateLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		name, status, err := apply(data, dryRun)
+		result := &model.MigrateResult{Line: line, Name: name, Status: status, DryRun: dryRun}
+		if err != nil {
+			logrus.Warnf("failed to migrate line %d %s: %v", line, name, err)
+			result.Error = err.Error()
+		}
+		if !write(result) {
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		write(&model.MigrateResult{
+			Line:   line + 1,
+			Status: http.StatusBadRequest,
+			DryRun: dryRun,
+			Error:  errors.Wrapf(err, errReadMigrateLine, line+1).Error(),
+		})
+	}
+}
+
+// The apply functions validate an item before anything is written, returns the http status of the item
+func applyMigrateRecord(opts *model.MigrateRecord, dryRun bool) (int, error) {
+	if err := validateMigrateRecord(opts); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if dryRun {
+		return http.StatusOK, nil
+	}
+	if err := backend.GetBackend().MigrateRecord(opts); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+func applyMigrateFrozen(opts *model.MigrateFrozen, dryRun bool) (int, error) {
+	if err := validateMigrateFrozen(opts); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if dryRun {
+		return http.StatusOK, nil
+	}
+	if err := backend.GetBackend().MigrateFrozen(opts); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+func applyMigrateToken(opts *model.MigrateToken, dryRun bool) (int, error) {
+	if err := validateMigrateToken(opts); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if dryRun {
+		return http.StatusOK, nil
+	}
+	if err := backend.GetBackend().MigrateToken(opts); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// A record is the A records of a domain of the zone, or a TXT record under a domain
+func validateMigrateRecord(opts *model.MigrateRecord) error {
+	zone := backend.GetBackend().GetZone()
+
+	name := strings.TrimSuffix(opts.Fqdn, "."+zone)
+	if name == opts.Fqdn || name == "" {
+		return errors.Errorf(errNotMigrateFqdn, opts.Fqdn, zone)
+	}
+	labels := strings.Split(name, ".")
+
+	if opts.Text != "" {
+		if len(labels) < 2 {
+			return errors.Errorf(errInvalidMigrateText, opts.Fqdn)
+		}
+		return backend.ValidateLabelSyntax(labels[len(labels)-1])
+	}
+
+	if len(labels) != 1 {
+		return errors.Errorf(errNotMigrateFqdn, opts.Fqdn, zone)
+	}
+	if err := backend.ValidateLabelSyntax(name); err != nil {
+		return err
+	}
+	if err := backup.ValidateHosts(opts.Hosts, opts.Fqdn); err != nil {
+		return err
+	}
+	if err := model.ValidateWeights(opts.Hosts, opts.Weights); err != nil {
+		return err
+	}
+	if err := model.ValidateRegions(opts.Hosts, opts.Regions); err != nil {
+		return err
+	}
+	for prefix, hosts := range opts.SubDomain {
+		if err := backend.ValidateLabelSyntax(prefix); err != nil {
+			return err
+		}
+		if err := backup.ValidateHosts(hosts, prefix+"."+opts.Fqdn); err != nil {
+			return err
+		}
+	}
+	if err := policy.GetPolicy().Check(&model.DomainOptions{Fqdn: opts.Fqdn, Hosts: opts.Hosts, SubDomain: opts.SubDomain}); err != nil {
+		return err
+	}
+	if opts.Token != "" && !migrateTokenPattern.MatchString(opts.Token) {
+		return errors.Errorf(errInvalidMigrateToken, opts.Fqdn)
+	}
+	if opts.Expiration != nil {
+		return validateMigrateExpiration(opts.Expiration, opts.Fqdn)
+	}
+
+	return nil
+}
+
+func validateMigrateFrozen(opts *model.MigrateFrozen) error {
+	if err := backend.ValidateLabelSyntax(opts.Path); err != nil {
+		return err
+	}
+	return validateMigrateExpiration(opts.Expiration, opts.Path)
+}
+
+func validateMigrateToken(opts *model.MigrateToken) error {
+	zone := backend.GetBackend().GetZone()
+
+	fqdn := opts.Fqdn()
+	label := strings.TrimSuffix(fqdn, "."+zone)
+	if label == fqdn || strings.Contains(label, ".") {
+		return errors.Errorf(errNotMigrateFqdn, fqdn, zone)
+	}
+	if err := backend.ValidateLabelSyntax(label); err != nil {
+		return err
+	}
+	if !migrateTokenPattern.MatchString(opts.Token) {
+		return errors.Errorf(errInvalidMigrateToken, fqdn)
+	}
+	return validateMigrateExpiration(opts.Expiration, fqdn)
+}
+
+// An expiration is required and must be in the future, the leases of etcd can not be granted otherwise
+func validateMigrateExpiration(expiration *time.Time, name string) error {
+	if expiration == nil {
+		return errors.Errorf(errEmptyMigrateField, "expiration", name)
+	}
+	if !expiration.After(time.Now()) {
+		return errors.Errorf(errExpiredMigrate, name, expiration.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -120,6 +120,78 @@ var routes = Routes{
 		"/v1/migrate/token",
 		migrateToken,
 	},
+	Route{
+		"migrateRecordsBulk",
+		"POST",
+		"/v1/migrate/record/bulk",
+		migrateRecordBulk,
+	},
+	Route{
+		"migrateFrozenBulk",
+		"POST",
+		"/v1/migrate/frozen/bulk",
+		migrateFrozenBulk,
+	},
+	Route{
+		"migrateTokenBulk",
+		"POST",
+		"/v1/migrate/token/bulk",
+		migrateTokenBulk,
+	},
+	Route{
+		"listFrozen",
+		"GET",
+		"/v1/admin/frozen",
+		listFrozen,
+	},
+	Route{
+		"addFrozen",
+		"POST",
+		"/v1/admin/frozen",
+		addFrozen,
+	},
+	Route{
+		"extendFrozen",
+		"PUT",
+		"/v1/admin/frozen/{prefix}",
+		extendFrozen,
+	},
+	Route{
+		"releaseFrozen",
+		"DELETE",
+		"/v1/admin/frozen/{prefix}",
+		releaseFrozen,
+	},
+	Route{
+		"getPurgeReports",
+		"GET",
+		"/v1/admin/purge/reports",
+		getPurgeReports,
+	},
+	Route{
+		"runPurge",
+		"POST",
+		"/v1/admin/purge",
+		runPurge,
+	},
+	Route{
+		"exportState",
+		"GET",
+		"/v1/admin/export",
+		exportState,
+	},
+	Route{
+		"importState",
+		"POST",
+		"/v1/admin/import",
+		importState,
+	},
+	Route{
+		"listDS",
+		"GET",
+		"/v1/admin/dnssec/ds",
+		listDS,
+	},
 }
 
 func NewRouter() *mux.Router {
@@ -140,3 +212,14 @@ func NewRouter() *mux.Router {
 
 	return router
 }
+
+// NewPlainRouter returns a router which only serves ping and metrics,
+// it is used by the plain http listener when the api is served over tls.
+func NewPlainRouter() *mux.Router {
+	router := mux.NewRouter().StrictSlash(true)
+
+	router.Methods("GET").Path("/ping").Name("ping").Handler(apiHandler(http.HandlerFunc(ping)))
+	router.Handle("/metrics", promhttp.Handler())
+
+	return router
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"crypto/tls"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	envPlainListen     = "PLAIN_LISTEN"
+	envTLSCertFile     = "TLS_CERT_FILE"
+	envTLSKeyFile      = "TLS_KEY_FILE"
+	envTLSClientCAFile = "TLS_CLIENT_CA_FILE"
+	envTLSClientAuth   = "TLS_CLIENT_AUTH"
+	envTLSAdminNames   = "TLS_ADMIN_NAMES"
+
+	clientAuthOptional = "optional"
+	clientAuthRequire  = "require"
+)
+
+// StartServer serves the API on listen, with TLS when a certificate and key are configured.
+// If PLAIN_LISTEN is set, ping and metrics are also served there without TLS.
+// Any listener failure is reported through done.
+func StartServer(listen string, done chan struct{}) error {
+	if err := SetAuthenticators(os.Getenv(envAuthChain)); err != nil {
+		return errors.Wrapf(err, errSetAuthenticators)
+	}
+
+	// the certificate reloader stops with the listener, it must not take the failure which is sent on done
+	stop := make(chan struct{})
+
+	var cfg *tls.Config
+	if os.Getenv(envTLSCertFile) != "" || os.Getenv(envTLSKeyFile) != "" {
+		c, err := newTLSConfig(stop)
+		if err != nil {
+			return errors.Wrapf(err, errSetTLSConfig)
+		}
+		cfg = c
+	}
+
+	go func() {
+		s := &http.Server{
+			Addr:      listen,
+			Handler:   NewRouter(),
+			TLSConfig: cfg,
+		}
+
+		var err error
+		if cfg != nil {
+			logrus.Infof("serving https on %s", listen)
+			// certificates are provided by the tls config, so that they can be reloaded
+			err = s.ListenAndServeTLS("", "")
+		} else {
+			logrus.Infof("serving http on %s", listen)
+			err = s.ListenAndServe()
+		}
+		logrus.Error(err)
+		close(stop)
+		done <- struct{}{}
+	}()
+
+	if plain := os.Getenv(envPlainListen); plain != "" {
+		go func() {
+			logrus.Infof("serving ping and metrics on %s", plain)
+			if err := http.ListenAndServe(plain, NewPlainRouter()); err != nil {
+				logrus.Error(err)
+				done <- struct{}{}
+			}
+		}()
+	}
+
+	return nil
+}
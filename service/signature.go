@@ -0,0 +1,134 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rancher/rdns-server/backend"
+	"github.com/rancher/rdns-server/util"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	envAuthSignatureSkew = "AUTH_SIGNATURE_SKEW"
+
+	defaultSignatureSkew = 5 * time.Minute
+	maxNonceLength       = 64
+	maxSignedBodySize    = 1 << 20
+)
+
+// hmacAuthenticator checks requests which are signed with the signing secret of a domain.
+// The signature covers method, path, query, body hash, timestamp and nonce, a request is rejected
+// when its timestamp is out of the clock skew window or its nonce has been seen before.
+type hmacAuthenticator struct {
+	skew   time.Duration
+	nonces *nonceCache
+}
+
+func newHMACAuthenticator() (*hmacAuthenticator, error) {
+	skew := defaultSignatureSkew
+	if v := os.Getenv(envAuthSignatureSkew); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, errParseFlag, strings.ToLower(envAuthSignatureSkew))
+		}
+		skew = d
+	}
+
+	return &hmacAuthenticator{
+		skew:   skew,
+		nonces: &nonceCache{seen: make(map[string]time.Time)},
+	}, nil
+}
+
+func (a *hmacAuthenticator) Name() string {
+	return authHMAC
+}
+
+func (a *hmacAuthenticator) Authenticate(r *http.Request, fqdn string) (*Identity, error) {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, util.SignatureScheme+" ") || fqdn == "" {
+		return nil, nil
+	}
+	signature := strings.TrimSpace(strings.TrimPrefix(authorization, util.SignatureScheme))
+
+	timestamp := r.Header.Get(util.SignatureTimestamp)
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, errInvalidSignatureHeader, util.SignatureTimestamp)
+	}
+	if d := time.Since(time.Unix(ts, 0)); d > a.skew || d < -a.skew {
+		return nil, errors.Errorf(errSignatureSkew, timestamp)
+	}
+
+	nonce := r.Header.Get(util.SignatureNonce)
+	if nonce == "" || len(nonce) > maxNonceLength {
+		return nil, errors.Errorf(errInvalidSignatureHeader, util.SignatureNonce)
+	}
+
+	// read the body for hashing and put it back for the handler, the body of a domain request is small
+	var body []byte
+	if r.Body != nil {
+		body, err = ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxSignedBodySize))
+		if err != nil {
+			return nil, err
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	root := rootFqdn(fqdn)
+	origin, err := backend.GetBackend().GetToken(root)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := util.SignRequest(util.SigningSecret(origin), r.Method, r.URL.EscapedPath(), util.CanonicalQuery(r.URL.RawQuery), util.HashBody(body), timestamp, nonce)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, errors.Errorf(errMismatchSignature, fqdn)
+	}
+
+	// only a valid signature may consume a nonce, the nonce is remembered as long as its timestamp is acceptable
+	if !a.nonces.add(root+"/"+nonce, time.Unix(ts, 0).Add(a.skew)) {
+		return nil, errors.Errorf(errReplayedNonce, nonce)
+	}
+
+	return &Identity{Name: root, Fqdns: []string{root}}, nil
+}
+
+// nonceCache remembers the nonces which have been used until they expire.
+type nonceCache struct {
+	mu     sync.Mutex
+	seen   map[string]time.Time
+	purged time.Time
+}
+
+// add returns false if the nonce has been used before.
+func (c *nonceCache) add(nonce string, expiration time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.purged) > time.Second {
+		for k, e := range c.seen {
+			if now.After(e) {
+				delete(c.seen, k)
+			}
+		}
+		c.purged = now
+	}
+
+	if _, ok := c.seen[nonce]; ok {
+		return false
+	}
+	c.seen[nonce] = expiration
+
+	return true
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const reloadInterval = 10 * time.Second
+
+// certReloader keeps the serving certificate and the client CA pool in memory
+// and reloads them when the files on disk change.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime time.Time
+}
+
+// newTLSConfig loads the certificate and the client CA bundle, which are reloaded until stop is closed.
+func newTLSConfig(stop chan struct{}) (*tls.Config, error) {
+	r := &certReloader{
+		certFile: os.Getenv(envTLSCertFile),
+		keyFile:  os.Getenv(envTLSKeyFile),
+		caFile:   os.Getenv(envTLSClientCAFile),
+	}
+	if r.certFile == "" || r.keyFile == "" {
+		return nil, errors.New(errEmptyTLSKeyPair)
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	go wait.Until(r.reload, reloadInterval, stop)
+
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.getCertificate,
+	}
+
+	if r.caFile == "" {
+		return cfg, nil
+	}
+
+	var clientAuth tls.ClientAuthType
+	switch os.Getenv(envTLSClientAuth) {
+	case "", clientAuthOptional:
+		clientAuth = tls.VerifyClientCertIfGiven
+	case clientAuthRequire:
+		clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, errors.Errorf(errUnknownClientAuth, os.Getenv(envTLSClientAuth))
+	}
+
+	// the client CA pool is resolved per connection, so a reloaded bundle takes effect at once
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := cfg.Clone()
+		c.GetConfigForClient = nil
+		c.ClientAuth = clientAuth
+		c.ClientCAs = r.getClientCAs()
+		return c, nil
+	}
+
+	return cfg, nil
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) getClientCAs() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pool
+}
+
+func (r *certReloader) reload() {
+	m, err := r.lastModTime()
+	if err != nil {
+		logrus.Errorf("failed to stat tls files: %v", err)
+		return
+	}
+
+	r.mu.RLock()
+	changed := m.After(r.modTime)
+	r.mu.RUnlock()
+
+	if !changed {
+		return
+	}
+
+	if err := r.load(); err != nil {
+		logrus.Errorf("failed to reload tls files, keep serving the previous ones: %v", err)
+		return
+	}
+	logrus.Infof("reloaded tls certificate %s", r.certFile)
+}
+
+func (r *certReloader) load() error {
+	m, err := r.lastModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.Wrapf(err, errLoadKeyPair, r.certFile, r.keyFile)
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		b, err := ioutil.ReadFile(r.caFile)
+		if err != nil {
+			return errors.Wrapf(err, errLoadClientCA, r.caFile)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return errors.Errorf(errLoadClientCA, r.caFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.pool = pool
+	r.modTime = m
+
+	return nil
+}
+
+// lastModTime returns the latest modification time of the watched files.
+func (r *certReloader) lastModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		if f == "" {
+			continue
+		}
+		fi, err := os.Stat(f)
+		if err != nil {
+			return latest, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// certIdentity maps a verified client certificate to an identity.
+// The common name is checked against TLS_ADMIN_NAMES for admin rights,
+// otherwise the common name and DNS names are the fqdns it may manage.
+// e.g. CN=qrn7oq.lb.rancher.cloud => domain identity of qrn7oq.lb.rancher.cloud
+func certIdentity(r *http.Request) *Identity {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+
+	for _, n := range strings.Split(os.Getenv(envTLSAdminNames), ",") {
+		if n != "" && strings.TrimSpace(n) == cert.Subject.CommonName {
+			return &Identity{Name: cert.Subject.CommonName, Admin: true}
+		}
+	}
+
+	fqdns := make([]string, 0)
+	if cert.Subject.CommonName != "" {
+		fqdns = append(fqdns, cert.Subject.CommonName)
+	}
+	fqdns = append(fqdns, cert.DNSNames...)
+
+	return &Identity{Name: cert.Subject.CommonName, Fqdns: fqdns}
+}
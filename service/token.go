@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/rancher/rdns-server/backend"
+	"github.com/rancher/rdns-server/util"
 
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
@@ -13,6 +14,9 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// adminPathPrefix is the path prefix of the apis which are only allowed for admin identities.
+const adminPathPrefix = "/v1/admin"
+
 func generateToken(fqdn string) (string, error) {
 	b := backend.GetBackend()
 	origin, err := b.GetToken(fqdn)
@@ -30,8 +34,20 @@ func generateToken(fqdn string) (string, error) {
 	return token, nil
 }
 
-func compareToken(fqdn, token string) bool {
-	// normal text record & acme text record need special treatment
+// generateSigningSecret returns the secret which signs the requests of fqdn.
+func generateSigningSecret(fqdn string) (string, error) {
+	origin, err := backend.GetBackend().GetToken(fqdn)
+	if err != nil {
+		logrus.Errorf("failed to get token origin %s, err: %v", fqdn, err)
+		return "", err
+	}
+	return util.SigningSecret(origin), nil
+}
+
+// rootFqdn returns the fqdn which owns the token.
+// normal text record & acme text record need special treatment
+// e.g. _acme-challenge.qrn7oq.lb.rancher.cloud => qrn7oq.lb.rancher.cloud
+func rootFqdn(fqdn string) string {
 	fqdnLen := len(strings.Split(fqdn, "."))
 	rootDomainLen := len(strings.Split(backend.GetBackend().GetZone(), "."))
 	diffLen := fqdnLen - rootDomainLen
@@ -39,6 +55,11 @@ func compareToken(fqdn, token string) bool {
 		sp := strings.SplitAfterN(fqdn, ".", diffLen)
 		fqdn = sp[len(sp)-1]
 	}
+	return fqdn
+}
+
+func compareToken(fqdn, token string) bool {
+	fqdn = rootFqdn(fqdn)
 
 	hash, err := base64.StdEncoding.DecodeString(token)
 	if err != nil {
@@ -69,22 +90,46 @@ func tokenMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// createDomain and ping and metrics have no need to check token
 		logrus.Debugf("request URL path: %s", r.URL.Path)
+		if strings.HasPrefix(r.URL.Path, adminPathPrefix) || strings.HasPrefix(r.URL.Path, migratePathPrefix) {
+			id, err := authenticate(r, "")
+			if err != nil {
+				returnHTTPError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if id == nil || !id.Admin {
+				returnHTTPError(w, http.StatusForbidden, errors.New("forbidden to use"))
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
 		if (r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/txt")) ||
 			(r.Method != http.MethodPost && !strings.HasPrefix(r.URL.Path, "/ping") && !strings.HasPrefix(r.URL.Path, "/metrics")) {
-			authorization := r.Header.Get("Authorization")
-			token := strings.TrimLeft(authorization, "Bearer ")
 			fqdn, ok := mux.Vars(r)["fqdn"]
-			if ok {
-				if !compareToken(fqdn, token) {
-					returnHTTPError(w, http.StatusForbidden, errors.New("forbidden to use"))
-					return
-				}
-			} else {
+			if !ok {
 				returnHTTPError(w, http.StatusForbidden, errors.New("must specific the fqdn"))
 				return
 			}
+			id, err := authenticate(r, fqdn)
+			if err != nil {
+				returnHTTPError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if id == nil {
+				returnHTTPError(w, http.StatusForbidden, errors.New("forbidden to use"))
+				return
+			}
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// bearerToken returns the token of the Authorization header, signed requests have no bearer token.
+func bearerToken(r *http.Request) string {
+	authorization := r.Header.Get("Authorization")
+	if strings.HasPrefix(authorization, util.SignatureScheme+" ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+}
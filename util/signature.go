@@ -0,0 +1,47 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+const (
+	SignatureScheme    = "RDNS-HMAC-SHA256"
+	SignatureTimestamp = "X-Rdns-Timestamp"
+	SignatureNonce     = "X-Rdns-Nonce"
+
+	signingSecretLabel = "rdns-request-signing"
+)
+
+// SigningSecret derives the secret which signs requests of a domain from its origin token.
+func SigningSecret(origin string) string {
+	m := hmac.New(sha256.New, []byte(origin))
+	m.Write([]byte(signingSecretLabel))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// HashBody returns the hex encoded sha256 of a request body.
+func HashBody(body []byte) string {
+	s := sha256.Sum256(body)
+	return hex.EncodeToString(s[:])
+}
+
+// CanonicalQuery returns the query string with its parameters sorted by key, so that the client and the server
+// sign the same string regardless of the order of the parameters. A query which can not be parsed is signed as it is.
+func CanonicalQuery(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+	return values.Encode()
+}
+
+// SignRequest signs the method, path, canonical query, body hash, timestamp and nonce of a request with secret.
+func SignRequest(secret, method, path, query, bodyHash, timestamp, nonce string) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(strings.Join([]string{method, path, query, bodyHash, timestamp, nonce}, "\n")))
+	return hex.EncodeToString(m.Sum(nil))
+}
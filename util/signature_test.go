@@ -0,0 +1,60 @@
+package util
+
+import "testing"
+
+func TestCanonicalQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", ""},
+		{"dry_run=true", "dry_run=true"},
+		{"b=2&a=1", "a=1&b=2"},
+		{"a=2&a=1", "a=2&a=1"},
+		{"name=a%20b", "name=a+b"},
+		{"name=a+b", "name=a+b"},
+		{"flag", "flag="},
+		{"a=%zz", "a=%zz"},
+	}
+
+	for _, tt := range tests {
+		if got := CanonicalQuery(tt.query); got != tt.want {
+			t.Errorf("CanonicalQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSignRequest(t *testing.T) {
+	secret := SigningSecret("origin")
+	body := HashBody([]byte(`{"hosts":["1.1.1.1"]}`))
+	sig := SignRequest(secret, "PUT", "/v1/domain/a.lb.rancher.cloud", "", body, "1500000000", "nonce")
+
+	if sig != SignRequest(secret, "PUT", "/v1/domain/a.lb.rancher.cloud", "", body, "1500000000", "nonce") {
+		t.Fatal("SignRequest is not deterministic")
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		method    string
+		path      string
+		query     string
+		bodyHash  string
+		timestamp string
+		nonce     string
+	}{
+		{"secret", SigningSecret("other"), "PUT", "/v1/domain/a.lb.rancher.cloud", "", body, "1500000000", "nonce"},
+		{"method", secret, "DELETE", "/v1/domain/a.lb.rancher.cloud", "", body, "1500000000", "nonce"},
+		{"path", secret, "PUT", "/v1/domain/b.lb.rancher.cloud", "", body, "1500000000", "nonce"},
+		{"query", secret, "PUT", "/v1/domain/a.lb.rancher.cloud", "dry_run=true", body, "1500000000", "nonce"},
+		{"body", secret, "PUT", "/v1/domain/a.lb.rancher.cloud", "", HashBody(nil), "1500000000", "nonce"},
+		{"timestamp", secret, "PUT", "/v1/domain/a.lb.rancher.cloud", "", body, "1500000001", "nonce"},
+		{"nonce", secret, "PUT", "/v1/domain/a.lb.rancher.cloud", "", body, "1500000000", "other"},
+	}
+
+	for _, tt := range tests {
+		if SignRequest(tt.secret, tt.method, tt.path, tt.query, tt.bodyHash, tt.timestamp, tt.nonce) == sig {
+			t.Errorf("the signature does not cover the %s", tt.name)
+		}
+	}
+}